@@ -3,10 +3,109 @@ package im
 import (
 	"errors"
 	"im/logger"
+	"im/wire"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// errors
+var (
+	ErrChannelFull = errors.New("channel write queue is full")
+)
+
+const (
+	// DefaultWriteQueueSize 默认写队列长度
+	DefaultWriteQueueSize = 5
+	// DefaultWriteBufferSize 默认连接写缓冲大小
+	DefaultWriteBufferSize = 4096
+	// DefaultPongWait 服务端发送ping后等待响应的默认时间
+	DefaultPongWait = time.Second * 10
+)
+
+// OverflowPolicy 写队列满时的处理策略
+type OverflowPolicy int
+
+const (
+	// OverflowBlock 阻塞等待，超过OverflowWait后返回ErrChannelFull
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest 丢弃队列中最早的消息，写入新消息
+	OverflowDropOldest
+	// OverflowDropNewest 丢弃当前消息，返回ErrChannelFull
+	OverflowDropNewest
+	// OverflowDisconnect 关闭慢消费者，返回ErrChannelFull
+	OverflowDisconnect
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop_oldest"
+	case OverflowDropNewest:
+		return "drop_newest"
+	case OverflowDisconnect:
+		return "disconnect"
+	}
+	return "unknown"
+}
+
+// ChannelOptions ChannelOptions
+type ChannelOptions struct {
+	QueueSize      int            //写队列长度
+	OverflowPolicy OverflowPolicy //写队列满时的处理策略
+	OverflowWait   time.Duration  //OverflowBlock策略下的最长等待时间
+	Dispatcher     Dispatcher     //消息分发器
+	Heartbeat      time.Duration  //连接空闲时服务端发送ping的间隔，0表示不发送
+	PongWait       time.Duration  //发送ping后等待客户端响应的时间
+}
+
+// ChannelOption ChannelOption
+type ChannelOption func(opts *ChannelOptions)
+
+// WithQueueSize set size of the write queue
+func WithQueueSize(size int) ChannelOption {
+	return func(opts *ChannelOptions) {
+		opts.QueueSize = size
+	}
+}
+
+// WithOverflowPolicy set the policy used when the write queue is full
+func WithOverflowPolicy(policy OverflowPolicy) ChannelOption {
+	return func(opts *ChannelOptions) {
+		opts.OverflowPolicy = policy
+	}
+}
+
+// WithOverflowWait set max wait duration of OverflowBlock
+func WithOverflowWait(wait time.Duration) ChannelOption {
+	return func(opts *ChannelOptions) {
+		opts.OverflowWait = wait
+	}
+}
+
+// WithDispatcher set the Dispatcher used by Readloop
+func WithDispatcher(dispatcher Dispatcher) ChannelOption {
+	return func(opts *ChannelOptions) {
+		opts.Dispatcher = dispatcher
+	}
+}
+
+// WithHeartbeat enable server-initiated ping; interval defaults to DefaultHeartbeat and pongWait to DefaultPongWait
+func WithHeartbeat(interval, pongWait time.Duration) ChannelOption {
+	return func(opts *ChannelOptions) {
+		if interval <= 0 {
+			interval = DefaultHeartbeat
+		}
+		if pongWait <= 0 {
+			pongWait = DefaultPongWait
+		}
+		opts.Heartbeat = interval
+		opts.PongWait = pongWait
+	}
+}
+
 // Channel is interface of client side
 type Channel interface {
 	Conn
@@ -17,6 +116,10 @@ type Channel interface {
 	// SetWriteWait 设置写超时
 	SetWriteWait(time.Duration)
 	SetReadWait(time.Duration)
+	// LastActive 最后一次收到数据的时间
+	LastActive() time.Time
+	// Version 登录时协商的包格式版本，推送LogicPkt时使用
+	Version() wire.Version
 }
 
 // ChannelImpl is a websocket implement of channel
@@ -26,35 +129,63 @@ type ChannelImpl struct {
 	Conn
 	writechan chan []byte
 	once      sync.Once
-	writeWait time.Duration
-	readwait  time.Duration
+	writeWait int64 // time.Duration, accessed atomically
+	readwait  int64 // time.Duration, accessed atomically
 	closed    *Event
+	options   ChannelOptions
+	active    int64 // unix nano of last activity
+	pinged    int64 // unix nano of last ping, only used in writeloop
 }
 
 // NewChannel NewChannel
-func NewChannel(id string, conn Conn) Channel {
+func NewChannel(id string, conn Conn, opts ...ChannelOption) Channel {
 	log := logger.WithFields(logger.Fields{
 		"module": "channel",
 		"id":     id,
 	})
+	options := ChannelOptions{
+		QueueSize:      DefaultWriteQueueSize,
+		OverflowPolicy: OverflowBlock,
+		OverflowWait:   DefaultWriteWait,
+		Dispatcher:     DefaultDispatcher,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultWriteQueueSize
+	}
+	if options.Dispatcher == nil {
+		options.Dispatcher = DefaultDispatcher
+	}
 	ch := &ChannelImpl{
 		id:        id,
 		Conn:      conn,
-		writechan: make(chan []byte, 5),
+		writechan: make(chan []byte, options.QueueSize),
 		closed:    NewEvent(),
-		writeWait: DefaultWriteWait, //default value
-		readwait:  DefaultReadWait,
+		writeWait: int64(DefaultWriteWait), //default value
+		readwait:  int64(DefaultReadWait),
+		options:   options,
+		active:    time.Now().UnixNano(),
 	}
 	go func() {
 		err := ch.writeloop()
 		if err != nil {
 			log.Info(err)
+			// 写失败之后连接不可用，关闭channel，Push立即返回ErrChannelClosed，Readloop也随之退出
+			_ = ch.Close()
 		}
 	}()
 	return ch
 }
 
 func (ch *ChannelImpl) writeloop() error {
+	var heartbeat <-chan time.Time
+	if ch.options.Heartbeat > 0 {
+		ticker := time.NewTicker(ch.options.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
 	for {
 		select {
 		case payload := <-ch.writechan:
@@ -74,37 +205,129 @@ func (ch *ChannelImpl) writeloop() error {
 			if err != nil {
 				return err
 			}
+		case <-heartbeat:
+			err := ch.ping()
+			if err != nil {
+				return err
+			}
 		case <-ch.closed.Done():
 			return nil
 		}
 	}
 }
 
+// ping 连接空闲超过Heartbeat时发送ping，并把读超时缩短为PongWait
+//
+// 上一个ping还没有收到响应时不再发送，避免推迟读超时；
+// 读超时要在发送ping之前设置，否则可能覆盖Readloop收到pong之后重置的读超时
+func (ch *ChannelImpl) ping() error {
+	now := time.Now()
+	active := atomic.LoadInt64(&ch.active)
+	if active < ch.pinged {
+		return nil
+	}
+	last := time.Unix(0, active)
+	if now.Sub(last) < ch.options.Heartbeat {
+		return nil
+	}
+	ch.pinged = now.UnixNano()
+	deadline := now.Add(ch.options.PongWait)
+	if idle := last.Add(time.Duration(atomic.LoadInt64(&ch.readwait))); idle.Before(deadline) {
+		deadline = idle
+	}
+	err := ch.Conn.SetReadDeadline(deadline)
+	if err != nil {
+		return err
+	}
+	err = ch.WriteFrame(OpPing, nil)
+	if err != nil {
+		return err
+	}
+	return ch.Conn.Flush()
+}
+
+// LastActive 最后一次收到数据的时间
+func (ch *ChannelImpl) LastActive() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&ch.active))
+}
+
 // ID id
 func (ch *ChannelImpl) ID() string { return ch.id }
 
+// Version 由登录阶段的HelloConn决定，没有协商时是wire.Version0
+func (ch *ChannelImpl) Version() wire.Version { return VersionOf(ch.Conn) }
+
+// Push 异步写；写队列满时按OverflowPolicy处理
 func (ch *ChannelImpl) Push(payload []byte) error {
 	if ch.closed.HasFired() {
-		return errors.New("channel has closed")
+		return ErrChannelClosed
+	}
+	select {
+	case ch.writechan <- payload:
+		return nil
+	case <-ch.closed.Done():
+		return ErrChannelClosed
+	default:
+	}
+	return ch.overflow(payload)
+}
+
+func (ch *ChannelImpl) overflow(payload []byte) error {
+	switch ch.options.OverflowPolicy {
+	case OverflowDropNewest:
+		return ErrChannelFull
+	case OverflowDisconnect:
+		logger.WithFields(logger.Fields{
+			"module": "channel",
+			"id":     ch.id,
+		}).Warn("write queue is full, close the slow consumer")
+		_ = ch.Close()
+		return ErrChannelFull
+	case OverflowDropOldest:
+		for i := 0; i < cap(ch.writechan); i++ {
+			select {
+			case <-ch.writechan:
+			default:
+			}
+			select {
+			case ch.writechan <- payload:
+				return nil
+			case <-ch.closed.Done():
+				return ErrChannelClosed
+			default:
+			}
+		}
+		return ErrChannelFull
+	default:
+		timer := time.NewTimer(ch.options.OverflowWait)
+		defer timer.Stop()
+		select {
+		case ch.writechan <- payload:
+			return nil
+		case <-ch.closed.Done():
+			return ErrChannelClosed
+		case <-timer.C:
+			return ErrChannelFull
+		}
 	}
-	// 异步写
-	ch.writechan <- payload
-	return nil
 }
 
 // overwrite Conn
 func (ch *ChannelImpl) WriteFrame(code OpCode, payload []byte) error {
-	_ = ch.Conn.SetWriteDeadline(time.Now().Add(ch.writeWait))
+	_ = ch.Conn.SetWriteDeadline(time.Now().Add(time.Duration(atomic.LoadInt64(&ch.writeWait))))
 	return ch.Conn.WriteFrame(code, payload)
 }
 
 // Close 关闭连接
+//
+// writechan不会被关闭，Push与Close并发调用是安全的
 func (ch *ChannelImpl) Close() error {
+	var err error
 	ch.once.Do(func() {
-		close(ch.writechan)
 		ch.closed.Fire()
+		err = ch.Conn.Close()
 	})
-	return nil
+	return err
 }
 
 // SetWriteWait 设置写超时
@@ -112,14 +335,14 @@ func (ch *ChannelImpl) SetWriteWait(writeWait time.Duration) {
 	if writeWait == 0 {
 		return
 	}
-	ch.writeWait = writeWait
+	atomic.StoreInt64(&ch.writeWait, int64(writeWait))
 }
 
 func (ch *ChannelImpl) SetReadWait(readwait time.Duration) {
 	if readwait == 0 {
 		return
 	}
-	ch.writeWait = readwait
+	atomic.StoreInt64(&ch.readwait, int64(readwait))
 }
 
 func (ch *ChannelImpl) Readloop(lst MessageListener) error {
@@ -131,24 +354,36 @@ func (ch *ChannelImpl) Readloop(lst MessageListener) error {
 		"id":     ch.id,
 	})
 	for {
-		_ = ch.SetReadDeadline(time.Now().Add(ch.readwait))
+		_ = ch.SetReadDeadline(time.Now().Add(time.Duration(atomic.LoadInt64(&ch.readwait))))
 
 		frame, err := ch.ReadFrame()
+		if err == ErrFrameTooLarge {
+			_ = ch.WriteFrame(OpClose, []byte(err.Error()))
+			_ = ch.Flush()
+			return err
+		}
 		if err != nil {
 			return err
 		}
+		atomic.StoreInt64(&ch.active, time.Now().UnixNano())
 		if frame.GetOpCode() == OpClose {
 			return errors.New("remote side close the channel")
 		}
 		if frame.GetOpCode() == OpPing {
 			log.Trace("recv a ping; resp with a pong")
 			_ = ch.WriteFrame(OpPong, nil)
+			_ = ch.Flush()
+			continue
+		}
+		if frame.GetOpCode() == OpPong {
 			continue
 		}
 		payload := frame.GetPayload()
 		if len(payload) == 0 {
 			continue
 		}
-		go lst.Receive(ch, payload)
+		if err := ch.options.Dispatcher.Dispatch(lst, ch, payload); err != nil {
+			return err
+		}
 	}
 }
@@ -0,0 +1,192 @@
+package im
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockConn is a Conn whose writes block until it is closed
+type blockConn struct {
+	net.Conn
+	closed *Event
+}
+
+func newBlockConn() *blockConn {
+	c1, _ := net.Pipe()
+	return &blockConn{Conn: c1, closed: NewEvent()}
+}
+
+func (c *blockConn) ReadFrame() (Frame, error) {
+	<-c.closed.Done()
+	return nil, net.ErrClosed
+}
+
+func (c *blockConn) WriteFrame(OpCode, []byte) error {
+	<-c.closed.Done()
+	return net.ErrClosed
+}
+
+func (c *blockConn) Flush() error { return nil }
+
+func (c *blockConn) Close() error {
+	c.closed.Fire()
+	return c.Conn.Close()
+}
+
+// fill the queue; writeloop holds the first payload in WriteFrame
+func fill(t *testing.T, ch Channel, n int) {
+	if err := ch.Push([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 20)
+	for i := 0; i < n; i++ {
+		if err := ch.Push([]byte{byte(i)}); err != nil {
+			t.Fatalf("push %d: %v", i, err)
+		}
+	}
+}
+
+func TestChannelOverflowPolicy(t *testing.T) {
+	cases := []struct {
+		policy OverflowPolicy
+		err    error
+	}{
+		{OverflowBlock, ErrChannelFull},
+		{OverflowDropNewest, ErrChannelFull},
+		{OverflowDropOldest, nil},
+		{OverflowDisconnect, ErrChannelFull},
+	}
+	for _, c := range cases {
+		conn := newBlockConn()
+		ch := NewChannel("test", conn, WithQueueSize(2), WithOverflowPolicy(c.policy), WithOverflowWait(time.Millisecond*10))
+		fill(t, ch, 2)
+
+		err := ch.Push([]byte("x"))
+		if err != c.err {
+			t.Errorf("policy %s: got %v, want %v", c.policy, err, c.err)
+		}
+		if c.policy == OverflowDisconnect && !conn.closed.HasFired() {
+			t.Errorf("policy %s: conn is not closed", c.policy)
+		}
+		_ = ch.Close()
+	}
+}
+
+func TestChannelPushCloseRace(t *testing.T) {
+	ch := NewChannel("test", newBlockConn(), WithQueueSize(1), WithOverflowPolicy(OverflowBlock))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = ch.Push([]byte("x"))
+		}()
+	}
+	_ = ch.Close()
+	wg.Wait()
+	if err := ch.Push([]byte("x")); err == nil {
+		t.Error("push to a closed channel should fail")
+	}
+}
+
+// writeErrConn is a blockConn whose writes fail immediately
+type writeErrConn struct {
+	*blockConn
+}
+
+func (c writeErrConn) WriteFrame(OpCode, []byte) error {
+	return net.ErrClosed
+}
+
+// 写失败之后channel被关闭，Push立即返回ErrChannelClosed，Readloop退出
+func TestChannelWriteError(t *testing.T) {
+	conn := writeErrConn{newBlockConn()}
+	ch := NewChannel("test", conn)
+	readloop := make(chan error, 1)
+	go func() { readloop <- ch.Readloop(nil) }()
+
+	if err := ch.Push([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-conn.closed.Done():
+	case <-time.After(time.Second):
+		t.Fatal("channel is not closed after a write error")
+	}
+	if err := ch.Push([]byte("x")); err != ErrChannelClosed {
+		t.Fatalf("expect %v, got %v", ErrChannelClosed, err)
+	}
+	select {
+	case <-readloop:
+	case <-time.After(time.Second):
+		t.Fatal("readloop is not stopped")
+	}
+}
+
+// opConn is a Conn whose frames have only an opcode
+type opConn struct {
+	net.Conn
+}
+
+type opFrame OpCode
+
+func (f opFrame) SetOpCode(OpCode)   {}
+func (f opFrame) GetOpCode() OpCode  { return OpCode(f) }
+func (f opFrame) SetPayload([]byte)  {}
+func (f opFrame) GetPayload() []byte { return nil }
+
+func (c *opConn) ReadFrame() (Frame, error) {
+	b := make([]byte, 1)
+	if _, err := c.Read(b); err != nil {
+		return nil, err
+	}
+	return opFrame(b[0]), nil
+}
+
+func (c *opConn) WriteFrame(code OpCode, _ []byte) error {
+	_, err := c.Write([]byte{byte(code)})
+	return err
+}
+
+func (c *opConn) Flush() error { return nil }
+
+func TestChannelHeartbeat(t *testing.T) {
+	for _, answer := range []bool{true, false} {
+		srv, cli := net.Pipe()
+		ch := NewChannel("test", &opConn{srv}, WithHeartbeat(time.Millisecond*20, time.Millisecond*30))
+		ch.SetReadWait(time.Second * 10)
+
+		go func(answer bool) {
+			peer := &opConn{cli}
+			for {
+				f, err := peer.ReadFrame()
+				if err != nil {
+					return
+				}
+				if f.GetOpCode() == OpPing && answer {
+					_ = peer.WriteFrame(OpPong, nil)
+				}
+			}
+		}(answer)
+		done := make(chan error, 1)
+		go func() { done <- ch.Readloop(nil) }()
+
+		select {
+		case err := <-done:
+			if answer {
+				t.Fatalf("channel should be alive, got %v", err)
+			}
+		case <-time.After(time.Millisecond * 300):
+			if !answer {
+				t.Fatal("dead channel is not reaped")
+			}
+			if time.Since(ch.LastActive()) > time.Millisecond*100 {
+				t.Errorf("last active is not updated")
+			}
+		}
+		_ = ch.Close()
+		_ = cli.Close()
+	}
+}
@@ -1,44 +1,146 @@
 package im
 
 import (
+	"errors"
 	"im/logger"
 	"sync"
 )
 
+// ErrChannelExists channel id已经存在
+var ErrChannelExists = errors.New("channel is existed")
+
 type ChannelMap interface {
-	Add(channel Channel)
+	// Add 添加一个channel，id已经存在时返回ErrChannelExists
+	Add(channel Channel) error
+	// Replace 添加或者替换同id的channel，返回被替换的channel
+	Replace(channel Channel) (old Channel, replaced bool)
 	Remove(id string)
+	// RemoveChannel 只有id当前对应的就是这个channel时才移除，避免移除了替换后的新channel
+	RemoveChannel(channel Channel) bool
 	Get(id string) (Channel, bool)
 	All() []Channel
+	// Range 遍历所有channel，f返回false时停止
+	Range(f func(Channel) bool)
+	Len() int
+}
+
+// DefaultChannelShards 默认分片数量
+const DefaultChannelShards = 64
+
+// ChannelsOptions ChannelMap的选项
+type ChannelsOptions struct {
+	shards int
+}
+
+// ChannelsOption ChannelsOption
+type ChannelsOption func(opts *ChannelsOptions)
+
+// WithShards set number of shards, rounded up to a power of two
+func WithShards(n int) ChannelsOption {
+	return func(opts *ChannelsOptions) {
+		opts.shards = n
+	}
+}
+
+type channelShard struct {
+	sync.RWMutex
+	channels map[string]Channel
 }
 
 // ChannelsImpl ChannelMap
+//
+// channel按照id的hash分散到多个分片中，每个分片一把读写锁，减少大量连接时的锁竞争
 type ChannelsImpl struct {
-	// TODO: Optimization point
-	channels *sync.Map
+	shards []*channelShard
+	mask   uint32
 }
 
 // NewChannels NewChannels
-func NewChannels(num int) ChannelMap {
-	return &ChannelsImpl{
-		channels: new(sync.Map),
+//
+// num是预计的channel数量，只用于预分配每个分片的map，不是上限；
+// 分片数量默认是DefaultChannelShards，通过WithShards设置，向上取整到2的幂
+func NewChannels(num int, opts ...ChannelsOption) ChannelMap {
+	options := ChannelsOptions{shards: DefaultChannelShards}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	n := powerOfTwo(options.shards)
+	ch := &ChannelsImpl{
+		shards: make([]*channelShard, n),
+		mask:   uint32(n - 1),
+	}
+	for i := range ch.shards {
+		ch.shards[i] = &channelShard{
+			channels: make(map[string]Channel, num/n),
+		}
 	}
+	return ch
+}
+
+// powerOfTwo 不小于n的2的幂，最小是1
+func powerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// shard return the shard of id, fnv-1a
+func (ch *ChannelsImpl) shard(id string) *channelShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		hash ^= uint32(id[i])
+		hash *= 16777619
+	}
+	return ch.shards[hash&ch.mask]
 }
 
 // Add addChannel
-func (ch *ChannelsImpl) Add(channel Channel) {
+func (ch *ChannelsImpl) Add(channel Channel) error {
 	if channel.ID() == "" {
 		logger.WithFields(logger.Fields{
 			"module": "ChannelsImpl",
 		}).Error("channel id is required")
 	}
+	shard := ch.shard(channel.ID())
+	shard.Lock()
+	defer shard.Unlock()
+	if _, ok := shard.channels[channel.ID()]; ok {
+		return ErrChannelExists
+	}
+	shard.channels[channel.ID()] = channel
+	return nil
+}
 
-	ch.channels.Store(channel.ID(), channel)
+// Replace Replace
+func (ch *ChannelsImpl) Replace(channel Channel) (Channel, bool) {
+	shard := ch.shard(channel.ID())
+	shard.Lock()
+	defer shard.Unlock()
+	old, ok := shard.channels[channel.ID()]
+	shard.channels[channel.ID()] = channel
+	return old, ok
+}
+
+// RemoveChannel RemoveChannel
+func (ch *ChannelsImpl) RemoveChannel(channel Channel) bool {
+	shard := ch.shard(channel.ID())
+	shard.Lock()
+	defer shard.Unlock()
+	if cur, ok := shard.channels[channel.ID()]; !ok || cur != channel {
+		return false
+	}
+	delete(shard.channels, channel.ID())
+	return true
 }
 
 // Remove addChannel
 func (ch *ChannelsImpl) Remove(id string) {
-	ch.channels.Delete(id)
+	shard := ch.shard(id)
+	shard.Lock()
+	delete(shard.channels, id)
+	shard.Unlock()
 }
 
 // Get Get
@@ -48,20 +150,48 @@ func (ch *ChannelsImpl) Get(id string) (Channel, bool) {
 			"module": "ChannelsImpl",
 		}).Error("channel id is required")
 	}
-
-	val, ok := ch.channels.Load(id)
-	if !ok {
-		return nil, false
-	}
-	return val.(Channel), true
+	shard := ch.shard(id)
+	shard.RLock()
+	channel, ok := shard.channels[id]
+	shard.RUnlock()
+	return channel, ok
 }
 
 // All return channels
 func (ch *ChannelsImpl) All() []Channel {
-	arr := make([]Channel, 0)
-	ch.channels.Range(func(key, val interface{}) bool {
-		arr = append(arr, val.(Channel))
+	arr := make([]Channel, 0, ch.Len())
+	ch.Range(func(channel Channel) bool {
+		arr = append(arr, channel)
 		return true
 	})
 	return arr
 }
+
+// Range 逐个分片遍历；f在锁外调用，因此可以在f中调用Remove等方法
+func (ch *ChannelsImpl) Range(f func(Channel) bool) {
+	var buf []Channel
+	for _, shard := range ch.shards {
+		buf = buf[:0]
+		shard.RLock()
+		for _, channel := range shard.channels {
+			buf = append(buf, channel)
+		}
+		shard.RUnlock()
+		for _, channel := range buf {
+			if !f(channel) {
+				return
+			}
+		}
+	}
+}
+
+// Len return number of channels
+func (ch *ChannelsImpl) Len() int {
+	n := 0
+	for _, shard := range ch.shards {
+		shard.RLock()
+		n += len(shard.channels)
+		shard.RUnlock()
+	}
+	return n
+}
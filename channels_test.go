@@ -0,0 +1,189 @@
+package im
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type testChannel struct {
+	Channel
+	id string
+}
+
+func (c *testChannel) ID() string { return c.id }
+
+func TestChannelsAdd(t *testing.T) {
+	channels := NewChannels(10)
+	first := &testChannel{id: "ch1"}
+	if err := channels.Add(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := channels.Add(&testChannel{id: "ch1"}); err != ErrChannelExists {
+		t.Fatalf("expect ErrChannelExists, got %v", err)
+	}
+	if ch, ok := channels.Get("ch1"); !ok || ch != first {
+		t.Fatal("expect the first channel kept")
+	}
+
+	// 并发添加同一个id只有一个成功
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	added := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if channels.Add(&testChannel{id: "ch2"}) == nil {
+				lock.Lock()
+				added++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if added != 1 {
+		t.Fatalf("expect only one added, got %d", added)
+	}
+}
+
+func TestChannelsRange(t *testing.T) {
+	channels := NewChannels(1000)
+	for i := 0; i < 1000; i++ {
+		_ = channels.Add(&testChannel{id: strconv.Itoa(i)})
+	}
+	if channels.Len() != 1000 || len(channels.All()) != 1000 {
+		t.Fatalf("expect 1000 channels, got %d", channels.Len())
+	}
+	// 在Range中移除
+	channels.Range(func(ch Channel) bool {
+		channels.Remove(ch.ID())
+		return true
+	})
+	if channels.Len() != 0 {
+		t.Fatalf("expect all removed, got %d", channels.Len())
+	}
+
+	_ = channels.Add(&testChannel{id: "a"})
+	_ = channels.Add(&testChannel{id: "b"})
+	n := 0
+	channels.Range(func(ch Channel) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Fatalf("expect Range stopped, got %d", n)
+	}
+}
+
+const benchChannels = 1000000
+
+var (
+	benchOnce sync.Once
+	benchIDs  []string
+	benchMap  ChannelMap
+	benchSync *sync.Map
+	benchSeq  int64
+)
+
+// setup 1M channels in both the sharded map and a sync.Map for comparison
+func setupBench(b *testing.B) {
+	benchOnce.Do(func() {
+		benchIDs = make([]string, benchChannels)
+		benchMap = NewChannels(benchChannels)
+		benchSync = new(sync.Map)
+		for i := range benchIDs {
+			benchIDs[i] = "channel-" + strconv.Itoa(i)
+			ch := &testChannel{id: benchIDs[i]}
+			_ = benchMap.Add(ch)
+			benchSync.Store(ch.id, ch)
+		}
+	})
+	b.ResetTimer()
+}
+
+func BenchmarkChannelsGet(b *testing.B) {
+	setupBench(b)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			benchMap.Get(benchIDs[i%benchChannels])
+			i += 7
+		}
+	})
+}
+
+func BenchmarkSyncMapGet(b *testing.B) {
+	setupBench(b)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			benchSync.Load(benchIDs[i%benchChannels])
+			i += 7
+		}
+	})
+}
+
+func BenchmarkChannelsAddRemove(b *testing.B) {
+	setupBench(b)
+	b.RunParallel(func(pb *testing.PB) {
+		ch := &testChannel{id: "bench-" + strconv.FormatInt(atomic.AddInt64(&benchSeq, 1), 10)}
+		for pb.Next() {
+			_ = benchMap.Add(ch)
+			benchMap.Remove(ch.id)
+		}
+	})
+}
+
+func BenchmarkSyncMapAddRemove(b *testing.B) {
+	setupBench(b)
+	b.RunParallel(func(pb *testing.PB) {
+		ch := &testChannel{id: "bench-" + strconv.FormatInt(atomic.AddInt64(&benchSeq, 1), 10)}
+		for pb.Next() {
+			_, _ = benchSync.LoadOrStore(ch.id, ch)
+			benchSync.Delete(ch.id)
+		}
+	})
+}
+
+func BenchmarkChannelsRange(b *testing.B) {
+	setupBench(b)
+	for i := 0; i < b.N; i++ {
+		benchMap.Range(func(Channel) bool { return true })
+	}
+}
+
+func BenchmarkSyncMapRange(b *testing.B) {
+	setupBench(b)
+	for i := 0; i < b.N; i++ {
+		benchSync.Range(func(_, _ interface{}) bool { return true })
+	}
+}
+
+func BenchmarkChannelsLen(b *testing.B) {
+	setupBench(b)
+	for i := 0; i < b.N; i++ {
+		benchMap.Len()
+	}
+}
+
+func TestChannelsShards(t *testing.T) {
+	for _, c := range []struct{ shards, expect int }{
+		{0, 1}, {1, 1}, {3, 4}, {64, 64}, {100, 128},
+	} {
+		channels := NewChannels(10, WithShards(c.shards)).(*ChannelsImpl)
+		if len(channels.shards) != c.expect || int(channels.mask) != c.expect-1 {
+			t.Fatalf("shards %d: expect %d, got %d", c.shards, c.expect, len(channels.shards))
+		}
+		for i := 0; i < 100; i++ {
+			_ = channels.Add(&testChannel{id: strconv.Itoa(i)})
+		}
+		if channels.Len() != 100 {
+			t.Fatalf("shards %d: expect 100 channels, got %d", c.shards, channels.Len())
+		}
+	}
+	if n := len(NewChannels(10).(*ChannelsImpl).shards); n != DefaultChannelShards {
+		t.Fatalf("expect %d shards, got %d", DefaultChannelShards, n)
+	}
+}
@@ -0,0 +1,419 @@
+package im
+
+import (
+	"errors"
+	"fmt"
+	"im/logger"
+	"im/wire"
+	"im/wire/pkt"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errors
+var (
+	ErrClientConnected = errors.New("client has connected")
+	ErrConnectionNil   = errors.New("connection is nil")
+	ErrRemoteClosed    = errors.New("remote side close the channel")
+)
+
+// ClientOptions 客户端配置，各个传输层的客户端共用
+type ClientOptions struct {
+	Heartbeat    time.Duration    //心跳间隔，0表示不发送心跳
+	ReadWait     time.Duration    //读超时
+	WriteWait    time.Duration    //写超时
+	MaxFrameSize int              //最大帧长度
+	Reconnect    *ReconnectPolicy //断线重连策略，nil表示不重连
+	OnState      StateHandler     //连接状态变化的回调
+	// Upgrade 登录之前对连接的处理，通过DialerContext交给Dialer
+	Upgrade func(net.Conn) (net.Conn, error)
+	// Versions 在Upgrade之后通过hello与服务端协商包格式版本，为空时不协商，使用wire.Version0；
+	// 旧的服务端不认识hello，只有确定服务端支持时才能设置
+	Versions []wire.Version
+}
+
+// ConnWrapper 将Dialer返回的连接转换为Conn，由各个传输层实现
+type ConnWrapper func(rawconn net.Conn, opts ClientOptions) (Conn, error)
+
+// ClientImpl 客户端的通用实现：拨号握手、心跳、断线重连以及重发未收到响应的请求
+//
+// 传输层只需要提供ConnWrapper，读写都通过Conn完成
+type ClientImpl struct {
+	sync.Mutex
+	Dialer
+	id      string
+	name    string
+	module  string
+	addr    string
+	conn    Conn
+	wrap    ConnWrapper
+	state   int32
+	closed  *Event // 每次Connect重新创建，由锁保护
+	version uint32 // wire.Version, accessed atomically
+	unacked *Unacked
+	options ClientOptions
+	Meta    map[string]string
+}
+
+// NewClient 创建一个客户端，module用于日志
+func NewClient(id, name, module string, wrap ConnWrapper, opts ClientOptions) *ClientImpl {
+	if opts.WriteWait == 0 {
+		opts.WriteWait = DefaultWriteWait
+	}
+	if opts.ReadWait == 0 {
+		opts.ReadWait = DefaultReadWait
+	}
+	if opts.MaxFrameSize == 0 {
+		opts.MaxFrameSize = DefaultMaxFrameSize
+	}
+	cli := &ClientImpl{
+		id:      id,
+		name:    name,
+		module:  module,
+		wrap:    wrap,
+		options: opts,
+		closed:  NewEvent(),
+	}
+	if opts.Reconnect != nil && opts.Reconnect.Sequencer != nil {
+		cli.unacked = NewUnacked(opts.Reconnect.Sequencer, opts.Reconnect.MaxPending)
+	}
+	return cli
+}
+
+// ID return id
+func (c *ClientImpl) ID() string {
+	return c.id
+}
+
+// Name Name
+func (c *ClientImpl) Name() string {
+	return c.name
+}
+
+// ServiceID return id
+func (c *ClientImpl) ServiceID() string {
+	return c.id
+}
+
+// ServiceName ServiceName
+func (c *ClientImpl) ServiceName() string {
+	return c.name
+}
+
+// GetMeta GetMeta
+func (c *ClientImpl) GetMeta() map[string]string {
+	return c.Meta
+}
+
+// SetDialer 设置握手逻辑
+func (c *ClientImpl) SetDialer(dialer Dialer) {
+	c.Dialer = dialer
+}
+
+// State return state of the connection
+func (c *ClientImpl) State() ClientState {
+	return ClientState(atomic.LoadInt32(&c.state))
+}
+
+func (c *ClientImpl) setState(state ClientState) {
+	old := atomic.SwapInt32(&c.state, int32(state))
+	if old != int32(state) && c.options.OnState != nil {
+		c.options.OnState(state)
+	}
+}
+
+// done 返回当前连接的关闭事件
+func (c *ClientImpl) done() *Event {
+	c.Lock()
+	defer c.Unlock()
+	return c.closed
+}
+
+// Connect to server
+func (c *ClientImpl) Connect(addr string) error {
+	_, err := url.Parse(addr)
+	if err != nil {
+		return err
+	}
+	if !atomic.CompareAndSwapInt32(&c.state, int32(ClientClosed), int32(ClientConnecting)) {
+		return ErrClientConnected
+	}
+	if c.options.OnState != nil {
+		c.options.OnState(ClientConnecting)
+	}
+	closed := NewEvent()
+	c.Lock()
+	c.addr = addr
+	c.closed = closed
+	c.Unlock()
+
+	if err = c.dial(closed); err != nil {
+		c.setState(ClientClosed)
+		return err
+	}
+	c.setState(ClientConnected)
+	return nil
+}
+
+// dial 拨号握手，成功后启动心跳；closed触发时心跳停止
+func (c *ClientImpl) dial(closed *Event) error {
+	c.Lock()
+	addr := c.addr
+	c.Unlock()
+	atomic.StoreUint32(&c.version, uint32(wire.Version0))
+	rawconn, err := c.Dialer.DialAndHandshake(DialerContext{
+		Id:      c.id,
+		Name:    c.name,
+		Address: addr,
+		Timeout: DefaultLoginWait,
+		Upgrade: c.upgrade(),
+	})
+	if err != nil {
+		return err
+	}
+	if rawconn == nil {
+		return fmt.Errorf("conn is nil")
+	}
+	conn, err := c.wrap(rawconn, c.options)
+	if err != nil {
+		_ = rawconn.Close()
+		return err
+	}
+	c.Lock()
+	c.conn = conn
+	c.Unlock()
+
+	if c.options.Heartbeat > 0 {
+		go func() {
+			err := c.heartbealoop(conn, closed)
+			if err != nil {
+				logger.WithField("module", c.module).Warn("heartbealoop stopped - ", err)
+				// Read会返回错误，并触发重连
+				_ = conn.Close()
+			}
+		}()
+	}
+	return nil
+}
+
+// upgrade 在options.Upgrade之后完成版本协商，协商使用的Conn交给Dialer继续登录
+func (c *ClientImpl) upgrade() func(net.Conn) (net.Conn, error) {
+	next := c.options.Upgrade
+	if len(c.options.Versions) == 0 {
+		return next
+	}
+	return func(rawconn net.Conn) (net.Conn, error) {
+		var err error
+		if next != nil {
+			if rawconn, err = next(rawconn); err != nil {
+				return nil, err
+			}
+		}
+		conn, err := c.wrap(rawconn, c.options)
+		if err != nil {
+			return nil, err
+		}
+		version, err := ClientHello(conn, DefaultLoginWait, c.options.Versions...)
+		if err != nil {
+			return nil, err
+		}
+		atomic.StoreUint32(&c.version, uint32(version))
+		return conn, nil
+	}
+}
+
+// Version 与服务端协商的包格式版本
+func (c *ClientImpl) Version() wire.Version {
+	return wire.Version(atomic.LoadUint32(&c.version))
+}
+
+// SendPacket 按照协商的版本编码p之后发送
+func (c *ClientImpl) SendPacket(p *pkt.LogicPkt) error {
+	p.Version = c.Version()
+	return c.Send(pkt.Marshal(p))
+}
+
+// reconnect 连接断开后按照重连策略重新拨号，重连成功后重发未收到响应的请求
+func (c *ClientImpl) reconnect(cause error) error {
+	log := logger.WithFields(logger.Fields{
+		"module": c.module,
+		"id":     c.id,
+	})
+	c.Lock()
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	closed := c.closed
+	c.Unlock()
+
+	policy := c.options.Reconnect
+	if policy == nil || closed.HasFired() {
+		c.setState(ClientClosed)
+		return cause
+	}
+	log.Warn("connection lost - ", cause)
+	c.setState(ClientReconnecting)
+
+	for attempt := 1; policy.Retry(attempt); attempt++ {
+		select {
+		case <-time.After(policy.Backoff(attempt)):
+		case <-closed.Done():
+			return cause
+		}
+		err := c.dial(closed)
+		if err != nil {
+			log.Warnf("reconnect attempt %d failed - %v", attempt, err)
+			continue
+		}
+		if closed.HasFired() {
+			c.Close()
+			return cause
+		}
+		c.setState(ClientConnected)
+		log.Infof("reconnected after %d attempts", attempt)
+		c.resend()
+		return nil
+	}
+	c.setState(ClientClosed)
+	return cause
+}
+
+func (c *ClientImpl) resend() {
+	if c.unacked == nil {
+		return
+	}
+	for _, payload := range c.unacked.Pending() {
+		if err := c.write(OpBinary, payload); err != nil {
+			return
+		}
+	}
+}
+
+// Send data to connection
+//
+// 设置了Sequencer时，请求会在收到响应前被记录下来，重连成功后重发：
+// 断线期间Send返回nil；连接正常但写入失败时返回错误，请求同样会在重连后重发。
+func (c *ClientImpl) Send(payload []byte) error {
+	state := c.State()
+	if state == ClientClosed {
+		return ErrConnectionNil
+	}
+	if c.unacked != nil {
+		if dropped := c.unacked.Sent(payload); dropped > 0 {
+			logger.WithField("module", c.module).Warnf("%s drop %d unacked requests", c.id, dropped)
+		}
+		if state != ClientConnected {
+			return nil
+		}
+	}
+	return c.write(OpBinary, payload)
+}
+
+func (c *ClientImpl) write(code OpCode, payload []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.conn == nil {
+		return ErrConnectionNil
+	}
+	return c.writeTo(c.conn, code, payload)
+}
+
+// writeTo 写入一个帧并立即发送，调用者持有锁
+func (c *ClientImpl) writeTo(conn Conn, code OpCode, payload []byte) error {
+	err := conn.SetWriteDeadline(time.Now().Add(c.options.WriteWait))
+	if err != nil {
+		return err
+	}
+	if err = conn.WriteFrame(code, payload); err != nil {
+		return err
+	}
+	return conn.Flush()
+}
+
+// Close 关闭，关闭后可以再次调用Connect
+func (c *ClientImpl) Close() {
+	c.Lock()
+	c.closed.Fire()
+	conn := c.conn
+	c.conn = nil
+	c.Unlock()
+	if conn != nil {
+		// graceful close connection
+		_ = conn.WriteFrame(OpClose, nil)
+		_ = conn.Flush()
+		_ = conn.Close()
+	}
+	c.setState(ClientClosed)
+}
+
+// Read 读取一个帧；开启了重连时，连接断开后会在Read中重连
+func (c *ClientImpl) Read() (Frame, error) {
+	for {
+		c.Lock()
+		conn := c.conn
+		c.Unlock()
+		if conn == nil {
+			return nil, ErrConnectionNil
+		}
+		if c.options.Heartbeat > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(c.options.ReadWait))
+		}
+		frame, err := conn.ReadFrame()
+		if err != nil {
+			if err = c.reconnect(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// 服务端主动关闭时不重连
+		if frame.GetOpCode() == OpClose {
+			c.Close()
+			return nil, ErrRemoteClosed
+		}
+		// 服务端发送的ping直接回复pong
+		if frame.GetOpCode() == OpPing {
+			if err = c.pong(conn, frame.GetPayload()); err != nil {
+				if err = c.reconnect(err); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if c.unacked != nil {
+			c.unacked.Received(frame.GetPayload())
+		}
+		return frame, nil
+	}
+}
+
+func (c *ClientImpl) pong(conn Conn, payload []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	return c.writeTo(conn, OpPong, payload)
+}
+
+func (c *ClientImpl) heartbealoop(conn Conn, closed *Event) error {
+	tick := time.NewTicker(c.options.Heartbeat)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			// 发送一个ping的心跳包给服务端
+			if err := c.ping(conn); err != nil {
+				return err
+			}
+		case <-closed.Done():
+			return nil
+		}
+	}
+}
+
+func (c *ClientImpl) ping(conn Conn) error {
+	logger.WithField("module", c.module).Tracef("%s send ping to server", c.id)
+	c.Lock()
+	defer c.Unlock()
+	return c.writeTo(conn, OpPing, nil)
+}
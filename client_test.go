@@ -0,0 +1,69 @@
+package im
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+type pipeDialer struct{}
+
+func (pipeDialer) DialAndHandshake(DialerContext) (net.Conn, error) {
+	c1, _ := net.Pipe()
+	return c1, nil
+}
+
+var errWrite = errors.New("write failed")
+
+// failConn is a Conn whose writes always fail
+type failConn struct {
+	*blockConn
+}
+
+func (c failConn) WriteFrame(OpCode, []byte) error { return errWrite }
+
+// testSequencer payload[0] is the sequence, payload[1] is 0 for request and 1 for response
+type testSequencer struct{}
+
+func (testSequencer) Request(payload []byte) (uint32, bool) {
+	return uint32(payload[0]), payload[1] == 0
+}
+
+func (testSequencer) Response(payload []byte) (uint32, bool) {
+	return uint32(payload[0]), payload[1] == 1
+}
+
+func TestClientSendError(t *testing.T) {
+	wrap := func(rawconn net.Conn, _ ClientOptions) (Conn, error) {
+		return failConn{&blockConn{Conn: rawconn, closed: NewEvent()}}, nil
+	}
+	for _, policy := range []*ReconnectPolicy{nil, {Sequencer: testSequencer{}}} {
+		cli := NewClient("test", "test", "test", wrap, ClientOptions{Reconnect: policy})
+		cli.SetDialer(pipeDialer{})
+		if err := cli.Connect("tcp://127.0.0.1:1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := cli.Send([]byte{1, 0}); !errors.Is(err, errWrite) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		cli.Close()
+		if err := cli.Send([]byte{2, 0}); !errors.Is(err, ErrConnectionNil) {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+}
+
+func TestUnackedLimit(t *testing.T) {
+	u := NewUnacked(testSequencer{}, 2)
+	if dropped := u.Sent([]byte{1, 0}) + u.Sent([]byte{2, 0}); dropped != 0 {
+		t.Fatalf("unexpected dropped %d", dropped)
+	}
+	if dropped := u.Sent([]byte{3, 0}); dropped != 1 {
+		t.Fatalf("unexpected dropped %d", dropped)
+	}
+	u.Received([]byte{2, 1})
+	pending := u.Pending()
+	if len(pending) != 1 || pending[0][0] != 3 {
+		t.Fatalf("unexpected pending %v", pending)
+	}
+}
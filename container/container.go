@@ -1,9 +1,15 @@
 package container
 
 import (
+	"fmt"
 	"im"
+	"im/kcp"
 	"im/logger"
 	"im/naming"
+	"im/pipe"
+	"im/tcp"
+	"im/websocket"
+	"im/wire"
 	"sync"
 )
 
@@ -23,6 +29,7 @@ type Container struct {
 	srvclients map[string]ClientMap
 	selector   Selector
 	dialer     im.Dialer
+	dialers    map[wire.Protocol]im.Dialer
 	deps       map[string]struct{}
 }
 
@@ -39,3 +46,103 @@ var c = &Container{
 func Default() *Container {
 	return c
 }
+
+// SetDialer 设置连接依赖服务时的握手逻辑，没有通过SetProtocolDialer设置的协议都使用这个Dialer
+func (c *Container) SetDialer(dialer im.Dialer) {
+	c.Lock()
+	defer c.Unlock()
+	c.dialer = dialer
+}
+
+// SetProtocolDialer 设置连接指定协议的服务时使用的Dialer，不同的传输层需要不同的拨号方式
+func (c *Container) SetProtocolDialer(protocol wire.Protocol, dialer im.Dialer) {
+	c.Lock()
+	defer c.Unlock()
+	if c.dialers == nil {
+		c.dialers = make(map[wire.Protocol]im.Dialer)
+	}
+	c.dialers[protocol] = dialer
+}
+
+// getDialer 返回协议对应的Dialer
+func (c *Container) getDialer(protocol wire.Protocol) im.Dialer {
+	c.RLock()
+	defer c.RUnlock()
+	if dialer, ok := c.dialers[protocol]; ok {
+		return dialer
+	}
+	return c.dialer
+}
+
+// clientBuilders 按照服务注册的协议创建客户端
+var clientBuilders = map[wire.Protocol]func(id, name string) im.Client{
+	wire.ProtocolTCP: func(id, name string) im.Client {
+		return tcp.NewClient(id, name, tcp.ClientOptions{})
+	},
+	wire.ProtocolWebsocket: func(id, name string) im.Client {
+		return websocket.NewClient(id, name, websocket.ClientOptions{})
+	},
+	wire.ProtocolKCP: func(id, name string) im.Client {
+		return kcp.NewClient(id, name, tcp.ClientOptions{})
+	},
+	wire.ProtocolUnix: func(id, name string) im.Client {
+		return tcp.NewClient(id, name, tcp.ClientOptions{})
+	},
+	wire.ProtocolPipe: func(id, name string) im.Client {
+		return pipe.NewClient(id, name, tcp.ClientOptions{})
+	},
+}
+
+// BuildClient 根据服务注册的协议创建客户端，并连接到服务的DialURL
+func (c *Container) BuildClient(service naming.ServiceRegistration) (im.Client, error) {
+	protocol := wire.Protocol(service.GetProtocol())
+	build, ok := clientBuilders[protocol]
+	if !ok {
+		return nil, fmt.Errorf("unexpected service protocol: %s", service.GetProtocol())
+	}
+	dialer := c.getDialer(protocol)
+	if dialer == nil {
+		return nil, fmt.Errorf("dialer of %s is nil", protocol)
+	}
+	cli := build(service.ServiceID(), service.ServiceName())
+	cli.SetDialer(dialer)
+	if err := cli.Connect(service.DialURL()); err != nil {
+		return nil, err
+	}
+	return cli, nil
+}
+
+// Connect 连接依赖的服务，客户端按照服务名保存；同一个服务已有的客户端会被关闭
+func (c *Container) Connect(service naming.ServiceRegistration) (im.Client, error) {
+	cli, err := c.BuildClient(service)
+	if err != nil {
+		return nil, err
+	}
+	c.Lock()
+	if c.srvclients == nil {
+		c.srvclients = make(map[string]ClientMap)
+	}
+	clients, ok := c.srvclients[service.ServiceName()]
+	if !ok {
+		clients = NewClients(10)
+		c.srvclients[service.ServiceName()] = clients
+	}
+	c.Unlock()
+	if old, ok := clients.Get(service.ServiceID()); ok {
+		old.Close()
+	}
+	clients.Add(cli)
+	log.Infof("connected to service %s %s", service.ServiceID(), service.DialURL())
+	return cli, nil
+}
+
+// Client 返回已经连接的服务
+func (c *Container) Client(name, id string) (im.Client, bool) {
+	c.RLock()
+	clients, ok := c.srvclients[name]
+	c.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return clients.Get(id)
+}
@@ -0,0 +1,90 @@
+package container
+
+import (
+	"context"
+	"im"
+	"im/naming"
+	"im/pipe"
+	"im/wire"
+	"net"
+	"testing"
+	"time"
+)
+
+type pipeDialer struct{}
+
+func (pipeDialer) DialAndHandshake(ctx im.DialerContext) (net.Conn, error) {
+	return pipe.Dial(ctx.Address, ctx.Timeout)
+}
+
+type echoListener struct{}
+
+func (echoListener) Receive(agent im.Agent, payload []byte) {
+	_ = agent.Push(payload)
+}
+
+type nopStateListener struct{}
+
+func (nopStateListener) Disconnect(string) error { return nil }
+
+func TestConnect(t *testing.T) {
+	service := naming.NewEntry("chat-1", "chat", string(wire.ProtocolPipe), "container-chat", 0)
+	srv := pipe.NewServer("container-chat", service)
+	srv.SetMessageListener(echoListener{})
+	srv.SetStateListener(nopStateListener{})
+	go func() { _ = srv.Start() }()
+	defer func() { _ = srv.Shutdown(context.Background()) }()
+
+	c := &Container{}
+	if _, err := c.Connect(service); err == nil {
+		t.Fatal("expect an error without dialer")
+	}
+	if _, err := c.Connect(naming.NewEntry("x", "x", "quic", "x", 0)); err == nil {
+		t.Fatal("expect an error of unknown protocol")
+	}
+	c.SetProtocolDialer(wire.ProtocolPipe, pipeDialer{})
+
+	var (
+		cli im.Client
+		err error
+	)
+	for i := 0; i < 50; i++ {
+		if cli, err = c.Connect(service); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if got, ok := c.Client("chat", "chat-1"); !ok || got != cli {
+		t.Fatal("client is not saved")
+	}
+	if err = cli.Send([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := cli.Read()
+	if err != nil || string(frame.GetPayload()) != "hello" {
+		t.Fatalf("unexpected frame %v %v", frame, err)
+	}
+}
+
+// SetDialer与getDialer可以并发调用
+func TestSetDialer(t *testing.T) {
+	c := &Container{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.SetDialer(pipeDialer{})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = c.getDialer(wire.ProtocolTCP)
+	}
+	<-done
+	if c.getDialer(wire.ProtocolTCP) == nil {
+		t.Fatal("dialer is not set")
+	}
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
-	"IM/demo/client"
-	"IM/demo/server"
 	"context"
 	"flag"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"im/demo/client"
+	"im/demo/server"
 )
 
 func main() {
@@ -0,0 +1,255 @@
+package im
+
+import (
+	"errors"
+	"hash/crc32"
+	"sync"
+	"sync/atomic"
+)
+
+// errors
+var (
+	ErrDispatcherClosed = errors.New("dispatcher has closed")
+	ErrMailboxFull      = errors.New("dispatcher mailbox is full")
+)
+
+// Dispatcher 将Readloop读到的消息分发给MessageListener
+type Dispatcher interface {
+	Dispatch(lst MessageListener, agent Agent, payload []byte) error
+}
+
+// TryDispatcher 不阻塞的Dispatch，邮箱满时返回ErrMailboxFull
+//
+// EpollServer的读worker由所有连接共享，不能因为一个channel的邮箱满而阻塞
+type TryDispatcher interface {
+	TryDispatch(lst MessageListener, agent Agent, payload []byte) error
+}
+
+// goDispatcher 每条消息启动一个goroutine，不保证同一个channel的消息顺序
+type goDispatcher struct{}
+
+func (goDispatcher) Dispatch(lst MessageListener, agent Agent, payload []byte) error {
+	go lst.Receive(agent, payload)
+	return nil
+}
+
+func (d goDispatcher) TryDispatch(lst MessageListener, agent Agent, payload []byte) error {
+	return d.Dispatch(lst, agent, payload)
+}
+
+// DefaultDispatcher goroutine-per-message
+var DefaultDispatcher Dispatcher = goDispatcher{}
+
+// DispatcherStats 队列指标
+type DispatcherStats struct {
+	Workers    int
+	Pending    int64  // 排队中的消息数
+	Dispatched uint64 // 已交给MessageListener的消息数
+	Blocked    uint64 // 因邮箱满而阻塞的次数
+}
+
+type dispatchJob struct {
+	lst     MessageListener
+	payload []byte
+}
+
+// mailbox 一个channel待处理的消息，由所在分片的锁保护
+type mailbox struct {
+	id        string
+	agent     Agent
+	jobs      []dispatchJob
+	scheduled bool          // 是否已经在就绪队列中或者正在被处理
+	notFull   chan struct{} // 取走消息后通知阻塞的Dispatch
+}
+
+type dispatchShard struct {
+	sync.Mutex
+	boxes map[string]*mailbox
+}
+
+// ShardedDispatcher 每个channel一个有界邮箱的worker pool
+//
+// 有消息的channel进入就绪队列，同一时刻最多被一个worker处理，保证了消息顺序；
+// worker每处理一条消息就把channel放回队尾，不同channel之间轮转。
+// 邮箱满时Dispatch只阻塞这个channel的Readloop，不影响其它channel。
+// 邮箱按channel ID分片加锁，worker数量即全局并发上限。
+type ShardedDispatcher struct {
+	shards     []*dispatchShard
+	queueSize  int
+	readyLock  sync.Mutex
+	readyCond  *sync.Cond
+	ready      []*mailbox
+	closed     *Event
+	wg         sync.WaitGroup
+	pending    int64
+	dispatched uint64
+	blocked    uint64
+}
+
+// NewShardedDispatcher 创建workers个worker，每个channel最多排队queueSize条消息
+func NewShardedDispatcher(workers, queueSize int) *ShardedDispatcher {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+	d := &ShardedDispatcher{
+		shards:    make([]*dispatchShard, workers),
+		queueSize: queueSize,
+		closed:    NewEvent(),
+	}
+	d.readyCond = sync.NewCond(&d.readyLock)
+	for i := range d.shards {
+		d.shards[i] = &dispatchShard{boxes: make(map[string]*mailbox)}
+	}
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+func (d *ShardedDispatcher) shard(id string) *dispatchShard {
+	return d.shards[crc32.ChecksumIEEE([]byte(id))%uint32(len(d.shards))]
+}
+
+// schedule 将mailbox放入就绪队列的队尾
+func (d *ShardedDispatcher) schedule(mb *mailbox) {
+	d.readyLock.Lock()
+	d.ready = append(d.ready, mb)
+	d.readyLock.Unlock()
+	d.readyCond.Signal()
+}
+
+func (d *ShardedDispatcher) next() (*mailbox, bool) {
+	d.readyLock.Lock()
+	defer d.readyLock.Unlock()
+	for len(d.ready) == 0 {
+		if d.closed.HasFired() {
+			return nil, false
+		}
+		d.readyCond.Wait()
+	}
+	if d.closed.HasFired() {
+		return nil, false
+	}
+	mb := d.ready[0]
+	d.ready[0] = nil
+	d.ready = d.ready[1:]
+	return mb, true
+}
+
+func (d *ShardedDispatcher) work() {
+	defer d.wg.Done()
+	for {
+		mb, ok := d.next()
+		if !ok {
+			return
+		}
+		shard := d.shard(mb.id)
+
+		shard.Lock()
+		job := mb.jobs[0]
+		mb.jobs[0] = dispatchJob{}
+		mb.jobs = mb.jobs[1:]
+		shard.Unlock()
+		select {
+		case mb.notFull <- struct{}{}:
+		default:
+		}
+
+		atomic.AddInt64(&d.pending, -1)
+		atomic.AddUint64(&d.dispatched, 1)
+		job.lst.Receive(mb.agent, job.payload)
+
+		shard.Lock()
+		if len(mb.jobs) == 0 {
+			mb.scheduled = false
+			delete(shard.boxes, mb.id)
+			shard.Unlock()
+			continue
+		}
+		shard.Unlock()
+		d.schedule(mb)
+	}
+}
+
+// Dispatch 将消息放入channel的邮箱，邮箱满时阻塞直到有空位
+func (d *ShardedDispatcher) Dispatch(lst MessageListener, agent Agent, payload []byte) error {
+	job := dispatchJob{lst: lst, payload: payload}
+	for counted := false; ; {
+		mb, err := d.enqueue(agent, job)
+		if err != ErrMailboxFull {
+			return err
+		}
+		if !counted {
+			counted = true
+			atomic.AddUint64(&d.blocked, 1)
+		}
+		select {
+		case <-mb.notFull:
+		case <-d.closed.Done():
+			return ErrDispatcherClosed
+		}
+	}
+}
+
+// TryDispatch 将消息放入channel的邮箱，邮箱满时返回ErrMailboxFull
+func (d *ShardedDispatcher) TryDispatch(lst MessageListener, agent Agent, payload []byte) error {
+	_, err := d.enqueue(agent, dispatchJob{lst: lst, payload: payload})
+	return err
+}
+
+// enqueue 邮箱满时返回ErrMailboxFull以及这个邮箱
+func (d *ShardedDispatcher) enqueue(agent Agent, job dispatchJob) (*mailbox, error) {
+	if d.closed.HasFired() {
+		return nil, ErrDispatcherClosed
+	}
+	id := agent.ID()
+	shard := d.shard(id)
+	shard.Lock()
+	mb, ok := shard.boxes[id]
+	if !ok {
+		mb = &mailbox{id: id, agent: agent, notFull: make(chan struct{}, 1)}
+		shard.boxes[id] = mb
+	}
+	if len(mb.jobs) >= d.queueSize {
+		shard.Unlock()
+		return mb, ErrMailboxFull
+	}
+	mb.jobs = append(mb.jobs, job)
+	atomic.AddInt64(&d.pending, 1)
+	schedule := !mb.scheduled
+	mb.scheduled = true
+	shard.Unlock()
+	if schedule {
+		d.schedule(mb)
+	}
+	return mb, nil
+}
+
+// Stats return metrics of the queues
+func (d *ShardedDispatcher) Stats() DispatcherStats {
+	return DispatcherStats{
+		Workers:    len(d.shards),
+		Pending:    atomic.LoadInt64(&d.pending),
+		Dispatched: atomic.LoadUint64(&d.dispatched),
+		Blocked:    atomic.LoadUint64(&d.blocked),
+	}
+}
+
+// Close 停止所有worker，队列中未处理的消息会被丢弃
+func (d *ShardedDispatcher) Close() {
+	if d.closed.Fire() {
+		d.wakeup()
+		d.wg.Wait()
+	}
+}
+
+// wakeup 唤醒等待就绪队列的worker
+func (d *ShardedDispatcher) wakeup() {
+	d.readyLock.Lock()
+	d.readyCond.Broadcast()
+	d.readyLock.Unlock()
+}
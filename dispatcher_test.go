@@ -0,0 +1,123 @@
+package im
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testAgent string
+
+func (a testAgent) ID() string        { return string(a) }
+func (a testAgent) Push([]byte) error { return nil }
+
+type orderListener struct {
+	sync.Mutex
+	wg   sync.WaitGroup
+	recv map[string][]byte
+}
+
+func (l *orderListener) Receive(ag Agent, payload []byte) {
+	l.Lock()
+	l.recv[ag.ID()] = append(l.recv[ag.ID()], payload[0])
+	l.Unlock()
+	l.wg.Done()
+}
+
+func TestShardedDispatcherOrder(t *testing.T) {
+	d := NewShardedDispatcher(4, 2)
+	defer d.Close()
+
+	lst := &orderListener{recv: make(map[string][]byte)}
+	const channels, count = 10, 100
+	lst.wg.Add(channels * count)
+	for i := 0; i < count; i++ {
+		for c := 0; c < channels; c++ {
+			err := d.Dispatch(lst, testAgent(fmt.Sprintf("ch%d", c)), []byte{byte(i)})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	lst.wg.Wait()
+
+	for id, recv := range lst.recv {
+		for i, b := range recv {
+			if int(b) != i {
+				t.Fatalf("%s: message %d out of order", id, i)
+			}
+		}
+	}
+	stats := d.Stats()
+	if stats.Dispatched != channels*count || stats.Pending != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+type blockListener struct {
+	release chan struct{}
+	recv    chan string
+}
+
+func (l *blockListener) Receive(ag Agent, payload []byte) {
+	if ag.ID() == "slow" {
+		<-l.release
+	}
+	l.recv <- ag.ID()
+}
+
+func TestShardedDispatcherBackpressure(t *testing.T) {
+	d := NewShardedDispatcher(2, 1)
+	defer d.Close()
+
+	lst := &blockListener{release: make(chan struct{}), recv: make(chan string, 100)}
+	// 第一条被worker取走，第二条进入邮箱，第三条阻塞
+	blocked := make(chan error, 1)
+	for i := 0; i < 2; i++ {
+		if err := d.Dispatch(lst, testAgent("slow"), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.TryDispatch(lst, testAgent("slow"), []byte{2}); err != ErrMailboxFull {
+		t.Fatalf("unexpected error %v", err)
+	}
+	go func() {
+		blocked <- d.Dispatch(lst, testAgent("slow"), []byte{2})
+	}()
+
+	// 其它channel不受影响
+	for i := 0; i < 10; i++ {
+		if err := d.Dispatch(lst, testAgent("fast"), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		select {
+		case id := <-lst.recv:
+			if id != "fast" {
+				t.Fatalf("unexpected %s", id)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("fast channel is blocked by slow channel")
+		}
+	}
+	select {
+	case <-blocked:
+		t.Fatal("dispatch of a full mailbox should block")
+	default:
+	}
+
+	close(lst.release)
+	if err := <-blocked; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if id := <-lst.recv; id != "slow" {
+			t.Fatalf("unexpected %s", id)
+		}
+	}
+	if stats := d.Stats(); stats.Blocked == 0 || stats.Pending != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
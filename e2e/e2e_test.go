@@ -0,0 +1,110 @@
+package e2e
+
+import (
+	"errors"
+	"im/wire/pkt"
+	"strings"
+	"testing"
+)
+
+func identity(t *testing.T, account, device string) *Identity {
+	id, err := NewIdentity(account, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestSealOpen(t *testing.T) {
+	store := NewMemoryStore()
+	alice := identity(t, "alice", "phone")
+	bobPhone := identity(t, "bob", "phone")
+	bobPC := identity(t, "bob", "pc")
+	for _, id := range []*Identity{alice, bobPhone, bobPC} {
+		if err := Upload(store, id.Account, &pkt.KeyBundleUploadReq{Bundle: id.Bundle()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err := Fetch(store, &pkt.KeyBundleFetchReq{Accounts: []string{"bob"}})
+	if err != nil || len(resp.Bundles) != 2 {
+		t.Fatalf("unexpected bundles %v %v", resp, err)
+	}
+
+	req, err := Seal(alice, &pkt.MessageReq{Type: 1, Body: "hello", Extra: "x"}, resp.Bundles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Type != 1 || !IsEnvelope(req.Extra) || strings.Contains(req.Body, "hello") {
+		t.Fatalf("unexpected sealed message %v", req)
+	}
+	// 接收方的所有设备以及发送方自己都可以解密
+	for _, id := range []*Identity{bobPhone, bobPC, alice} {
+		got, err := Open(id, req.Body)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", id.Account, id.Device, err)
+		}
+		if got.Type != 1 || got.Body != "hello" || got.Extra != "x" {
+			t.Fatalf("unexpected message %v", got)
+		}
+	}
+	if _, err = Open(identity(t, "eve", "pc"), req.Body); !errors.Is(err, ErrNotRecipient) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// 使用其它设备的名字也无法解密
+	if _, err = Open(identity(t, "bob", "pc"), req.Body); err == nil {
+		t.Fatal("open with a wrong key")
+	}
+}
+
+func TestEnvelopeFanout(t *testing.T) {
+	alice := identity(t, "alice", "phone")
+	bobPhone := identity(t, "bob", "phone")
+	bobPC := identity(t, "bob", "pc")
+	req, err := Seal(alice, &pkt.MessageReq{Body: "hello"}, []*pkt.KeyBundle{bobPhone.Bundle(), bobPC.Bundle()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := DecodeEnvelope(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipients := Recipients(env)
+	if len(recipients["bob"]) != 2 || len(recipients["alice"]) != 1 {
+		t.Fatalf("unexpected recipients %v", recipients)
+	}
+	body, err := EncodeEnvelope(ForDevice(env, "bob", "pc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Open(bobPC, body); err != nil || got.Body != "hello" {
+		t.Fatalf("unexpected message %v %v", got, err)
+	}
+	if _, err = Open(bobPhone, body); !errors.Is(err, ErrNotRecipient) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// 篡改发送方
+	env.Sender = "mallory"
+	body, _ = EncodeEnvelope(env)
+	if _, err = Open(bobPC, body); err == nil {
+		t.Fatal("tampered envelope is opened")
+	}
+}
+
+func TestUploadValidation(t *testing.T) {
+	store := NewMemoryStore()
+	id := identity(t, "alice", "phone")
+	if err := Upload(store, "bob", &pkt.KeyBundleUploadReq{Bundle: id.Bundle()}); !errors.Is(err, ErrInvalidBundle) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	bundle := id.Bundle()
+	bundle.IdentityKey = bundle.IdentityKey[:8]
+	if err := Upload(store, "alice", &pkt.KeyBundleUploadReq{Bundle: bundle}); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	loaded, err := LoadIdentity(id.Account, id.Device, id.PrivateKey())
+	if err != nil || Fingerprint(loaded.PublicKey()) != Fingerprint(id.PublicKey()) {
+		t.Fatalf("unexpected identity %v", err)
+	}
+}
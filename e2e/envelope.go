@@ -0,0 +1,245 @@
+package e2e
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"google.golang.org/protobuf/proto"
+	"im/wire/pkt"
+	"io"
+)
+
+// EnvelopeVersion 当前的信封版本
+const EnvelopeVersion = 1
+
+// ExtraEnvelope MessageReq.Extra为这个值时Body是base64编码的信封，原始的Extra在加密的内容中
+const ExtraEnvelope = "e2e.v1"
+
+// MaxRecipients 一个信封最多可以加密给多少个设备
+var MaxRecipients = 64
+
+const infoSealedKey = "im e2e v1 sealed key"
+
+// Seal 使用随机的内容密钥加密req，再将内容密钥分别密封给bundles中的每个设备
+//
+// bundles一般是接收方所有设备的公钥；发送方自己的设备会自动加入，用于多端同步。
+// 返回的MessageReq保留Type，Body为信封，Extra为ExtraEnvelope。
+func Seal(sender *Identity, req *pkt.MessageReq, bundles []*pkt.KeyBundle) (*pkt.MessageReq, error) {
+	bundles = withSender(sender, bundles)
+	if len(bundles) == 0 {
+		return nil, ErrNoRecipient
+	}
+	if len(bundles) > MaxRecipients {
+		return nil, ErrTooManyRecipients
+	}
+	plaintext, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	contentKey := make([]byte, KeySize)
+	if _, err = io.ReadFull(rand.Reader, contentKey); err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	env := &pkt.Envelope{
+		Version:      EnvelopeVersion,
+		Sender:       sender.Account,
+		SenderDevice: sender.Device,
+		EphemeralKey: ephemeral.PublicKey().Bytes(),
+		Keys:         make([]*pkt.SealedKey, 0, len(bundles)),
+	}
+	for _, bundle := range bundles {
+		if err = ValidateBundle(bundle); err != nil {
+			return nil, err
+		}
+		sealed, err := sealKey(ephemeral, bundle, contentKey)
+		if err != nil {
+			return nil, err
+		}
+		env.Keys = append(env.Keys, &pkt.SealedKey{Account: bundle.Account, Device: bundle.Device, Key: sealed})
+	}
+	aead, err := newAEAD(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	env.Nonce = make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, env.Nonce); err != nil {
+		return nil, err
+	}
+	env.Ciphertext = aead.Seal(nil, env.Nonce, plaintext, envelopeAD(env))
+
+	body, err := EncodeEnvelope(env)
+	if err != nil {
+		return nil, err
+	}
+	return &pkt.MessageReq{Type: req.Type, Body: body, Extra: ExtraEnvelope}, nil
+}
+
+// Open 使用id的私钥解密信封，返回发送方原始的MessageReq
+func Open(id *Identity, body string) (*pkt.MessageReq, error) {
+	env, err := DecodeEnvelope(body)
+	if err != nil {
+		return nil, err
+	}
+	var sealed []byte
+	for _, k := range env.Keys {
+		if k.Account == id.Account && k.Device == id.Device {
+			sealed = k.Key
+			break
+		}
+	}
+	if sealed == nil {
+		return nil, ErrNotRecipient
+	}
+	contentKey, err := openKey(id, env.EphemeralKey, sealed)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, ErrUnsupportedEnvelope
+	}
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, envelopeAD(env))
+	if err != nil {
+		return nil, err
+	}
+	var req pkt.MessageReq
+	if err = proto.Unmarshal(plaintext, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// IsEnvelope 判断消息的Extra是否表示一个加密信封
+func IsEnvelope(extra string) bool {
+	return extra == ExtraEnvelope
+}
+
+// EncodeEnvelope 序列化信封并使用base64编码，放在MessageReq.Body中
+func EncodeEnvelope(env *pkt.Envelope) (string, error) {
+	b, err := proto.Marshal(env)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// DecodeEnvelope 解码信封，服务端只能读取明文的接收设备列表
+func DecodeEnvelope(body string) (*pkt.Envelope, error) {
+	b, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, ErrUnsupportedEnvelope
+	}
+	var env pkt.Envelope
+	if err = proto.Unmarshal(b, &env); err != nil {
+		return nil, ErrUnsupportedEnvelope
+	}
+	if env.Version != EnvelopeVersion {
+		return nil, ErrUnsupportedEnvelope
+	}
+	if len(env.Keys) == 0 {
+		return nil, ErrNoRecipient
+	}
+	if len(env.Keys) > MaxRecipients {
+		return nil, ErrTooManyRecipients
+	}
+	return &env, nil
+}
+
+// Recipients 服务端用于多端推送：按账号返回信封中的接收设备，不需要解密
+func Recipients(env *pkt.Envelope) map[string][]string {
+	devices := make(map[string][]string)
+	for _, k := range env.Keys {
+		devices[k.Account] = append(devices[k.Account], k.Device)
+	}
+	return devices
+}
+
+// ForDevice 只保留发给account下device的密钥，用于减少推送给每个设备的数据
+func ForDevice(env *pkt.Envelope, account, device string) *pkt.Envelope {
+	out := proto.Clone(env).(*pkt.Envelope)
+	out.Keys = out.Keys[:0]
+	for _, k := range env.Keys {
+		if k.Account == account && k.Device == device {
+			out.Keys = append(out.Keys, k)
+		}
+	}
+	return out
+}
+
+func withSender(sender *Identity, bundles []*pkt.KeyBundle) []*pkt.KeyBundle {
+	for _, b := range bundles {
+		if b.Account == sender.Account && b.Device == sender.Device {
+			return bundles
+		}
+	}
+	return append(bundles[:len(bundles):len(bundles)], sender.Bundle())
+}
+
+// sealKey 使用临时密钥与设备公钥协商出的密钥加密contentKey；每个设备的密钥都不同，所以nonce可以固定
+func sealKey(ephemeral *ecdh.PrivateKey, bundle *pkt.KeyBundle, contentKey []byte) ([]byte, error) {
+	pub, err := ecdh.X25519().NewPublicKey(bundle.IdentityKey)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	secret, err := ephemeral.ECDH(pub)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	aead, err := sealedKeyAEAD(secret, ephemeral.PublicKey().Bytes(), bundle.IdentityKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	return aead.Seal(nil, nonce, contentKey, []byte(bundle.Account+"/"+bundle.Device)), nil
+}
+
+func openKey(id *Identity, ephemeralKey, sealed []byte) ([]byte, error) {
+	pub, err := ecdh.X25519().NewPublicKey(ephemeralKey)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	secret, err := id.key.ECDH(pub)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	aead, err := sealedKeyAEAD(secret, ephemeralKey, id.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	return aead.Open(nil, nonce, sealed, []byte(id.Account+"/"+id.Device))
+}
+
+// sealedKeyAEAD 使用salt = ephemeral || recipient派生密钥，把密钥绑定到这一对公钥上
+func sealedKeyAEAD(secret, ephemeralKey, recipientKey []byte) (cipher.AEAD, error) {
+	salt := make([]byte, 0, len(ephemeralKey)+len(recipientKey))
+	salt = append(salt, ephemeralKey...)
+	salt = append(salt, recipientKey...)
+	return newAEAD(deriveKey(secret, salt, infoSealedKey))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// envelopeAD 内容的附加数据，绑定版本与发送方
+func envelopeAD(env *pkt.Envelope) []byte {
+	ad := []byte{byte(env.Version)}
+	ad = append(ad, env.Sender...)
+	ad = append(ad, '/')
+	ad = append(ad, env.SenderDevice...)
+	return append(ad, env.EphemeralKey...)
+}
@@ -0,0 +1,97 @@
+package e2e
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"im/wire/pkt"
+	"time"
+)
+
+// errors
+var (
+	ErrInvalidKey          = errors.New("e2e: invalid key")
+	ErrInvalidBundle       = errors.New("e2e: invalid key bundle")
+	ErrNoRecipient         = errors.New("e2e: no recipient")
+	ErrTooManyRecipients   = errors.New("e2e: too many recipients")
+	ErrNotRecipient        = errors.New("e2e: not a recipient of the envelope")
+	ErrUnsupportedEnvelope = errors.New("e2e: unsupported envelope")
+)
+
+// KeySize X25519公钥与私钥的长度
+const KeySize = 32
+
+// Identity 一个设备的身份密钥，私钥只保存在设备上
+type Identity struct {
+	Account string
+	Device  string
+	key     *ecdh.PrivateKey
+}
+
+// NewIdentity 为设备生成新的身份密钥
+func NewIdentity(account, device string) (*Identity, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{Account: account, Device: device, key: key}, nil
+}
+
+// LoadIdentity 从PrivateKey保存的私钥中恢复身份
+func LoadIdentity(account, device string, private []byte) (*Identity, error) {
+	key, err := ecdh.X25519().NewPrivateKey(private)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return &Identity{Account: account, Device: device, key: key}, nil
+}
+
+// PrivateKey 私钥，用于持久化
+func (id *Identity) PrivateKey() []byte {
+	return id.key.Bytes()
+}
+
+// PublicKey 公钥
+func (id *Identity) PublicKey() []byte {
+	return id.key.PublicKey().Bytes()
+}
+
+// Bundle 上传到服务端的公钥
+func (id *Identity) Bundle() *pkt.KeyBundle {
+	return &pkt.KeyBundle{
+		Account:     id.Account,
+		Device:      id.Device,
+		IdentityKey: id.PublicKey(),
+		CreatedAt:   time.Now().UnixMilli(),
+	}
+}
+
+// Fingerprint 公钥的指纹，用户可以通过其它途径比对，防止服务端替换公钥
+func Fingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:16])
+}
+
+// ValidateBundle 检查公钥格式
+func ValidateBundle(bundle *pkt.KeyBundle) error {
+	if bundle == nil || bundle.Account == "" || bundle.Device == "" {
+		return ErrInvalidBundle
+	}
+	if _, err := ecdh.X25519().NewPublicKey(bundle.IdentityKey); err != nil {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// deriveKey HKDF-SHA256，输出一个32字节的密钥
+func deriveKey(secret, salt []byte, info string) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(info))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
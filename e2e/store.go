@@ -0,0 +1,98 @@
+package e2e
+
+import (
+	"im/wire/pkt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaxDevices 一个账号最多保存多少个设备的公钥
+var MaxDevices = 16
+
+// KeyStore 服务端保存的设备公钥
+type KeyStore interface {
+	// Put 保存或者替换一个设备的公钥
+	Put(bundle *pkt.KeyBundle) error
+	// Get 返回accounts下所有设备的公钥
+	Get(accounts ...string) ([]*pkt.KeyBundle, error)
+}
+
+// Upload 处理CommandKeyBundleUpload，account是登录的账号，不能为其它账号上传公钥
+func Upload(store KeyStore, account string, req *pkt.KeyBundleUploadReq) error {
+	bundle := req.GetBundle()
+	if err := ValidateBundle(bundle); err != nil {
+		return err
+	}
+	if bundle.Account != account {
+		return ErrInvalidBundle
+	}
+	bundle.CreatedAt = time.Now().UnixMilli()
+	return store.Put(bundle)
+}
+
+// Fetch 处理CommandKeyBundleFetch
+func Fetch(store KeyStore, req *pkt.KeyBundleFetchReq) (*pkt.KeyBundleFetchResp, error) {
+	if len(req.GetAccounts()) == 0 {
+		return &pkt.KeyBundleFetchResp{}, nil
+	}
+	bundles, err := store.Get(req.GetAccounts()...)
+	if err != nil {
+		return nil, err
+	}
+	return &pkt.KeyBundleFetchResp{Bundles: bundles}, nil
+}
+
+// MemoryStore 保存在内存中的KeyStore
+type MemoryStore struct {
+	lock    sync.RWMutex
+	bundles map[string]map[string]*pkt.KeyBundle
+}
+
+// NewMemoryStore NewMemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{bundles: make(map[string]map[string]*pkt.KeyBundle)}
+}
+
+// Put 超过MaxDevices时替换最早的设备
+func (s *MemoryStore) Put(bundle *pkt.KeyBundle) error {
+	if err := ValidateBundle(bundle); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	devices, ok := s.bundles[bundle.Account]
+	if !ok {
+		devices = make(map[string]*pkt.KeyBundle)
+		s.bundles[bundle.Account] = devices
+	}
+	if _, ok = devices[bundle.Device]; !ok && len(devices) >= MaxDevices {
+		var oldest *pkt.KeyBundle
+		for _, b := range devices {
+			if oldest == nil || b.CreatedAt < oldest.CreatedAt {
+				oldest = b
+			}
+		}
+		delete(devices, oldest.Device)
+	}
+	devices[bundle.Device] = bundle
+	return nil
+}
+
+// Get 按照账号、设备排序返回
+func (s *MemoryStore) Get(accounts ...string) ([]*pkt.KeyBundle, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var list []*pkt.KeyBundle
+	for _, account := range accounts {
+		devices := s.bundles[account]
+		start := len(list)
+		for _, b := range devices {
+			list = append(list, b)
+		}
+		sort.Slice(list[start:], func(i, j int) bool {
+			return list[start+i].Device < list[start+j].Device
+		})
+	}
+	return list, nil
+}
@@ -0,0 +1,17 @@
+package im
+
+import "im/wire/pkt"
+
+// errors with a status, they can be converted to a response by pkt.NewErrorResp
+var (
+	ErrChannelNotFound = pkt.NewError(pkt.Status_SessionNotFound, "channel not found")
+	ErrChannelClosed   = pkt.NewError(pkt.Status_SessionClosed, "channel has closed")
+	ErrSessionNil      = pkt.NewError(pkt.Status_SessionNotFound, "session is nil")
+	ErrNoDestination   = pkt.NewError(pkt.Status_NoDestination, "dest is empty")
+)
+
+func init() {
+	pkt.RegisterErrorStatus(ErrKickout, pkt.Status_Kicked)
+	pkt.RegisterErrorStatus(ErrFrameTooLarge, pkt.Status_PacketTooLarge)
+	pkt.RegisterErrorStatus(ErrDeviceRequired, pkt.Status_Unauthorized)
+}
@@ -0,0 +1,53 @@
+package im
+
+import (
+	"im/logger"
+	"im/wire/pkt"
+)
+
+// PacketHandler 处理一个LogicPkt，返回的错误会通过pkt.NewErrorResp回复给发送方
+//
+// req.Body引用了收到的数据，需要保留时先复制
+type PacketHandler func(agent Agent, req *pkt.LogicPkt) error
+
+// packetListener 把PacketHandler适配成MessageListener
+type packetListener struct {
+	handler PacketHandler
+}
+
+// HandlePackets 返回一个MessageListener，解码收到的LogicPkt后交给handler处理
+//
+// 只有请求的错误会被转换成ErrorResp，状态由pkt.StatusOf决定，比如ErrChannelNotFound对应Status_SessionNotFound；
+// BasicPkt以及无法解码的数据被忽略
+func HandlePackets(handler PacketHandler) MessageListener {
+	return &packetListener{handler: handler}
+}
+
+// Receive implements MessageListener
+func (l *packetListener) Receive(agent Agent, payload []byte) {
+	log := logger.WithField("module", "im.handler")
+	if agent == nil {
+		log.Warn(ErrSessionNil)
+		return
+	}
+	p, err := pkt.Unmarshal(payload)
+	if err != nil {
+		log.Warnf("channel %s - %v", agent.ID(), err)
+		return
+	}
+	req, ok := p.(*pkt.LogicPkt)
+	if !ok {
+		return
+	}
+	err = l.handler(agent, req)
+	if err == nil {
+		return
+	}
+	log.Debugf("channel %s command %s - %v", agent.ID(), req.Command, err)
+	if req.Flag != pkt.Flag_Request {
+		return
+	}
+	if err = agent.Push(pkt.Marshal(pkt.NewErrorResp(req, err))); err != nil {
+		log.Warnf("channel %s - %v", agent.ID(), err)
+	}
+}
@@ -0,0 +1,59 @@
+package im
+
+import (
+	"errors"
+	"im/wire"
+	"im/wire/pkt"
+	"testing"
+)
+
+type pushAgent struct {
+	pushed [][]byte
+}
+
+func (a *pushAgent) ID() string { return "u1" }
+
+func (a *pushAgent) Push(payload []byte) error {
+	a.pushed = append(a.pushed, payload)
+	return nil
+}
+
+func TestHandlePackets(t *testing.T) {
+	listener := HandlePackets(func(agent Agent, req *pkt.LogicPkt) error {
+		if req.Command == wire.CommandChatUserTalk {
+			return nil
+		}
+		return ErrChannelNotFound
+	})
+	agent := new(pushAgent)
+	listener.Receive(agent, pkt.Marshal(pkt.New(wire.CommandChatUserTalk)))
+	if len(agent.pushed) != 0 {
+		t.Fatal("unexpected response")
+	}
+
+	req := pkt.New(wire.CommandChatGroupTalk, pkt.WithSeq(5))
+	listener.Receive(agent, pkt.Marshal(req))
+	if len(agent.pushed) != 1 {
+		t.Fatal("expect an error response")
+	}
+	p, err := pkt.Unmarshal(agent.pushed[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := p.(*pkt.LogicPkt)
+	if resp.Flag != pkt.Flag_Response || resp.Sequence != 5 || resp.Status != pkt.Status_SessionNotFound {
+		t.Fatalf("unexpected response %v", &resp.Header)
+	}
+	var e *pkt.Error
+	if err = resp.Err(); !errors.As(err, &e) || e.Message != ErrChannelNotFound.Error() {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// 推送消息的错误不回复
+	push := pkt.New(wire.CommandChatGroupTalk)
+	push.Flag = pkt.Flag_Push
+	listener.Receive(agent, pkt.Marshal(push))
+	if len(agent.pushed) != 1 {
+		t.Fatal("unexpected response to a push")
+	}
+}
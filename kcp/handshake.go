@@ -0,0 +1,144 @@
+package kcp
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+// 每个udp包的第一个字节是类型
+const (
+	packetHello    byte = 1 // [1][conv][client key] 客户端发起握手
+	packetHelloAck byte = 2 // [2][conv][server key] 服务端响应握手
+	packetData     byte = 3 // [3][kcp] 来自当前地址的数据
+	packetMigrate  byte = 4 // [4][counter][mac][kcp] 客户端从新的地址发送的数据
+)
+
+const (
+	keySize        = 32
+	helloSize      = 1 + 4 + keySize
+	macSize        = 16
+	migrateHdrSize = 1 + 8 + macSize
+	// handshakeTimeout Dial等待服务端响应握手的时间
+	handshakeTimeout = time.Second * 5
+	// helloInterval 没有收到响应时重发hello的间隔
+	helloInterval = time.Millisecond * 200
+)
+
+// ErrHandshakeTimeout 服务端没有响应握手
+var ErrHandshakeTimeout = errors.New("kcp: handshake timeout")
+
+func encodeHello(typ byte, conv uint32, key []byte) []byte {
+	b := make([]byte, helloSize)
+	b[0] = typ
+	binary.LittleEndian.PutUint32(b[1:], conv)
+	copy(b[5:], key)
+	return b
+}
+
+// migrateSecret 从握手的DH结果中派生切换地址时使用的密钥，只有握手双方知道
+func migrateSecret(shared []byte, conv uint32, clientKey, serverKey []byte) []byte {
+	h := hmac.New(sha256.New, shared)
+	h.Write([]byte("im kcp migrate"))
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], conv)
+	h.Write(b[:])
+	h.Write(clientKey)
+	h.Write(serverKey)
+	return h.Sum(nil)
+}
+
+func migrateMAC(secret []byte, counter []byte, data []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write(counter)
+	h.Write(data)
+	return h.Sum(nil)[:macSize]
+}
+
+// sealMigrate 追加migrate头，counter单调递增用于防止重放
+func sealMigrate(dst []byte, secret []byte, counter uint64, data []byte) []byte {
+	dst = append(dst, packetMigrate)
+	dst = binary.LittleEndian.AppendUint64(dst, counter)
+	dst = append(dst, migrateMAC(secret, dst[len(dst)-8:], data)...)
+	return append(dst, data...)
+}
+
+// openMigrate 校验migrate包，返回counter以及kcp数据
+func openMigrate(secret []byte, b []byte) (uint64, []byte, bool) {
+	if len(b) < migrateHdrSize+overhead || b[0] != packetMigrate {
+		return 0, nil, false
+	}
+	counter := b[1:9]
+	data := b[migrateHdrSize:]
+	if !hmac.Equal(b[9:migrateHdrSize], migrateMAC(secret, counter, data)) {
+		return 0, nil, false
+	}
+	return binary.LittleEndian.Uint64(counter), data, true
+}
+
+// serverHello 服务端处理hello，返回切换地址的密钥以及需要发送给客户端的响应
+func serverHello(hello []byte) (secret, ack []byte, err error) {
+	peer, err := ecdh.X25519().NewPublicKey(hello[5:helloSize])
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	shared, err := key.ECDH(peer)
+	if err != nil {
+		return nil, nil, err
+	}
+	conv := binary.LittleEndian.Uint32(hello[1:])
+	pub := key.PublicKey().Bytes()
+	return migrateSecret(shared, conv, hello[5:helloSize], pub), encodeHello(packetHelloAck, conv, pub), nil
+}
+
+// clientHello 客户端发送hello直到收到服务端的响应
+func clientHello(conn *net.UDPConn, raddr net.Addr, conv uint32) ([]byte, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	pub := key.PublicKey().Bytes()
+	hello := encodeHello(packetHello, conv, pub)
+	defer conn.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, mtuLimit)
+	deadline := time.Now().Add(handshakeTimeout)
+	for time.Now().Before(deadline) {
+		if _, err = conn.WriteTo(hello, raddr); err != nil {
+			return nil, err
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(helloInterval))
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			if n != helloSize || buf[0] != packetHelloAck || from.String() != raddr.String() ||
+				binary.LittleEndian.Uint32(buf[1:]) != conv {
+				continue
+			}
+			peer, err := ecdh.X25519().NewPublicKey(buf[5:n])
+			if err != nil {
+				return nil, err
+			}
+			shared, err := key.ECDH(peer)
+			if err != nil {
+				return nil, err
+			}
+			return migrateSecret(shared, conv, pub, buf[5:n]), nil
+		}
+	}
+	return nil, ErrHandshakeTimeout
+}
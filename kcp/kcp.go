@@ -0,0 +1,713 @@
+package kcp
+
+import (
+	"encoding/binary"
+)
+
+// KCP协议的常量，与ikcp.c保持一致
+const (
+	rtoNoDelay  = 30 // no delay min rto
+	rtoMin      = 100
+	rtoDef      = 200
+	rtoMax      = 60000
+	cmdPush     = 81 // cmd: push data
+	cmdAck      = 82 // cmd: ack
+	cmdWask     = 83 // cmd: window probe (ask)
+	cmdWins     = 84 // cmd: window size (tell)
+	askSend     = 1  // need to send cmdWask
+	askTell     = 2  // need to send cmdWins
+	wndSnd      = 32
+	wndRcv      = 128
+	mtuDef      = 1400
+	interval    = 100
+	overhead    = 24
+	deadLink    = 20
+	threshInit  = 2
+	threshMin   = 2
+	probeInit   = 7000   // 7 secs to probe window size
+	probeLimit  = 120000 // up to 120 secs to probe window
+	fastackLimt = 5
+)
+
+func timediff(later, earlier uint32) int32 {
+	return int32(later - earlier)
+}
+
+type segment struct {
+	conv     uint32
+	cmd      uint8
+	frg      uint8
+	wnd      uint16
+	ts       uint32
+	sn       uint32
+	una      uint32
+	rto      uint32
+	xmit     uint32
+	resendts uint32
+	fastack  uint32
+	data     []byte
+}
+
+// encode header of the segment to ptr
+func (seg *segment) encode(ptr []byte) []byte {
+	binary.LittleEndian.PutUint32(ptr, seg.conv)
+	ptr[4] = seg.cmd
+	ptr[5] = seg.frg
+	binary.LittleEndian.PutUint16(ptr[6:], seg.wnd)
+	binary.LittleEndian.PutUint32(ptr[8:], seg.ts)
+	binary.LittleEndian.PutUint32(ptr[12:], seg.sn)
+	binary.LittleEndian.PutUint32(ptr[16:], seg.una)
+	binary.LittleEndian.PutUint32(ptr[20:], uint32(len(seg.data)))
+	return ptr[overhead:]
+}
+
+type ackItem struct {
+	sn uint32
+	ts uint32
+}
+
+// kcpcb KCP控制块，移植自ikcp.c，不是并发安全的
+type kcpcb struct {
+	conv, mtu, mss, state               uint32
+	sndUna, sndNxt, rcvNxt              uint32
+	ssthresh                            uint32
+	rxRttval, rxSrtt                    int32
+	rxRto, rxMinrto                     uint32
+	sndWnd, rcvWnd, rmtWnd, cwnd, probe uint32
+	current, interval, tsFlush, xmit    uint32
+	nodelay, updated                    uint32
+	tsProbe, probeWait                  uint32
+	deadLink, incr                      uint32
+	fastresend                          int32
+	fastlimit                           int32
+	nocwnd, stream                      int32
+	sndQueue, rcvQueue, sndBuf, rcvBuf  []segment
+	acklist                             []ackItem
+	buffer                              []byte
+	output                              func(buf []byte)
+}
+
+// newKCP create a kcp control block, output is called with packets to send
+func newKCP(conv uint32, output func(buf []byte)) *kcpcb {
+	kcp := &kcpcb{
+		conv:      conv,
+		sndWnd:    wndSnd,
+		rcvWnd:    wndRcv,
+		rmtWnd:    wndRcv,
+		mtu:       mtuDef,
+		mss:       mtuDef - overhead,
+		rxRto:     rtoDef,
+		rxMinrto:  rtoMin,
+		interval:  interval,
+		tsFlush:   interval,
+		ssthresh:  threshInit,
+		fastlimit: fastackLimt,
+		deadLink:  deadLink,
+		output:    output,
+	}
+	kcp.buffer = make([]byte, kcp.mtu)
+	return kcp
+}
+
+// PeekSize 返回下一个完整消息的长度，没有时返回-1
+func (kcp *kcpcb) PeekSize() int {
+	if len(kcp.rcvQueue) == 0 {
+		return -1
+	}
+	seg := &kcp.rcvQueue[0]
+	if seg.frg == 0 {
+		return len(seg.data)
+	}
+	if len(kcp.rcvQueue) < int(seg.frg+1) {
+		return -1
+	}
+	length := 0
+	for k := range kcp.rcvQueue {
+		seg := &kcp.rcvQueue[k]
+		length += len(seg.data)
+		if seg.frg == 0 {
+			break
+		}
+	}
+	return length
+}
+
+// Recv 读取一个完整的消息到buffer中
+func (kcp *kcpcb) Recv(buffer []byte) int {
+	peeksize := kcp.PeekSize()
+	if peeksize < 0 {
+		return -1
+	}
+	if peeksize > len(buffer) {
+		return -2
+	}
+	fastRecover := len(kcp.rcvQueue) >= int(kcp.rcvWnd)
+
+	n, count := 0, 0
+	for k := range kcp.rcvQueue {
+		seg := &kcp.rcvQueue[k]
+		n += copy(buffer[n:], seg.data)
+		count++
+		if seg.frg == 0 {
+			break
+		}
+	}
+	kcp.rcvQueue = removeFront(kcp.rcvQueue, count)
+	kcp.moveToRcvQueue()
+
+	// 接收窗口重新打开时主动告知对方
+	if len(kcp.rcvQueue) < int(kcp.rcvWnd) && fastRecover {
+		kcp.probe |= askTell
+	}
+	return n
+}
+
+// Send 把数据放入发送队列
+func (kcp *kcpcb) Send(buffer []byte) int {
+	if len(buffer) == 0 {
+		return -1
+	}
+	// 流模式下先填满最后一个分片
+	if kcp.stream != 0 {
+		if n := len(kcp.sndQueue); n > 0 {
+			seg := &kcp.sndQueue[n-1]
+			if len(seg.data) < int(kcp.mss) {
+				capacity := int(kcp.mss) - len(seg.data)
+				extend := capacity
+				if len(buffer) < capacity {
+					extend = len(buffer)
+				}
+				seg.data = append(seg.data, buffer[:extend]...)
+				buffer = buffer[extend:]
+			}
+		}
+		if len(buffer) == 0 {
+			return 0
+		}
+	}
+
+	count := (len(buffer) + int(kcp.mss) - 1) / int(kcp.mss)
+	if count >= wndRcv {
+		return -2
+	}
+	for i := 0; i < count; i++ {
+		size := len(buffer)
+		if size > int(kcp.mss) {
+			size = int(kcp.mss)
+		}
+		seg := segment{data: make([]byte, size, kcp.mss)}
+		copy(seg.data, buffer[:size])
+		if kcp.stream == 0 {
+			seg.frg = uint8(count - i - 1)
+		}
+		kcp.sndQueue = append(kcp.sndQueue, seg)
+		buffer = buffer[size:]
+	}
+	return 0
+}
+
+func (kcp *kcpcb) updateAck(rtt int32) {
+	if kcp.rxSrtt == 0 {
+		kcp.rxSrtt = rtt
+		kcp.rxRttval = rtt / 2
+	} else {
+		delta := rtt - kcp.rxSrtt
+		if delta < 0 {
+			delta = -delta
+		}
+		kcp.rxRttval = (3*kcp.rxRttval + delta) / 4
+		kcp.rxSrtt = (7*kcp.rxSrtt + rtt) / 8
+		if kcp.rxSrtt < 1 {
+			kcp.rxSrtt = 1
+		}
+	}
+	rto := uint32(kcp.rxSrtt) + max32(kcp.interval, uint32(4*kcp.rxRttval))
+	kcp.rxRto = bound32(kcp.rxMinrto, rto, rtoMax)
+}
+
+func (kcp *kcpcb) shrinkBuf() {
+	if len(kcp.sndBuf) > 0 {
+		kcp.sndUna = kcp.sndBuf[0].sn
+	} else {
+		kcp.sndUna = kcp.sndNxt
+	}
+}
+
+func (kcp *kcpcb) parseAck(sn uint32) {
+	if timediff(sn, kcp.sndUna) < 0 || timediff(sn, kcp.sndNxt) >= 0 {
+		return
+	}
+	for k := range kcp.sndBuf {
+		seg := &kcp.sndBuf[k]
+		if sn == seg.sn {
+			kcp.sndBuf = append(kcp.sndBuf[:k], kcp.sndBuf[k+1:]...)
+			break
+		}
+		if timediff(sn, seg.sn) < 0 {
+			break
+		}
+	}
+}
+
+func (kcp *kcpcb) parseFastack(sn, ts uint32) {
+	if timediff(sn, kcp.sndUna) < 0 || timediff(sn, kcp.sndNxt) >= 0 {
+		return
+	}
+	for k := range kcp.sndBuf {
+		seg := &kcp.sndBuf[k]
+		if timediff(sn, seg.sn) < 0 {
+			break
+		} else if sn != seg.sn && timediff(ts, seg.ts) >= 0 {
+			seg.fastack++
+		}
+	}
+}
+
+func (kcp *kcpcb) parseUna(una uint32) {
+	count := 0
+	for k := range kcp.sndBuf {
+		if timediff(una, kcp.sndBuf[k].sn) > 0 {
+			count++
+		} else {
+			break
+		}
+	}
+	kcp.sndBuf = removeFront(kcp.sndBuf, count)
+}
+
+func (kcp *kcpcb) parseData(newseg segment) {
+	sn := newseg.sn
+	if timediff(sn, kcp.rcvNxt+kcp.rcvWnd) >= 0 || timediff(sn, kcp.rcvNxt) < 0 {
+		return
+	}
+	// 按照sn从后往前找到插入的位置，丢弃重复的分片
+	insert := len(kcp.rcvBuf)
+	for k := len(kcp.rcvBuf) - 1; k >= 0; k-- {
+		seg := &kcp.rcvBuf[k]
+		if seg.sn == sn {
+			return
+		}
+		if timediff(sn, seg.sn) > 0 {
+			break
+		}
+		insert = k
+	}
+	kcp.rcvBuf = append(kcp.rcvBuf, segment{})
+	copy(kcp.rcvBuf[insert+1:], kcp.rcvBuf[insert:])
+	kcp.rcvBuf[insert] = newseg
+	kcp.moveToRcvQueue()
+}
+
+// moveToRcvQueue 把连续的分片从rcvBuf移动到rcvQueue
+func (kcp *kcpcb) moveToRcvQueue() {
+	count := 0
+	for k := range kcp.rcvBuf {
+		seg := &kcp.rcvBuf[k]
+		if seg.sn != kcp.rcvNxt || len(kcp.rcvQueue)+count >= int(kcp.rcvWnd) {
+			break
+		}
+		kcp.rcvNxt++
+		count++
+	}
+	if count > 0 {
+		kcp.rcvQueue = append(kcp.rcvQueue, kcp.rcvBuf[:count]...)
+		kcp.rcvBuf = removeFront(kcp.rcvBuf, count)
+	}
+}
+
+// Input 处理收到的一个udp包
+func (kcp *kcpcb) Input(data []byte) int {
+	prevUna := kcp.sndUna
+	var maxack, latestTs uint32
+	flag := false
+
+	if len(data) < overhead {
+		return -1
+	}
+	for len(data) >= overhead {
+		conv := binary.LittleEndian.Uint32(data)
+		cmd := data[4]
+		frg := data[5]
+		wnd := binary.LittleEndian.Uint16(data[6:])
+		ts := binary.LittleEndian.Uint32(data[8:])
+		sn := binary.LittleEndian.Uint32(data[12:])
+		una := binary.LittleEndian.Uint32(data[16:])
+		length := binary.LittleEndian.Uint32(data[20:])
+		data = data[overhead:]
+
+		if conv != kcp.conv {
+			return -1
+		}
+		if uint32(len(data)) < length {
+			return -2
+		}
+		if cmd != cmdPush && cmd != cmdAck && cmd != cmdWask && cmd != cmdWins {
+			return -3
+		}
+
+		kcp.rmtWnd = uint32(wnd)
+		kcp.parseUna(una)
+		kcp.shrinkBuf()
+
+		switch cmd {
+		case cmdAck:
+			if rtt := timediff(kcp.current, ts); rtt >= 0 {
+				kcp.updateAck(rtt)
+			}
+			kcp.parseAck(sn)
+			kcp.shrinkBuf()
+			if !flag {
+				flag = true
+				maxack, latestTs = sn, ts
+			} else if timediff(sn, maxack) > 0 {
+				maxack, latestTs = sn, ts
+			}
+		case cmdPush:
+			if timediff(sn, kcp.rcvNxt+kcp.rcvWnd) < 0 {
+				kcp.acklist = append(kcp.acklist, ackItem{sn, ts})
+				if timediff(sn, kcp.rcvNxt) >= 0 {
+					seg := segment{
+						conv: conv,
+						cmd:  cmd,
+						frg:  frg,
+						wnd:  wnd,
+						ts:   ts,
+						sn:   sn,
+						una:  una,
+						data: make([]byte, length),
+					}
+					copy(seg.data, data[:length])
+					kcp.parseData(seg)
+				}
+			}
+		case cmdWask:
+			kcp.probe |= askTell
+		case cmdWins:
+			// do nothing
+		}
+		data = data[length:]
+	}
+
+	if flag {
+		kcp.parseFastack(maxack, latestTs)
+	}
+
+	// 拥塞控制：收到新的确认后增大拥塞窗口
+	if timediff(kcp.sndUna, prevUna) > 0 && kcp.cwnd < kcp.rmtWnd {
+		mss := kcp.mss
+		if kcp.cwnd < kcp.ssthresh {
+			kcp.cwnd++
+			kcp.incr += mss
+		} else {
+			if kcp.incr < mss {
+				kcp.incr = mss
+			}
+			kcp.incr += (mss*mss)/kcp.incr + (mss / 16)
+			if (kcp.cwnd+1)*mss <= kcp.incr {
+				kcp.cwnd++
+			}
+		}
+		if kcp.cwnd > kcp.rmtWnd {
+			kcp.cwnd = kcp.rmtWnd
+			kcp.incr = kcp.rmtWnd * mss
+		}
+	}
+	return 0
+}
+
+func (kcp *kcpcb) wndUnused() uint16 {
+	if len(kcp.rcvQueue) < int(kcp.rcvWnd) {
+		return uint16(int(kcp.rcvWnd) - len(kcp.rcvQueue))
+	}
+	return 0
+}
+
+// flush 发送ack、窗口探测以及需要发送或重传的数据
+func (kcp *kcpcb) flush() {
+	if kcp.updated == 0 {
+		return
+	}
+	current := kcp.current
+	buffer := kcp.buffer
+	ptr := buffer
+
+	// makeSpace 剩余空间不足时先发送缓冲区中的数据
+	makeSpace := func(space int) {
+		size := len(buffer) - len(ptr)
+		if size+space > int(kcp.mtu) {
+			kcp.output(buffer[:size])
+			ptr = buffer
+		}
+	}
+
+	seg := segment{
+		conv: kcp.conv,
+		cmd:  cmdAck,
+		wnd:  kcp.wndUnused(),
+		una:  kcp.rcvNxt,
+	}
+
+	// flush acknowledges
+	for _, ack := range kcp.acklist {
+		makeSpace(overhead)
+		seg.sn, seg.ts = ack.sn, ack.ts
+		ptr = seg.encode(ptr)
+	}
+	kcp.acklist = kcp.acklist[:0]
+
+	// probe window size (if remote window size equals zero)
+	if kcp.rmtWnd == 0 {
+		if kcp.probeWait == 0 {
+			kcp.probeWait = probeInit
+			kcp.tsProbe = current + kcp.probeWait
+		} else if timediff(current, kcp.tsProbe) >= 0 {
+			if kcp.probeWait < probeInit {
+				kcp.probeWait = probeInit
+			}
+			kcp.probeWait += kcp.probeWait / 2
+			if kcp.probeWait > probeLimit {
+				kcp.probeWait = probeLimit
+			}
+			kcp.tsProbe = current + kcp.probeWait
+			kcp.probe |= askSend
+		}
+	} else {
+		kcp.tsProbe = 0
+		kcp.probeWait = 0
+	}
+
+	seg.sn, seg.ts = 0, 0
+	if kcp.probe&askSend != 0 {
+		seg.cmd = cmdWask
+		makeSpace(overhead)
+		ptr = seg.encode(ptr)
+	}
+	if kcp.probe&askTell != 0 {
+		seg.cmd = cmdWins
+		makeSpace(overhead)
+		ptr = seg.encode(ptr)
+	}
+	kcp.probe = 0
+
+	// calculate window size
+	cwnd := min32(kcp.sndWnd, kcp.rmtWnd)
+	if kcp.nocwnd == 0 {
+		cwnd = min32(kcp.cwnd, cwnd)
+	}
+
+	// move data from sndQueue to sndBuf
+	count := 0
+	for k := range kcp.sndQueue {
+		if timediff(kcp.sndNxt, kcp.sndUna+cwnd) >= 0 {
+			break
+		}
+		newseg := kcp.sndQueue[k]
+		newseg.conv = kcp.conv
+		newseg.cmd = cmdPush
+		newseg.sn = kcp.sndNxt
+		kcp.sndBuf = append(kcp.sndBuf, newseg)
+		kcp.sndNxt++
+		count++
+	}
+	kcp.sndQueue = removeFront(kcp.sndQueue, count)
+
+	// calculate resent
+	resent := uint32(kcp.fastresend)
+	if kcp.fastresend <= 0 {
+		resent = 0xffffffff
+	}
+	var rtomin uint32
+	if kcp.nodelay == 0 {
+		rtomin = kcp.rxRto >> 3
+	}
+
+	// flush data segments
+	change, lost := false, false
+	for k := range kcp.sndBuf {
+		sseg := &kcp.sndBuf[k]
+		needsend := false
+		if sseg.xmit == 0 {
+			needsend = true
+			sseg.rto = kcp.rxRto
+			sseg.resendts = current + sseg.rto + rtomin
+		} else if timediff(current, sseg.resendts) >= 0 {
+			needsend = true
+			kcp.xmit++
+			if kcp.nodelay == 0 {
+				sseg.rto += max32(sseg.rto, kcp.rxRto)
+			} else if kcp.nodelay < 2 {
+				sseg.rto += sseg.rto / 2
+			} else {
+				sseg.rto += kcp.rxRto / 2
+			}
+			sseg.resendts = current + sseg.rto
+			lost = true
+		} else if sseg.fastack >= resent {
+			if sseg.xmit <= uint32(kcp.fastlimit) || kcp.fastlimit <= 0 {
+				needsend = true
+				sseg.fastack = 0
+				sseg.resendts = current + sseg.rto
+				change = true
+			}
+		}
+
+		if needsend {
+			sseg.xmit++
+			sseg.ts = current
+			sseg.wnd = seg.wnd
+			sseg.una = kcp.rcvNxt
+
+			makeSpace(overhead + len(sseg.data))
+			ptr = sseg.encode(ptr)
+			ptr = ptr[copy(ptr, sseg.data):]
+
+			if sseg.xmit >= kcp.deadLink {
+				kcp.state = 0xFFFFFFFF
+			}
+		}
+	}
+
+	// flash remain segments
+	if size := len(buffer) - len(ptr); size > 0 {
+		kcp.output(buffer[:size])
+	}
+
+	// update ssthresh
+	if change {
+		inflight := kcp.sndNxt - kcp.sndUna
+		kcp.ssthresh = inflight / 2
+		if kcp.ssthresh < threshMin {
+			kcp.ssthresh = threshMin
+		}
+		kcp.cwnd = kcp.ssthresh + resent
+		kcp.incr = kcp.cwnd * kcp.mss
+	}
+	if lost {
+		kcp.ssthresh = cwnd / 2
+		if kcp.ssthresh < threshMin {
+			kcp.ssthresh = threshMin
+		}
+		kcp.cwnd = 1
+		kcp.incr = kcp.mss
+	}
+	if kcp.cwnd < 1 {
+		kcp.cwnd = 1
+		kcp.incr = kcp.mss
+	}
+}
+
+// Update 需要以interval为间隔反复调用，current为毫秒时间戳
+func (kcp *kcpcb) Update(current uint32) {
+	kcp.current = current
+	if kcp.updated == 0 {
+		kcp.updated = 1
+		kcp.tsFlush = current
+	}
+	slap := timediff(current, kcp.tsFlush)
+	if slap >= 10000 || slap < -10000 {
+		kcp.tsFlush = current
+		slap = 0
+	}
+	if slap >= 0 {
+		kcp.tsFlush += kcp.interval
+		if timediff(current, kcp.tsFlush) >= 0 {
+			kcp.tsFlush = current + kcp.interval
+		}
+		kcp.flush()
+	}
+}
+
+// Check 返回下一次需要调用Update的时间，期间没有Input与Send时不需要调用Update
+func (kcp *kcpcb) Check(current uint32) uint32 {
+	if kcp.updated == 0 {
+		return current
+	}
+	tsFlush := kcp.tsFlush
+	if slap := timediff(current, tsFlush); slap >= 10000 || slap < -10000 {
+		tsFlush = current
+	}
+	if timediff(current, tsFlush) >= 0 {
+		return current
+	}
+	tmFlush := timediff(tsFlush, current)
+	tmPacket := int32(0x7fffffff)
+	for i := range kcp.sndBuf {
+		diff := timediff(kcp.sndBuf[i].resendts, current)
+		if diff <= 0 {
+			return current
+		}
+		if diff < tmPacket {
+			tmPacket = diff
+		}
+	}
+	minimal := uint32(tmFlush)
+	if tmPacket < tmFlush {
+		minimal = uint32(tmPacket)
+	}
+	if minimal >= kcp.interval {
+		minimal = kcp.interval
+	}
+	return current + minimal
+}
+
+// NoDelay fastest: NoDelay(1, 10, 2, 1)
+func (kcp *kcpcb) NoDelay(nodelay, interval, resend, nc int) {
+	kcp.nodelay = uint32(nodelay)
+	if nodelay != 0 {
+		kcp.rxMinrto = rtoNoDelay
+	} else {
+		kcp.rxMinrto = rtoMin
+	}
+	if interval < 10 {
+		interval = 10
+	} else if interval > 5000 {
+		interval = 5000
+	}
+	kcp.interval = uint32(interval)
+	kcp.fastresend = int32(resend)
+	kcp.nocwnd = int32(nc)
+}
+
+// WndSize set maximum window size
+func (kcp *kcpcb) WndSize(sndwnd, rcvwnd int) {
+	if sndwnd > 0 {
+		kcp.sndWnd = uint32(sndwnd)
+	}
+	if rcvwnd > 0 {
+		kcp.rcvWnd = max32(uint32(rcvwnd), wndRcv)
+	}
+}
+
+// WaitSnd 等待发送的分片数
+func (kcp *kcpcb) WaitSnd() int {
+	return len(kcp.sndBuf) + len(kcp.sndQueue)
+}
+
+func removeFront(q []segment, n int) []segment {
+	if n == 0 {
+		return q
+	}
+	newn := copy(q, q[n:])
+	for i := newn; i < len(q); i++ {
+		q[i] = segment{} // release data
+	}
+	return q[:newn]
+}
+
+func min32(a, b uint32) uint32 {
+	if a <= b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b uint32) uint32 {
+	if a >= b {
+		return a
+	}
+	return b
+}
+
+func bound32(lower, middle, upper uint32) uint32 {
+	return min32(max32(lower, middle), upper)
+}
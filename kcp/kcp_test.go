@@ -0,0 +1,321 @@
+package kcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+// lossyLink 按照丢包率转发kcp的输出
+type lossyLink struct {
+	rnd     *rand.Rand
+	loss    float64
+	packets [][]byte
+}
+
+func (l *lossyLink) output(buf []byte) {
+	if l.rnd.Float64() < l.loss {
+		return
+	}
+	l.packets = append(l.packets, append([]byte(nil), buf...))
+}
+
+func (l *lossyLink) deliver(kcp *kcpcb) {
+	// 打乱顺序模拟乱序到达
+	l.rnd.Shuffle(len(l.packets), func(i, j int) {
+		l.packets[i], l.packets[j] = l.packets[j], l.packets[i]
+	})
+	for _, p := range l.packets {
+		kcp.Input(p)
+	}
+	l.packets = l.packets[:0]
+}
+
+func TestKCPLossyLink(t *testing.T) {
+	for _, stream := range []int32{0, 1} {
+		rnd := rand.New(rand.NewSource(1))
+		ab := &lossyLink{rnd: rnd, loss: 0.3}
+		ba := &lossyLink{rnd: rnd, loss: 0.3}
+		a := newKCP(1, ab.output)
+		b := newKCP(1, ba.output)
+		for _, k := range []*kcpcb{a, b} {
+			k.stream = stream
+			k.NoDelay(1, 10, 2, 1)
+		}
+
+		var sent, received bytes.Buffer
+		buf := make([]byte, 64<<10)
+		for i := 0; i < 200; i++ {
+			msg := bytes.Repeat([]byte{byte(i)}, rnd.Intn(3000)+1)
+			sent.Write(msg)
+			if a.Send(msg) < 0 {
+				t.Fatal("send failed")
+			}
+		}
+		for current := uint32(0); current < 60000 && received.Len() < sent.Len(); current += 10 {
+			a.Update(current)
+			b.Update(current)
+			ab.deliver(b)
+			ba.deliver(a)
+			for {
+				n := b.Recv(buf)
+				if n < 0 {
+					break
+				}
+				received.Write(buf[:n])
+			}
+		}
+		if !bytes.Equal(sent.Bytes(), received.Bytes()) {
+			t.Fatalf("stream %d: expect %d bytes in order, got %d", stream, sent.Len(), received.Len())
+		}
+	}
+}
+
+func echo(t *testing.T) *Listener {
+	lst, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := lst.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	}()
+	return lst.(*Listener)
+}
+
+func TestSessionEcho(t *testing.T) {
+	lst := echo(t)
+	defer lst.Close()
+
+	conn, err := Dial("kcp://" + lst.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 10))
+
+	payload := make([]byte, 256<<10)
+	rand.Read(payload)
+	go func() {
+		_, _ = conn.Write(payload)
+	}()
+	got := make([]byte, len(payload))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatal("unexpected echo")
+	}
+}
+
+// 客户端切换到新的地址之后，服务端按照conv找到原来的会话
+func TestSessionMigrate(t *testing.T) {
+	lst := echo(t)
+	defer lst.Close()
+
+	conn, err := Dial(lst.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	buf := make([]byte, 5)
+	if _, err = conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = conn.Rebind(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadFull(conn, buf); err != nil || string(buf) != "world" {
+		t.Fatalf("unexpected echo %q %v", buf, err)
+	}
+}
+
+// 只知道conv的第三方不能把会话的数据重定向到自己的地址
+func TestSessionSpoof(t *testing.T) {
+	lst := echo(t)
+	defer lst.Close()
+
+	conn, err := Dial(lst.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	if _, err = conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	s := conn.(*session)
+	srv := lst.session(s.kcp.conv)
+
+	attacker, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer attacker.Close()
+	seg := make([]byte, overhead)
+	binary.LittleEndian.PutUint32(seg, s.kcp.conv)
+	seg[4] = cmdWask
+	forged := sealMigrate(nil, make([]byte, 32), 1<<40, seg)
+	for _, p := range [][]byte{append([]byte{packetData}, seg...), forged} {
+		if _, err = attacker.WriteTo(p, lst.Addr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = attacker.SetReadDeadline(time.Now().Add(time.Millisecond * 300))
+	if _, _, err = attacker.ReadFrom(make([]byte, mtuLimit)); err == nil {
+		t.Fatal("attacker received data")
+	}
+	if srv.RemoteAddr().(*net.UDPAddr).Port != conn.LocalAddr().(*net.UDPAddr).Port {
+		t.Fatalf("remote changed to %v", srv.RemoteAddr())
+	}
+
+	if _, err = conn.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadFull(conn, buf); err != nil || string(buf) != "world" {
+		t.Fatalf("unexpected echo %q %v", buf, err)
+	}
+}
+
+// refSegment ikcp.c中ikcp_encode_seg的格式，小端：
+//
+//	conv(4) cmd(1) frg(1) wnd(2) ts(4) sn(4) una(4) len(4) data
+type refSegment struct {
+	conv    uint32
+	cmd     byte
+	frg     byte
+	wnd     uint16
+	ts      uint32
+	sn, una uint32
+	data    []byte
+}
+
+func (seg refSegment) bytes() []byte {
+	b := make([]byte, 24, 24+len(seg.data))
+	binary.LittleEndian.PutUint32(b[0:], seg.conv)
+	b[4] = seg.cmd
+	b[5] = seg.frg
+	binary.LittleEndian.PutUint16(b[6:], seg.wnd)
+	binary.LittleEndian.PutUint32(b[8:], seg.ts)
+	binary.LittleEndian.PutUint32(b[12:], seg.sn)
+	binary.LittleEndian.PutUint32(b[16:], seg.una)
+	binary.LittleEndian.PutUint32(b[20:], uint32(len(seg.data)))
+	return append(b, seg.data...)
+}
+
+func parseRefSegments(t *testing.T, b []byte) []refSegment {
+	var segs []refSegment
+	for len(b) > 0 {
+		if len(b) < 24 {
+			t.Fatalf("truncated segment header %x", b)
+		}
+		seg := refSegment{
+			conv: binary.LittleEndian.Uint32(b[0:]),
+			cmd:  b[4],
+			frg:  b[5],
+			wnd:  binary.LittleEndian.Uint16(b[6:]),
+			ts:   binary.LittleEndian.Uint32(b[8:]),
+			sn:   binary.LittleEndian.Uint32(b[12:]),
+			una:  binary.LittleEndian.Uint32(b[16:]),
+		}
+		size := int(binary.LittleEndian.Uint32(b[20:]))
+		if len(b) < 24+size {
+			t.Fatalf("segment length %d over the packet", size)
+		}
+		seg.data = b[24 : 24+size]
+		b = b[24+size:]
+		segs = append(segs, seg)
+	}
+	return segs
+}
+
+// 按照ikcp.c的报文格式手工收发分片，检查会话的线上格式与确认语义
+func TestSessionWireFormat(t *testing.T) {
+	lst := echo(t)
+	defer lst.Close()
+
+	peer, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	const conv = 0x01020304
+	if _, err = clientHello(peer, lst.Addr(), conv); err != nil {
+		t.Fatal(err)
+	}
+	send := func(segs ...refSegment) {
+		b := []byte{packetData}
+		for _, seg := range segs {
+			b = append(b, seg.bytes()...)
+		}
+		if _, err := peer.WriteTo(b, lst.Addr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 乱序到达的两个分片，kcp需要按照sn重组
+	send(refSegment{conv: conv, cmd: cmdPush, wnd: 128, ts: 100, sn: 1, data: []byte("world")})
+	send(refSegment{conv: conv, cmd: cmdPush, wnd: 128, ts: 101, sn: 0, data: []byte("hello ")})
+
+	acked := make(map[uint32]uint32) // sn -> ts
+	var una uint32
+	var echoed []byte
+	var rcvNxt uint32
+	buf := make([]byte, mtuLimit)
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second * 5))
+	for string(echoed) != "hello world" || len(acked) < 2 {
+		n, _, err := peer.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("acked %v, echoed %q: %v", acked, echoed, err)
+		}
+		if buf[0] != packetData {
+			t.Fatalf("unexpected packet type %d", buf[0])
+		}
+		for _, seg := range parseRefSegments(t, buf[1:n]) {
+			if seg.conv != conv || seg.wnd == 0 {
+				t.Fatalf("unexpected segment header %+v", seg)
+			}
+			if seg.una > una {
+				una = seg.una
+			}
+			switch seg.cmd {
+			case cmdAck:
+				acked[seg.sn] = seg.ts
+			case cmdPush:
+				// 流模式下frg总是0
+				if seg.frg != 0 {
+					t.Fatalf("unexpected frg %d", seg.frg)
+				}
+				if seg.sn == rcvNxt {
+					echoed = append(echoed, seg.data...)
+					rcvNxt++
+				}
+				send(refSegment{conv: conv, cmd: cmdAck, wnd: 128, ts: seg.ts, sn: seg.sn, una: rcvNxt})
+			}
+		}
+	}
+	// ack带回分片的ts用于计算rtt，una是下一个期望收到的sn
+	if acked[0] != 101 || acked[1] != 100 || una != 2 {
+		t.Fatalf("unexpected ack %v una %d", acked, una)
+	}
+}
@@ -0,0 +1,150 @@
+package kcp
+
+import (
+	"encoding/binary"
+	"im/logger"
+	"net"
+	"sync"
+)
+
+// acceptBacklog 等待Accept的会话数，超过时丢弃新的会话
+const acceptBacklog = 128
+
+// Listener 在一个udp socket上按照conv区分会话，实现了net.Listener
+type Listener struct {
+	conn     net.PacketConn
+	lock     sync.Mutex
+	sessions map[uint32]*session
+	accepts  chan *session
+	die      chan struct{}
+	once     sync.Once
+}
+
+// Listen 监听udp地址
+func Listen(address string) (net.Listener, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	l := &Listener{
+		conn:     conn,
+		sessions: make(map[uint32]*session),
+		accepts:  make(chan *session, acceptBacklog),
+		die:      make(chan struct{}),
+	}
+	go l.monitor()
+	return l, nil
+}
+
+func (l *Listener) monitor() {
+	buf := make([]byte, mtuLimit)
+	for {
+		n, from, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-l.die:
+			default:
+				logger.WithField("module", "kcp.listener").Error(err)
+				_ = l.Close()
+			}
+			return
+		}
+		l.packet(buf[:n], from)
+	}
+}
+
+func (l *Listener) packet(data []byte, from net.Addr) {
+	switch {
+	case len(data) == helloSize && data[0] == packetHello:
+		l.hello(data, from)
+	case len(data) >= 1+overhead && data[0] == packetData:
+		// 只接受会话当前地址发送的数据，切换地址需要使用migrate包
+		s := l.session(binary.LittleEndian.Uint32(data[1:]))
+		if s != nil && s.isRemote(from) {
+			s.input(data[1:])
+		}
+	case len(data) >= migrateHdrSize+overhead && data[0] == packetMigrate:
+		s := l.session(binary.LittleEndian.Uint32(data[migrateHdrSize:]))
+		if s != nil {
+			s.migrate(data, from)
+		}
+	}
+}
+
+// hello 只有握手才会创建新的会话
+func (l *Listener) hello(data []byte, from net.Addr) {
+	conv := binary.LittleEndian.Uint32(data[1:])
+	l.lock.Lock()
+	if s, ok := l.sessions[conv]; ok {
+		l.lock.Unlock()
+		s.resendAck(data, from)
+		return
+	}
+	secret, ack, err := serverHello(data)
+	if err != nil {
+		l.lock.Unlock()
+		return
+	}
+	s := newSession(conv, l.conn, from, false, secret)
+	s.hello = append([]byte(nil), data...)
+	s.ack = ack
+	s.onClose = func() { l.remove(conv, s) }
+	select {
+	case l.accepts <- s:
+		l.sessions[conv] = s
+	default:
+		l.lock.Unlock()
+		s.Close()
+		return
+	}
+	l.lock.Unlock()
+	_, _ = l.conn.WriteTo(ack, from)
+}
+
+func (l *Listener) session(conv uint32) *session {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.sessions[conv]
+}
+
+func (l *Listener) remove(conv uint32, s *session) {
+	l.lock.Lock()
+	if l.sessions[conv] == s {
+		delete(l.sessions, conv)
+	}
+	l.lock.Unlock()
+}
+
+// Accept implements net.Listener
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case s := <-l.accepts:
+		return s, nil
+	case <-l.die:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close 关闭监听以及所有的会话
+func (l *Listener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.die)
+		err = l.conn.Close()
+		l.lock.Lock()
+		sessions := make([]*session, 0, len(l.sessions))
+		for _, s := range l.sessions {
+			sessions = append(sessions, s)
+		}
+		l.lock.Unlock()
+		for _, s := range sessions {
+			s.Close()
+		}
+	})
+	return err
+}
+
+// Addr implements net.Listener
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
@@ -0,0 +1,26 @@
+package kcp
+
+import (
+	"im"
+	"im/naming"
+	"im/tcp"
+	"net"
+)
+
+// NewServer 使用kcp传输的Server
+//
+// 协议、ServerOption以及Acceptor/MessageListener/StateListener与tcp.Server相同，只是监听udp地址
+func NewServer(listen string, service naming.ServiceRegistration, options ...tcp.ServerOption) im.Server {
+	options = append([]tcp.ServerOption{tcp.WithListenFunc(Listen)}, options...)
+	return tcp.NewServer(listen, service, options...)
+}
+
+// NewConn 在kcp连接上使用与tcp相同的帧格式
+func NewConn(conn net.Conn) *tcp.TcpConn {
+	return tcp.NewConn(conn)
+}
+
+// NewClient 使用kcp传输的Client，Dialer中需要使用Dial建立连接
+func NewClient(id, name string, opts tcp.ClientOptions) im.Client {
+	return tcp.NewClient(id, name, opts)
+}
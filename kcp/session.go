@@ -0,0 +1,440 @@
+package kcp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// 默认使用快速模式：关闭延迟ack、10ms刷新、2次快速重传、关闭拥塞控制
+const (
+	defaultInterval = 10
+	defaultWnd      = 128
+	// mtuLimit 读取udp包的缓冲区大小
+	mtuLimit = 1500
+	// migrateProbe 切换地址期间发送窗口探测的间隔，单位ms
+	migrateProbe = 100
+)
+
+// ErrDeadLink 一个分片重传次数过多，认为连接已经断开
+var ErrDeadLink = errors.New("kcp: dead link")
+
+var errRebind = errors.New("kcp: only client session can rebind")
+
+var epoch = time.Now()
+
+func currentMs() uint32 {
+	return uint32(time.Since(epoch) / time.Millisecond)
+}
+
+// session 在udp上使用kcp实现的可靠有序的字节流，实现了net.Conn
+type session struct {
+	mu        sync.Mutex
+	kcp       *kcpcb
+	conn      net.PacketConn
+	remote    net.Addr
+	owner     bool   // 客户端独占conn，关闭时一起关闭
+	rbuf      []byte // 已经从kcp中读出但还没有被Read取走的数据
+	rdeadline time.Time
+	wdeadline time.Time
+	chRead    chan struct{}
+	chWrite   chan struct{}
+	die       chan struct{}
+	once      sync.Once
+	err       error
+	onClose   func()
+	// secret 握手时协商的密钥，用于校验客户端切换地址
+	secret []byte
+	// counter 客户端是已经发送的migrate包的计数，服务端是已经接受的最大计数
+	counter   uint64
+	migrating bool   // 客户端切换了socket，还没有收到服务端从新地址返回的数据
+	probed    uint32 // 切换地址时上一次发送探测的时间
+	obuf      []byte
+	hello     []byte // 服务端保存客户端的hello以及响应，响应丢失时重发
+	ack       []byte
+}
+
+func newSession(conv uint32, conn net.PacketConn, remote net.Addr, owner bool, secret []byte) *session {
+	s := &session{
+		conn:    conn,
+		remote:  remote,
+		owner:   owner,
+		secret:  secret,
+		obuf:    make([]byte, 0, migrateHdrSize+mtuDef),
+		chRead:  make(chan struct{}, 1),
+		chWrite: make(chan struct{}, 1),
+		die:     make(chan struct{}),
+	}
+	s.kcp = newKCP(conv, s.output)
+	s.kcp.stream = 1
+	s.kcp.NoDelay(1, defaultInterval, 2, 1)
+	s.kcp.WndSize(defaultWnd, defaultWnd)
+	s.kcp.Update(currentMs())
+	defaultUpdater.add(s, time.Now().Add(defaultInterval*time.Millisecond))
+	return s
+}
+
+// output 在持有mu时被kcp调用，切换地址期间使用migrate包
+func (s *session) output(buf []byte) {
+	if s.migrating {
+		s.counter++
+		s.obuf = sealMigrate(s.obuf[:0], s.secret, s.counter, buf)
+	} else {
+		s.obuf = append(append(s.obuf[:0], packetData), buf...)
+	}
+	_, _ = s.conn.WriteTo(s.obuf, s.remote)
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// tick 由updater调用，返回下一次需要刷新的时间；会话关闭之后返回false，不再调度
+func (s *session) tick() (time.Time, bool) {
+	select {
+	case <-s.die:
+		return time.Time{}, false
+	default:
+	}
+	s.mu.Lock()
+	current := currentMs()
+	// 窗口探测一定会得到服务端的响应，收到响应说明服务端已经切换到新的地址
+	if s.migrating && timediff(current, s.probed) >= migrateProbe {
+		s.probed = current
+		s.kcp.probe |= askSend
+	}
+	s.kcp.Update(current)
+	dead := s.kcp.state == 0xFFFFFFFF
+	writable := s.kcp.WaitSnd() < int(s.kcp.sndWnd)
+	next := timediff(s.kcp.Check(current), current)
+	s.mu.Unlock()
+	if writable {
+		notify(s.chWrite)
+	}
+	if dead {
+		s.closeWith(ErrDeadLink)
+		return time.Time{}, false
+	}
+	return time.Now().Add(time.Duration(next) * time.Millisecond), true
+}
+
+// input 处理来自当前地址的kcp数据
+func (s *session) input(data []byte) {
+	s.inputFrom(data, nil, 0)
+}
+
+// migrate 处理客户端从新的地址发送的migrate包
+func (s *session) migrate(b []byte, from net.Addr) {
+	counter, data, ok := openMigrate(s.secret, b)
+	if !ok {
+		return
+	}
+	s.inputFrom(data, from, counter)
+}
+
+// inputFrom from不为nil时是通过校验的migrate包，只有计数没有被使用过并且kcp接受了数据才切换地址
+func (s *session) inputFrom(data []byte, from net.Addr, counter uint64) {
+	s.mu.Lock()
+	if from != nil && counter <= s.counter {
+		s.mu.Unlock()
+		return
+	}
+	s.kcp.current = currentMs()
+	if s.kcp.Input(data) >= 0 && from != nil {
+		s.counter = counter
+		s.remote = from
+	}
+	readable := s.kcp.PeekSize() > 0
+	writable := s.kcp.WaitSnd() < int(s.kcp.sndWnd)
+	s.mu.Unlock()
+	if readable {
+		notify(s.chRead)
+	}
+	if writable {
+		notify(s.chWrite)
+	}
+}
+
+// isRemote addr是否是会话当前的地址
+func (s *session) isRemote(addr net.Addr) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sameAddr(s.remote, addr)
+}
+
+func sameAddr(a, b net.Addr) bool {
+	ua, ok1 := a.(*net.UDPAddr)
+	ub, ok2 := b.(*net.UDPAddr)
+	if ok1 && ok2 {
+		return ua.Port == ub.Port && ua.IP.Equal(ub.IP)
+	}
+	return a.String() == b.String()
+}
+
+// resendAck 同一个客户端重发了hello，说明响应丢失了
+func (s *session) resendAck(hello []byte, from net.Addr) {
+	if !s.isRemote(from) || !bytes.Equal(hello, s.hello) {
+		return
+	}
+	_, _ = s.conn.WriteTo(s.ack, from)
+}
+
+// wait 等待ch、关闭或者超时
+func (s *session) wait(ch chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-s.die:
+		return s.err
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+// Read implements net.Conn
+func (s *session) Read(b []byte) (int, error) {
+	for {
+		s.mu.Lock()
+		if len(s.rbuf) > 0 {
+			n := copy(b, s.rbuf)
+			s.rbuf = s.rbuf[n:]
+			s.mu.Unlock()
+			return n, nil
+		}
+		if size := s.kcp.PeekSize(); size > 0 {
+			if len(b) >= size {
+				s.kcp.Recv(b)
+				s.mu.Unlock()
+				return size, nil
+			}
+			buf := make([]byte, size)
+			s.kcp.Recv(buf)
+			n := copy(b, buf)
+			s.rbuf = buf[n:]
+			s.mu.Unlock()
+			return n, nil
+		}
+		deadline := s.rdeadline
+		s.mu.Unlock()
+
+		if err := s.wait(s.chRead, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write implements net.Conn，发送窗口满时阻塞
+func (s *session) Write(b []byte) (int, error) {
+	for {
+		select {
+		case <-s.die:
+			return 0, s.err
+		default:
+		}
+		s.mu.Lock()
+		if s.kcp.WaitSnd() < int(s.kcp.sndWnd) {
+			n := len(b)
+			for len(b) > 0 {
+				size := len(b)
+				if size > int(s.kcp.mss) {
+					size = int(s.kcp.mss)
+				}
+				s.kcp.Send(b[:size])
+				b = b[size:]
+			}
+			s.kcp.current = currentMs()
+			s.kcp.flush()
+			s.mu.Unlock()
+			return n, nil
+		}
+		deadline := s.wdeadline
+		s.mu.Unlock()
+
+		if err := s.wait(s.chWrite, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (s *session) closeWith(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.die)
+		if s.owner {
+			s.mu.Lock()
+			conn := s.conn
+			s.mu.Unlock()
+			_ = conn.Close()
+		}
+		if s.onClose != nil {
+			s.onClose()
+		}
+	})
+}
+
+// Close implements net.Conn
+func (s *session) Close() error {
+	s.closeWith(net.ErrClosed)
+	return nil
+}
+
+// LocalAddr implements net.Conn
+func (s *session) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// RemoteAddr implements net.Conn
+func (s *session) RemoteAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remote
+}
+
+// SetDeadline implements net.Conn
+func (s *session) SetDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.rdeadline = t
+	s.wdeadline = t
+	s.mu.Unlock()
+	notify(s.chRead)
+	notify(s.chWrite)
+	return nil
+}
+
+// SetReadDeadline implements net.Conn
+func (s *session) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.rdeadline = t
+	s.mu.Unlock()
+	notify(s.chRead)
+	return nil
+}
+
+// SetWriteDeadline implements net.Conn
+func (s *session) SetWriteDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.wdeadline = t
+	s.mu.Unlock()
+	notify(s.chWrite)
+	return nil
+}
+
+// Session 客户端的kcp连接
+type Session interface {
+	net.Conn
+	// Rebind 切换网络后使用新的udp socket继续原来的会话
+	//
+	// 之后发送的数据使用握手时协商的密钥签名，服务端校验通过并且kcp接受了数据之后才会切换到新的地址
+	Rebind() error
+}
+
+// Dial 创建一个kcp连接，address可以是host:port或者kcp://host:port
+//
+// Dial会与服务端交换临时密钥，等待服务端响应；conv随机生成，客户端调用Rebind切换网络后服务端按照conv找到原来的会话
+func Dial(address string) (Session, error) {
+	host := address
+	if u, err := url.Parse(address); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	raddr, err := net.ResolveUDPAddr("udp", host)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	var conv uint32
+	for conv == 0 {
+		var b [4]byte
+		if _, err = rand.Read(b[:]); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conv = binary.LittleEndian.Uint32(b[:])
+	}
+	secret, err := clientHello(conn, raddr, conv)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s := newSession(conv, conn, raddr, true, secret)
+	go s.readLoop(conn)
+	return s, nil
+}
+
+// Rebind implements Session
+func (s *session) Rebind() error {
+	if !s.owner {
+		return errRebind
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	select {
+	case <-s.die:
+		s.mu.Unlock()
+		conn.Close()
+		return s.err
+	default:
+	}
+	old := s.conn
+	s.conn = conn
+	s.migrating = true
+	s.kcp.current = currentMs()
+	s.probed = s.kcp.current
+	s.kcp.probe |= askSend
+	s.kcp.flush()
+	s.mu.Unlock()
+
+	go s.readLoop(conn)
+	return old.Close()
+}
+
+// readLoop 客户端读取udp包
+func (s *session) readLoop(conn net.PacketConn) {
+	buf := make([]byte, mtuLimit)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			// 已经切换到新的socket，旧的socket关闭不影响会话
+			s.mu.Lock()
+			current := s.conn == conn
+			s.mu.Unlock()
+			if current {
+				s.closeWith(err)
+			}
+			return
+		}
+		if n < 1+overhead || buf[0] != packetData || binary.LittleEndian.Uint32(buf[1:]) != s.kcp.conv {
+			continue
+		}
+		s.mu.Lock()
+		if s.conn == conn {
+			s.migrating = false
+		}
+		s.mu.Unlock()
+		s.input(buf[1:n])
+	}
+}
@@ -0,0 +1,94 @@
+package kcp
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// updater 所有会话共用一个协程驱动kcp的定时刷新，按照下一次需要刷新的时间排序
+//
+// 会话数量很多时不需要每个会话一个ticker协程
+type updater struct {
+	mu      sync.Mutex
+	entries updateHeap
+	wakeup  chan struct{}
+}
+
+type updateEntry struct {
+	ts time.Time
+	s  *session
+}
+
+type updateHeap []updateEntry
+
+func (h updateHeap) Len() int            { return len(h) }
+func (h updateHeap) Less(i, j int) bool  { return h[i].ts.Before(h[j].ts) }
+func (h updateHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *updateHeap) Push(x interface{}) { *h = append(*h, x.(updateEntry)) }
+func (h *updateHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = updateEntry{}
+	*h = old[:n-1]
+	return e
+}
+
+var defaultUpdater = newUpdater()
+
+func newUpdater() *updater {
+	u := &updater{wakeup: make(chan struct{}, 1)}
+	go u.run()
+	return u
+}
+
+// add 在ts时刷新s
+func (u *updater) add(s *session, ts time.Time) {
+	u.mu.Lock()
+	heap.Push(&u.entries, updateEntry{ts: ts, s: s})
+	first := u.entries[0].s == s
+	u.mu.Unlock()
+	if first {
+		notify(u.wakeup)
+	}
+}
+
+func (u *updater) run() {
+	timer := time.NewTimer(time.Hour)
+	var due []*session
+	for {
+		now := time.Now()
+		wait := time.Hour
+		u.mu.Lock()
+		for len(u.entries) > 0 && !u.entries[0].ts.After(now) {
+			due = append(due, heap.Pop(&u.entries).(updateEntry).s)
+		}
+		if len(u.entries) > 0 {
+			wait = u.entries[0].ts.Sub(now)
+		}
+		u.mu.Unlock()
+
+		if len(due) > 0 {
+			for i, s := range due {
+				if next, ok := s.tick(); ok {
+					u.add(s, next)
+				}
+				due[i] = nil
+			}
+			due = due[:0]
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-u.wakeup:
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/rifflock/lfshook"
 	"github.com/sirupsen/logrus"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -13,6 +14,45 @@ var (
 	std *logrus.Logger = logrus.New()
 )
 
+func init() {
+	std.AddHook(contextHook{})
+}
+
+var (
+	contextLock   sync.RWMutex
+	contextFields []func(context.Context) Fields
+)
+
+// RegisterContextFields 注册从context中获取字段的方法，WithContext创建的日志都会带上这些字段
+func RegisterContextFields(fields func(context.Context) Fields) {
+	contextLock.Lock()
+	defer contextLock.Unlock()
+	contextFields = append(contextFields, fields)
+}
+
+// contextHook 在日志输出前加入context中的字段，已经存在的字段不会被覆盖
+type contextHook struct{}
+
+func (contextHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (contextHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	contextLock.RLock()
+	defer contextLock.RUnlock()
+	for _, fields := range contextFields {
+		for k, v := range fields(entry.Context) {
+			if _, ok := entry.Data[k]; !ok {
+				entry.Data[k] = v
+			}
+		}
+	}
+	return nil
+}
+
 // Fields Fields
 type Fields map[string]interface{}
 
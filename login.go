@@ -0,0 +1,81 @@
+package im
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// LoginPolicy 同一个channel id重复登录时的处理策略
+type LoginPolicy int
+
+const (
+	// LoginRejectNew 拒绝新的连接
+	LoginRejectNew LoginPolicy = iota
+	// LoginReplaceOld 踢掉旧的连接
+	LoginReplaceOld
+	// LoginMultiDevice 允许同一个账号在多个设备上登录，channel id必须由DeviceID生成，
+	// 同一个设备重复登录时踢掉旧的连接
+	LoginMultiDevice
+)
+
+func (p LoginPolicy) String() string {
+	switch p {
+	case LoginRejectNew:
+		return "reject_new"
+	case LoginReplaceOld:
+		return "replace_old"
+	case LoginMultiDevice:
+		return "multi_device"
+	}
+	return "unknown"
+}
+
+// errors of login
+var (
+	ErrKickout        = errors.New("kickout: logged in from another place")
+	ErrDeviceRequired = errors.New("channel id without device")
+)
+
+const deviceSeparator = "#"
+
+// DeviceID 生成多设备登录时的channel id
+func DeviceID(account, device string) string {
+	return account + deviceSeparator + device
+}
+
+// ParseDeviceID 从DeviceID生成的channel id中解析出账号与设备
+func ParseDeviceID(id string) (account, device string, ok bool) {
+	i := strings.LastIndex(id, deviceSeparator)
+	if i <= 0 || i == len(id)-1 {
+		return id, "", false
+	}
+	return id[:i], id[i+1:], true
+}
+
+// AddChannel 按照登录策略把channel加入channels，返回被替换的旧channel
+func AddChannel(channels ChannelMap, channel Channel, policy LoginPolicy) (Channel, error) {
+	if channel == nil {
+		return nil, ErrSessionNil
+	}
+	switch policy {
+	case LoginMultiDevice:
+		if _, _, ok := ParseDeviceID(channel.ID()); !ok {
+			return nil, ErrDeviceRequired
+		}
+		fallthrough
+	case LoginReplaceOld:
+		old, _ := channels.Replace(channel)
+		return old, nil
+	default:
+		return nil, channels.Add(channel)
+	}
+}
+
+// Kickout 发送OpClose告知旧连接被踢下线，然后关闭
+func Kickout(channel Channel, writewait time.Duration) {
+	_ = channel.SetWriteDeadline(time.Now().Add(writewait))
+	_ = channel.WriteFrame(OpClose, []byte(ErrKickout.Error()))
+	_ = channel.Flush()
+	_ = channel.Close()
+}
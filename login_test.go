@@ -0,0 +1,57 @@
+package im
+
+import "testing"
+
+func TestAddChannel(t *testing.T) {
+	channels := NewChannels(10)
+	first := &testChannel{id: "u1"}
+	second := &testChannel{id: "u1"}
+
+	if _, err := AddChannel(channels, first, LoginRejectNew); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddChannel(channels, second, LoginRejectNew); err != ErrChannelExists {
+		t.Fatalf("expect ErrChannelExists, got %v", err)
+	}
+
+	old, err := AddChannel(channels, second, LoginReplaceOld)
+	if err != nil || old != first {
+		t.Fatalf("expect first replaced, got %v %v", old, err)
+	}
+	// 旧channel断开时不能移除新的channel
+	if channels.RemoveChannel(first) {
+		t.Fatal("expect first not removed")
+	}
+	if ch, ok := channels.Get("u1"); !ok || ch != second {
+		t.Fatal("expect second kept")
+	}
+	if !channels.RemoveChannel(second) {
+		t.Fatal("expect second removed")
+	}
+
+	if _, err := AddChannel(channels, first, LoginMultiDevice); err != ErrDeviceRequired {
+		t.Fatalf("expect ErrDeviceRequired, got %v", err)
+	}
+	phone := &testChannel{id: DeviceID("u1", "phone")}
+	pc := &testChannel{id: DeviceID("u1", "pc")}
+	for _, ch := range []Channel{phone, pc} {
+		if old, err := AddChannel(channels, ch, LoginMultiDevice); err != nil || old != nil {
+			t.Fatalf("expect %s added, got %v %v", ch.ID(), old, err)
+		}
+	}
+	if old, _ := AddChannel(channels, &testChannel{id: DeviceID("u1", "pc")}, LoginMultiDevice); old != pc {
+		t.Fatal("expect pc replaced")
+	}
+}
+
+func TestParseDeviceID(t *testing.T) {
+	account, device, ok := ParseDeviceID(DeviceID("a#b", "phone"))
+	if !ok || account != "a#b" || device != "phone" {
+		t.Fatalf("unexpected %s %s %v", account, device, ok)
+	}
+	for _, id := range []string{"u1", "#phone", "u1#"} {
+		if _, _, ok := ParseDeviceID(id); ok {
+			t.Errorf("expect %q invalid", id)
+		}
+	}
+}
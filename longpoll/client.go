@@ -0,0 +1,244 @@
+package longpoll
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"im"
+	"im/tcp"
+	"im/wire/endian"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientConn 客户端的http会话，实现了im.Conn，使用长轮询拉取下行帧
+type ClientConn struct {
+	base   string
+	sid    string
+	client *http.Client
+
+	wlock sync.Mutex
+	wbuf  bytes.Buffer
+
+	rlock     sync.Mutex
+	ack       uint64
+	frames    []im.Frame
+	rdeadline int64 // unix nano, accessed atomically
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Dial 创建一个会话，address是服务的地址，比如http://host:port
+func Dial(address string) (*ClientConn, error) {
+	return DialWithClient(address, http.DefaultClient)
+}
+
+// DialWithClient 使用指定的http.Client创建会话
+func DialWithClient(address string, client *http.Client) (*ClientConn, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(u.String(), "/")
+	resp, err := client.Post(base+"/connect", "application/octet-stream", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("longpoll: connect failed with status %d", resp.StatusCode)
+	}
+	sid := resp.Header.Get(HeaderSessionID)
+	if sid == "" {
+		return nil, fmt.Errorf("longpoll: session id is missing")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ClientConn{
+		base:   base,
+		sid:    sid,
+		client: client,
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+// request 会话ID通过X-Session-Id发送
+func (c *ClientConn) request(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(HeaderSessionID, c.sid)
+	return req, nil
+}
+
+// ReadFrame 读取一个下行帧，缓存为空时发起长轮询
+func (c *ClientConn) ReadFrame() (im.Frame, error) {
+	c.rlock.Lock()
+	defer c.rlock.Unlock()
+	for len(c.frames) == 0 {
+		var deadline time.Time
+		if d := atomic.LoadInt64(&c.rdeadline); d != 0 {
+			deadline = time.Unix(0, d)
+			if time.Now().After(deadline) {
+				return nil, os.ErrDeadlineExceeded
+			}
+		}
+		if err := c.poll(deadline); err != nil {
+			return nil, err
+		}
+	}
+	f := c.frames[0]
+	c.frames = c.frames[1:]
+	return f, nil
+}
+
+// poll 在持有rlock时调用
+func (c *ClientConn) poll(deadline time.Time) error {
+	ctx := c.ctx
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	req, err := c.request(ctx, http.MethodGet, "/poll?ack="+strconv.FormatUint(c.ack, 10), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return os.ErrDeadlineExceeded
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return nil
+	case http.StatusGone, http.StatusNotFound:
+		return io.EOF
+	default:
+		return fmt.Errorf("longpoll: poll failed with status %d", resp.StatusCode)
+	}
+	seq, err := strconv.ParseUint(resp.Header.Get(HeaderSeq), 10, 64)
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(resp.Body)
+	var frames []im.Frame
+	for {
+		opcode, err := endian.ReadUint8(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		payload, err := endian.ReadBytes(r)
+		if err != nil {
+			return err
+		}
+		frames = append(frames, &tcp.Frame{OpCode: im.OpCode(opcode), Payload: payload})
+	}
+	// 整个响应读取完成之后才确认，读取失败时下一次轮询会重新拉取
+	c.frames = append(c.frames, frames...)
+	c.ack = seq
+	return nil
+}
+
+// WriteFrame 写入缓冲区，调用Flush后才会发送
+func (c *ClientConn) WriteFrame(code im.OpCode, payload []byte) error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	return tcp.WriteFrame(&c.wbuf, code, payload)
+}
+
+// Flush 通过一个POST请求发送缓冲区中的帧
+func (c *ClientConn) Flush() error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	if c.wbuf.Len() == 0 {
+		return nil
+	}
+	req, err := c.request(c.ctx, http.MethodPost, "/send", bytes.NewReader(c.wbuf.Bytes()))
+	if err != nil {
+		return err
+	}
+	c.wbuf.Reset()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("longpoll: send failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close 关闭会话
+func (c *ClientConn) Close() error {
+	req, err := c.request(context.Background(), http.MethodPost, "/close", nil)
+	if err == nil {
+		var resp *http.Response
+		resp, err = c.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+	c.cancel()
+	return err
+}
+
+// Read 不支持，使用ReadFrame
+func (c *ClientConn) Read(b []byte) (int, error) {
+	return 0, ErrRawIO
+}
+
+// Write 不支持，使用WriteFrame
+func (c *ClientConn) Write(b []byte) (int, error) {
+	return 0, ErrRawIO
+}
+
+// LocalAddr implements net.Conn
+func (c *ClientConn) LocalAddr() net.Addr {
+	return Addr("")
+}
+
+// RemoteAddr implements net.Conn
+func (c *ClientConn) RemoteAddr() net.Addr {
+	return Addr(c.base)
+}
+
+// SetDeadline implements net.Conn
+func (c *ClientConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline 设置ReadFrame的超时时间，在下一次轮询时生效
+func (c *ClientConn) SetReadDeadline(t time.Time) error {
+	var d int64
+	if !t.IsZero() {
+		d = t.UnixNano()
+	}
+	atomic.StoreInt64(&c.rdeadline, d)
+	return nil
+}
+
+// SetWriteDeadline implements net.Conn
+func (c *ClientConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
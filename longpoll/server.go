@@ -0,0 +1,642 @@
+package longpoll
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/segmentio/ksuid"
+	"im"
+	"im/logger"
+	"im/naming"
+	"im/tcp"
+	"im/wire/endian"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPollWait 长轮询没有数据时的最长等待时间
+	DefaultPollWait = time.Second * 25
+	// DefaultSessionWait 没有请求时会话的保留时间，超过之后会话被关闭
+	DefaultSessionWait = time.Second * 40
+	// DefaultMaxPending 每个会话最多缓存的未确认下行帧
+	DefaultMaxPending = 1024
+	// DefaultMaxPendingBytes 每个会话最多缓存的未确认下行字节数，需要能容纳一个最大的帧
+	DefaultMaxPendingBytes = 8 << 20
+	// maxBatchSize 一次长轮询响应的最大字节数
+	maxBatchSize = 64 << 10
+	// DefaultMaxConcurrentLogins 默认最多同时处于登录阶段的会话
+	DefaultMaxConcurrentLogins = 1024
+	// DefaultMaxLoginsPerIP 默认单个IP最多同时处于登录阶段的会话
+	DefaultMaxLoginsPerIP = 16
+	// sseKeepalive SSE空闲时发送注释行的间隔，避免被代理断开
+	sseKeepalive = time.Second * 15
+)
+
+// http header
+const (
+	HeaderSessionID = "X-Session-Id"
+	HeaderSeq       = "X-Seq"
+	// CookieSessionID /connect设置的会话cookie，浏览器的EventSource无法设置header时使用
+	CookieSessionID = "im_sid"
+)
+
+type ServerOptions struct {
+	loginwait   time.Duration //登陆超时
+	readwait    time.Duration //读超时
+	writewait   time.Duration //写超时
+	pollwait    time.Duration //长轮询等待时间
+	sessionwait time.Duration //会话保留时间
+	channel     []im.ChannelOption
+	maxframe    int            //最大帧长度
+	maxpending  int            //最多缓存的未确认下行帧
+	maxbytes    int            //最多缓存的未确认下行字节数
+	login       im.LoginPolicy //重复登录的处理策略
+	maxlogins   int            //同时处于登录阶段的最大会话数，0表示不限制
+	maxperip    int            //单个IP同时处于登录阶段的最大会话数，0表示不限制
+}
+
+// ServerOption ServerOption
+type ServerOption func(*ServerOptions)
+
+// WithMaxFrameSize set max size of a frame read from the requests
+func WithMaxFrameSize(size int) ServerOption {
+	return func(so *ServerOptions) {
+		so.maxframe = size
+	}
+}
+
+// WithPollWait set max wait duration of a long-poll request
+func WithPollWait(wait time.Duration) ServerOption {
+	return func(so *ServerOptions) {
+		so.pollwait = wait
+	}
+}
+
+// WithSessionWait set how long a session is kept without any request
+func WithSessionWait(wait time.Duration) ServerOption {
+	return func(so *ServerOptions) {
+		so.sessionwait = wait
+	}
+}
+
+// WithMaxPending set max number of unacknowledged frames of a session
+func WithMaxPending(n int) ServerOption {
+	return func(so *ServerOptions) {
+		so.maxpending = n
+	}
+}
+
+// WithMaxPendingBytes set max bytes of unacknowledged frames of a session
+func WithMaxPendingBytes(n int) ServerOption {
+	return func(so *ServerOptions) {
+		so.maxbytes = n
+	}
+}
+
+// WithLoginPolicy set policy of duplicate login, default is im.LoginRejectNew
+func WithLoginPolicy(policy im.LoginPolicy) ServerOption {
+	return func(so *ServerOptions) {
+		so.login = policy
+	}
+}
+
+// WithMaxConcurrentLogins limit the number of sessions in login phase, /connect responds 503 when it is reached
+func WithMaxConcurrentLogins(max int) ServerOption {
+	return func(so *ServerOptions) {
+		so.maxlogins = max
+	}
+}
+
+// WithMaxLoginsPerIP limit the number of sessions in login phase from a remote ip, /connect responds 429 when it is reached
+func WithMaxLoginsPerIP(max int) ServerOption {
+	return func(so *ServerOptions) {
+		so.maxperip = max
+	}
+}
+
+// WithChannelOptions set options of the channels created by the server
+func WithChannelOptions(opts ...im.ChannelOption) ServerOption {
+	return func(so *ServerOptions) {
+		so.channel = append(so.channel, opts...)
+	}
+}
+
+// Server 在http上模拟长连接，用于无法使用websocket的网络
+//
+//	POST /connect        创建会话，响应体与X-Session-Id是会话ID，同时设置cookie im_sid
+//	POST /send           请求体是若干个tcp格式的帧
+//	GET  /poll?ack=      长轮询，确认ack及之前的帧，响应体是若干个tcp格式的帧，X-Seq是最后一帧的序号
+//	GET  /events         SSE，每个事件的id是序号，data是base64编码的tcp格式的帧，断线后通过Last-Event-ID继续
+//	POST /close          关闭会话
+//
+// 除了/connect，请求都需要通过X-Session-Id或者cookie携带会话ID；
+// 会话ID不放在URL中，避免出现在代理与访问日志里。
+type Server struct {
+	listen string
+	naming.ServiceRegistration
+	im.ChannelMap
+	im.Acceptor
+	im.MessageListener
+	im.StateListener
+	once     sync.Once
+	options  ServerOptions
+	lock     sync.RWMutex
+	sessions map[string]*Session
+	logins   int            // 处于登录阶段的会话数，由lock保护
+	ips      map[string]int // 每个IP处于登录阶段的会话数
+	httpsrv  *http.Server
+	quit     *im.Event
+}
+
+// NewServer NewServer
+func NewServer(listen string, service naming.ServiceRegistration, options ...ServerOption) im.Server {
+	srv := &Server{
+		listen:              listen,
+		ServiceRegistration: service,
+		options: ServerOptions{
+			loginwait:   im.DefaultLoginWait,
+			readwait:    im.DefaultReadWait,
+			writewait:   time.Second * 10,
+			pollwait:    DefaultPollWait,
+			sessionwait: DefaultSessionWait,
+			maxframe:    im.DefaultMaxFrameSize,
+			maxpending:  DefaultMaxPending,
+			maxbytes:    DefaultMaxPendingBytes,
+			maxlogins:   DefaultMaxConcurrentLogins,
+			maxperip:    DefaultMaxLoginsPerIP,
+		},
+		sessions: make(map[string]*Session),
+		ips:      make(map[string]int),
+		quit:     im.NewEvent(),
+	}
+	for _, option := range options {
+		option(&srv.options)
+	}
+	return srv
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/connect", s.handleConnect)
+	mux.HandleFunc("/send", s.handleSend)
+	mux.HandleFunc("/poll", s.handlePoll)
+	mux.HandleFunc("/events", s.handleEvents)
+	mux.HandleFunc("/close", s.handleClose)
+	return mux
+}
+
+// Start server
+func (s *Server) Start() error {
+	log := logger.WithFields(logger.Fields{
+		"module": "longpoll.server",
+		"listen": s.listen,
+		"id":     s.ServiceID(),
+	})
+
+	if s.Acceptor == nil {
+		s.Acceptor = new(defaultAcceptor)
+	}
+	if s.StateListener == nil {
+		return fmt.Errorf("StateListener is nil")
+	}
+	if s.ChannelMap == nil {
+		s.ChannelMap = im.NewChannels(100)
+	}
+	go s.sweep()
+
+	s.lock.Lock()
+	s.httpsrv = &http.Server{Addr: s.listen, Handler: s.handler()}
+	s.lock.Unlock()
+	log.Infoln("started")
+	err := s.httpsrv.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// sweep 关闭长时间没有请求的会话，删除已经关闭并且下行帧都被确认的会话
+func (s *Server) sweep() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.quit.Done():
+			return
+		}
+		s.expire()
+	}
+}
+
+// expire 在读锁下找出需要删除的会话，关闭与删除都在释放读锁之后进行
+func (s *Server) expire() {
+	var expired, drained []*Session
+	s.lock.RLock()
+	for _, session := range s.sessions {
+		if session.idle(s.options.sessionwait) {
+			expired = append(expired, session)
+		} else if session.drained() {
+			drained = append(drained, session)
+		}
+	}
+	s.lock.RUnlock()
+	if len(expired) == 0 && len(drained) == 0 {
+		return
+	}
+	for _, session := range expired {
+		session.closeWith(ErrSessionExpired)
+	}
+	s.lock.Lock()
+	for _, session := range append(expired, drained...) {
+		if s.sessions[session.ID()] == session {
+			delete(s.sessions, session.ID())
+		}
+	}
+	s.lock.Unlock()
+}
+
+func (s *Server) session(w http.ResponseWriter, r *http.Request) (*Session, bool) {
+	id := r.Header.Get(HeaderSessionID)
+	if id == "" {
+		if c, err := r.Cookie(CookieSessionID); err == nil {
+			id = c.Value
+		}
+	}
+	s.lock.RLock()
+	session, ok := s.sessions[id]
+	s.lock.RUnlock()
+	if !ok {
+		resp(w, http.StatusNotFound, "session not found")
+		return nil, false
+	}
+	session.touch(Addr(r.RemoteAddr))
+	return session, true
+}
+
+func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		resp(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	session := newSession(ksuid.New().String(), Addr(s.listen), Addr(r.RemoteAddr), s.options.maxpending, s.options.maxbytes)
+	// 登录完成之前会话与协程都没有经过认证，需要限制数量
+	release, err := s.admit(remoteIP(r), session)
+	if err == tcp.ErrTooManyConnectionsPerIP {
+		resp(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if err != nil {
+		resp(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	w.Header().Set(HeaderSessionID, session.ID())
+	w.Header().Set("Cache-Control", "no-store")
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieSessionID,
+		Value:    session.ID(),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	_, _ = w.Write([]byte(session.ID()))
+
+	// 登录包需要客户端通过send请求发送，所以在响应之后再握手
+	go s.serve(session, release)
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// admit 检查登录阶段的会话数限制，通过后添加会话，返回的release需要在登录结束后调用
+func (s *Server) admit(ip string, session *Session) (func(), error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.options.maxlogins > 0 && s.logins >= s.options.maxlogins {
+		return nil, tcp.ErrTooManyLogins
+	}
+	if s.options.maxperip > 0 && s.ips[ip] >= s.options.maxperip {
+		return nil, tcp.ErrTooManyConnectionsPerIP
+	}
+	s.logins++
+	s.ips[ip]++
+	s.sessions[session.ID()] = session
+	return func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.logins--
+		if s.ips[ip] <= 1 {
+			delete(s.ips, ip)
+		} else {
+			s.ips[ip]--
+		}
+	}, nil
+}
+
+// serve 握手并且启动Readloop，与websocket.Server的流程一致
+func (s *Server) serve(conn *Session, release func()) {
+	log := logger.WithFields(logger.Fields{
+		"module": "longpoll.server",
+		"id":     s.ServiceID(),
+	})
+	id, err := s.Accept(conn, s.options.loginwait)
+	release()
+	if err != nil {
+		_ = conn.WriteFrame(im.OpClose, []byte(err.Error()))
+		_ = conn.Flush()
+		conn.Close()
+		return
+	}
+	channel := im.NewChannel(id, conn, s.options.channel...)
+	channel.SetWriteWait(s.options.writewait)
+	channel.SetReadWait(s.options.readwait)
+	old, err := im.AddChannel(s.ChannelMap, channel, s.options.login)
+	if err != nil {
+		log.Warnf("channel %s - %v", id, err)
+		_ = conn.WriteFrame(im.OpClose, []byte(err.Error()))
+		_ = conn.Flush()
+		channel.Close()
+		return
+	}
+	if old != nil {
+		log.Infof("channel %s is replaced, kickout %v", id, old.RemoteAddr())
+		go im.Kickout(old, s.options.writewait)
+	}
+
+	err = channel.Readloop(s.MessageListener)
+	if err != nil {
+		log.Info(err)
+	}
+	// 被替换的channel已经不在map中，不能通知Disconnect
+	if s.RemoveChannel(channel) {
+		err = s.Disconnect(channel.ID())
+		if err != nil {
+			log.Warn(err)
+		}
+	}
+	channel.Close()
+}
+
+func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		resp(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	session, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	body := bufio.NewReader(r.Body)
+	for {
+		opcode, err := endian.ReadUint8(body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			resp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		payload, err := endian.ReadBytesLimit(body, uint32(s.options.maxframe))
+		if err == endian.ErrTooLarge {
+			resp(w, http.StatusRequestEntityTooLarge, im.ErrFrameTooLarge.Error())
+			return
+		}
+		if err != nil {
+			resp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err = session.push(r.Context(), &tcp.Frame{OpCode: im.OpCode(opcode), Payload: payload}); err != nil {
+			resp(w, http.StatusGone, err.Error())
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePoll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		resp(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	session, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	ack, _ := strconv.ParseUint(r.URL.Query().Get("ack"), 10, 64)
+	session.ack(ack)
+
+	session.pollBegin()
+	defer session.pollEnd()
+
+	timer := time.NewTimer(s.options.pollwait)
+	defer timer.Stop()
+	w.Header().Set("Cache-Control", "no-store")
+	for {
+		frames, wake, closed := session.next(ack, maxBatchSize)
+		if len(frames) > 0 {
+			var buf bytes.Buffer
+			for _, f := range frames {
+				buf.Write(f.data)
+			}
+			w.Header().Set(HeaderSeq, strconv.FormatUint(frames[len(frames)-1].seq, 10))
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write(buf.Bytes())
+			return
+		}
+		if closed {
+			resp(w, http.StatusGone, "session closed")
+			return
+		}
+		select {
+		case <-wake:
+		case <-timer.C:
+			w.Header().Set(HeaderSeq, strconv.FormatUint(ack, 10))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		case <-s.quit.Done():
+			resp(w, http.StatusServiceUnavailable, "server shutdown")
+			return
+		}
+	}
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		resp(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		resp(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	session, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("ack")
+	}
+	ack, _ := strconv.ParseUint(last, 10, 64)
+	session.ack(ack)
+
+	session.pollBegin()
+	defer session.pollEnd()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(sseKeepalive)
+	defer keepalive.Stop()
+	for {
+		frames, wake, closed := session.next(ack, maxBatchSize)
+		for _, f := range frames {
+			if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", f.seq, base64.StdEncoding.EncodeToString(f.data)); err != nil {
+				return
+			}
+			ack = f.seq
+		}
+		if len(frames) > 0 {
+			flusher.Flush()
+			continue
+		}
+		if closed {
+			_, _ = io.WriteString(w, "event: end\ndata:\n\n")
+			flusher.Flush()
+			return
+		}
+		select {
+		case <-wake:
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			session.touch(Addr(r.RemoteAddr))
+		case <-r.Context().Done():
+			return
+		case <-s.quit.Done():
+			return
+		}
+	}
+}
+
+func (s *Server) handleClose(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		resp(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	session, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	session.Close()
+	s.lock.Lock()
+	delete(s.sessions, session.ID())
+	s.lock.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Shutdown Shutdown
+func (s *Server) Shutdown(ctx context.Context) error {
+	log := logger.WithFields(logger.Fields{
+		"module": "longpoll.server",
+		"id":     s.ServiceID(),
+	})
+	var err error
+	s.once.Do(func() {
+		defer func() {
+			log.Infoln("shutdown")
+		}()
+		s.quit.Fire()
+		s.lock.RLock()
+		httpsrv := s.httpsrv
+		s.lock.RUnlock()
+		if httpsrv != nil {
+			err = httpsrv.Shutdown(ctx)
+		}
+		// close channels
+		chanels := s.ChannelMap.All()
+		for _, ch := range chanels {
+			ch.Close()
+
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				continue
+			}
+		}
+	})
+	return err
+}
+
+// string channelID
+// []byte data
+func (s *Server) Push(id string, data []byte) error {
+	ch, ok := s.ChannelMap.Get(id)
+	if !ok {
+		return im.ErrChannelNotFound
+	}
+	return ch.Push(data)
+}
+
+// SetAcceptor SetAcceptor
+func (s *Server) SetAcceptor(acceptor im.Acceptor) {
+	s.Acceptor = acceptor
+}
+
+// SetMessageListener SetMessageListener
+func (s *Server) SetMessageListener(listener im.MessageListener) {
+	s.MessageListener = listener
+}
+
+// SetStateListener SetStateListener
+func (s *Server) SetStateListener(listener im.StateListener) {
+	s.StateListener = listener
+}
+
+// SetChannels SetChannels
+func (s *Server) SetChannelMap(channels im.ChannelMap) {
+	s.ChannelMap = channels
+}
+
+// SetReadWait set read wait duration
+func (s *Server) SetReadWait(readwait time.Duration) {
+	s.options.readwait = readwait
+}
+
+func resp(w http.ResponseWriter, code int, body string) {
+	w.WriteHeader(code)
+	if body != "" {
+		_, _ = w.Write([]byte(body))
+	}
+	logger.Warnf("response with code:%d %s", code, body)
+}
+
+type defaultAcceptor struct {
+}
+
+// Accept defaultAcceptor
+func (a *defaultAcceptor) Accept(conn im.Conn, timeout time.Duration) (string, error) {
+	return ksuid.New().String(), nil
+}
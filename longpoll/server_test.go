@@ -0,0 +1,313 @@
+package longpoll
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"im"
+	"im/naming"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testStateListener struct {
+	disconnected chan string
+}
+
+func (l *testStateListener) Disconnect(id string) error {
+	l.disconnected <- id
+	return nil
+}
+
+// loginAcceptor 第一帧的payload作为channel id
+type loginAcceptor struct{}
+
+func (a *loginAcceptor) Accept(conn im.Conn, timeout time.Duration) (string, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	frame, err := conn.ReadFrame()
+	if err != nil {
+		return "", err
+	}
+	if len(frame.GetPayload()) == 0 {
+		return "", errors.New("empty id")
+	}
+	return string(frame.GetPayload()), nil
+}
+
+type echoListener struct{}
+
+func (l *echoListener) Receive(ag im.Agent, payload []byte) {
+	_ = ag.Push(payload)
+}
+
+func newTestServer(t *testing.T, opts ...ServerOption) (*Server, *testStateListener, *httptest.Server) {
+	srv := NewServer("", naming.NewEntry("test", "test", "http", "127.0.0.1", 0), opts...).(*Server)
+	lst := &testStateListener{disconnected: make(chan string, 1)}
+	srv.SetAcceptor(new(loginAcceptor))
+	srv.SetMessageListener(new(echoListener))
+	srv.SetStateListener(lst)
+	srv.SetChannelMap(im.NewChannels(10))
+	go srv.sweep()
+	ts := httptest.NewServer(srv.handler())
+	t.Cleanup(func() {
+		srv.quit.Fire()
+		ts.Close()
+	})
+	return srv, lst, ts
+}
+
+// session 服务端的会话，用来直接写入下行帧
+func session(t *testing.T, srv *Server, conn *ClientConn) *Session {
+	srv.lock.RLock()
+	defer srv.lock.RUnlock()
+	s, ok := srv.sessions[conn.sid]
+	if !ok {
+		t.Fatal("session not found")
+	}
+	return s
+}
+
+func login(t *testing.T, addr, id string) *ClientConn {
+	conn, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.WriteFrame(im.OpBinary, []byte(id)); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestServerEcho(t *testing.T) {
+	_, lst, ts := newTestServer(t)
+	conn := login(t, ts.URL, "u1")
+
+	_ = conn.WriteFrame(im.OpBinary, []byte("hello"))
+	_ = conn.WriteFrame(im.OpPing, nil)
+	_ = conn.WriteFrame(im.OpBinary, []byte("world"))
+	if err := conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	var got []string
+	for len(got) < 3 {
+		frame, err := conn.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(frame.GetPayload()))
+	}
+	// DefaultDispatcher每个消息一个goroutine，echo的顺序不确定
+	sort.Strings(got)
+	if strings.Join(got, ",") != ",hello,world" {
+		t.Fatalf("unexpected frames %q", got)
+	}
+
+	_ = conn.Close()
+	select {
+	case id := <-lst.disconnected:
+		if id != "u1" {
+			t.Fatalf("unexpected disconnect %s", id)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("channel is not disconnected")
+	}
+}
+
+// 没有确认的帧在下一次轮询时重新发送
+func TestServerPollResume(t *testing.T) {
+	srv, _, ts := newTestServer(t)
+	conn := login(t, ts.URL, "u1")
+	s := session(t, srv, conn)
+	_ = s.WriteFrame(im.OpBinary, []byte("hello"))
+	_ = s.Flush()
+
+	poll := func(ack string) (int, string, string) {
+		req, _ := conn.request(context.Background(), http.MethodGet, "/poll?ack="+ack, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get(HeaderSeq), string(body)
+	}
+	code, seq, body := poll("0")
+	if code != http.StatusOK || seq != "1" || !strings.HasSuffix(body, "hello") {
+		t.Fatalf("unexpected poll %d %s %q", code, seq, body)
+	}
+	// 响应丢失，客户端仍然使用旧的ack
+	code, seq, body2 := poll("0")
+	if code != http.StatusOK || seq != "1" || body2 != body {
+		t.Fatalf("unexpected resumed poll %d %s %q", code, seq, body2)
+	}
+
+	_ = s.WriteFrame(im.OpBinary, []byte("world"))
+	_ = s.Flush()
+	code, seq, body = poll("1")
+	if code != http.StatusOK || seq != "2" || !strings.HasSuffix(body, "world") {
+		t.Fatalf("unexpected poll %d %s %q", code, seq, body)
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	srv, _, ts := newTestServer(t)
+	conn := login(t, ts.URL, "u1")
+	s := session(t, srv, conn)
+	_ = s.WriteFrame(im.OpBinary, []byte("a"))
+	_ = s.WriteFrame(im.OpBinary, []byte("b"))
+	_ = s.Flush()
+
+	events := func(last string, n int) []string {
+		req, _ := conn.request(context.Background(), http.MethodGet, "/events", nil)
+		req.Header.Set("Last-Event-ID", last)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var lines []string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() && len(lines) < n*2 {
+			if line := scanner.Text(); line != "" && !strings.HasPrefix(line, ":") {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+	lines := events("", 2)
+	if len(lines) != 4 || lines[0] != "id: 1" || lines[2] != "id: 2" {
+		t.Fatalf("unexpected events %q", lines)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(lines[3], "data: "))
+	if err != nil || !strings.HasSuffix(string(data), "b") {
+		t.Fatalf("unexpected data %q %v", data, err)
+	}
+	// 从Last-Event-ID之后继续
+	lines = events("1", 1)
+	if len(lines) != 2 || lines[0] != "id: 2" {
+		t.Fatalf("unexpected resumed events %q", lines)
+	}
+}
+
+func TestServerSessionExpired(t *testing.T) {
+	srv, lst, ts := newTestServer(t, WithSessionWait(time.Millisecond*100))
+	conn := login(t, ts.URL, "u1")
+	_ = conn.WriteFrame(im.OpBinary, []byte("hello"))
+	_ = conn.Flush()
+
+	select {
+	case id := <-lst.disconnected:
+		if id != "u1" {
+			t.Fatalf("unexpected disconnect %s", id)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("session is not expired")
+	}
+	srv.lock.RLock()
+	n := len(srv.sessions)
+	srv.lock.RUnlock()
+	if n != 0 {
+		t.Fatalf("unexpected sessions %d", n)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.ReadFrame(); err != io.EOF {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// 登录阶段的会话超过限制时/connect返回503或429，登录完成后释放
+func TestServerConnectLimit(t *testing.T) {
+	connect := func(url string) int {
+		res, err := http.Post(url+"/connect", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	_, _, ts := newTestServer(t, WithMaxLoginsPerIP(2))
+	for i, expect := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if code := connect(ts.URL); code != expect {
+			t.Fatalf("connect %d: expect %d, got %d", i, expect, code)
+		}
+	}
+
+	_, _, ts = newTestServer(t, WithMaxConcurrentLogins(1), WithMaxLoginsPerIP(0))
+	conn := login(t, ts.URL, "u1")
+	defer conn.Close()
+	// 等待u1登录完成
+	_ = conn.WriteFrame(im.OpBinary, []byte("hello"))
+	_ = conn.Flush()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	if _, err := conn.ReadFrame(); err != nil {
+		t.Fatal(err)
+	}
+	if code := connect(ts.URL); code != http.StatusOK {
+		t.Fatalf("expect %d, got %d", http.StatusOK, code)
+	}
+	if code := connect(ts.URL); code != http.StatusServiceUnavailable {
+		t.Fatalf("expect %d, got %d", http.StatusServiceUnavailable, code)
+	}
+}
+
+// 未确认的下行帧超过字节预算时拒绝写入，确认或者发送之后释放
+func TestSessionByteBudget(t *testing.T) {
+	s := newSession("s", "local", "remote", DefaultMaxPending, 100)
+	payload := make([]byte, 60)
+	if err := s.WriteFrame(im.OpBinary, payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteFrame(im.OpBinary, payload); err != ErrPendingTooLarge {
+		t.Fatalf("expect %v, got %v", ErrPendingTooLarge, err)
+	}
+	s.ack(1)
+	if err := s.WriteFrame(im.OpBinary, payload); err != nil {
+		t.Fatal(err)
+	}
+	// SSE发送过的帧在预算不足时被丢弃
+	if frames, _, _ := s.next(1, maxBatchSize); len(frames) != 1 {
+		t.Fatalf("unexpected frames %d", len(frames))
+	}
+	if err := s.WriteFrame(im.OpBinary, payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteFrame(im.OpBinary, make([]byte, 100)); err != ErrPendingTooLarge {
+		t.Fatalf("expect %v, got %v", ErrPendingTooLarge, err)
+	}
+}
+
+// 会话ID只能通过header或者cookie传递
+func TestServerSessionID(t *testing.T) {
+	_, _, ts := newTestServer(t)
+	conn := login(t, ts.URL, "u1")
+	defer conn.Close()
+
+	send := func(req *http.Request) int {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/send?sid="+conn.sid, nil)
+	if code := send(req); code != http.StatusNotFound {
+		t.Fatalf("expect %d, got %d", http.StatusNotFound, code)
+	}
+	req, _ = http.NewRequest(http.MethodPost, ts.URL+"/send", nil)
+	req.AddCookie(&http.Cookie{Name: CookieSessionID, Value: conn.sid})
+	if code := send(req); code != http.StatusNoContent {
+		t.Fatalf("expect %d, got %d", http.StatusNoContent, code)
+	}
+}
@@ -0,0 +1,331 @@
+package longpoll
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"im"
+	"im/tcp"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errors
+var (
+	ErrSessionExpired  = errors.New("longpoll: session expired")
+	ErrTooManyPending  = errors.New("longpoll: too many pending frames")
+	ErrPendingTooLarge = errors.New("longpoll: pending frames exceed the byte budget")
+	ErrRawIO           = errors.New("longpoll: raw io is not supported, use ReadFrame/WriteFrame")
+)
+
+// Addr 会话的地址
+type Addr string
+
+// Network implements net.Addr
+func (a Addr) Network() string { return "http" }
+
+func (a Addr) String() string { return string(a) }
+
+// outFrame 等待客户端确认的下行帧，data是按照tcp帧格式编码后的数据
+type outFrame struct {
+	seq  uint64
+	data []byte
+}
+
+// Session 一个http会话，实现了im.Conn
+//
+// 上行帧由POST请求写入，ReadFrame读取；下行帧由WriteFrame写入，Flush之后通过长轮询或者SSE发送给客户端。
+// 下行帧带有递增的序号，客户端确认之前一直保留，客户端换一个请求重新拉取时可以从上次确认的位置继续。
+type Session struct {
+	id     string
+	local  net.Addr
+	remote atomic.Value // net.Addr
+
+	lock       sync.Mutex
+	frames     []outFrame // 未确认的下行帧
+	seq        uint64     // 最后一个下行帧的序号
+	delivered  uint64     // 已经发送过至少一次的最大序号
+	size       int        // 未确认的下行帧的字节数
+	wake       chan struct{}
+	maxPending int
+	maxBytes   int
+
+	in        chan im.Frame
+	rdeadline time.Time
+	dlchange  chan struct{}
+
+	die  chan struct{}
+	once sync.Once
+	err  error
+
+	lastSeen int64 // unix nano of last request
+	polling  int32 // 正在等待下行帧的请求数
+}
+
+// newSession 未确认的下行帧最多maxPending个、maxBytes字节
+func newSession(id string, local, remote Addr, maxPending, maxBytes int) *Session {
+	s := &Session{
+		id:         id,
+		local:      local,
+		wake:       make(chan struct{}),
+		maxPending: maxPending,
+		maxBytes:   maxBytes,
+		in:         make(chan im.Frame, 64),
+		dlchange:   make(chan struct{}, 1),
+		die:        make(chan struct{}),
+		lastSeen:   time.Now().UnixNano(),
+	}
+	s.remote.Store(remote)
+	return s
+}
+
+// ID 会话ID
+func (s *Session) ID() string {
+	return s.id
+}
+
+// touch 记录客户端的最后一次请求，客户端切换网络之后更新远端地址
+func (s *Session) touch(remote Addr) {
+	atomic.StoreInt64(&s.lastSeen, time.Now().UnixNano())
+	s.remote.Store(remote)
+}
+
+func (s *Session) pollBegin() {
+	atomic.AddInt32(&s.polling, 1)
+}
+
+// pollEnd 请求结束时也算一次活动，会话保留时间从最后一个请求结束开始计算
+func (s *Session) pollEnd() {
+	atomic.StoreInt64(&s.lastSeen, time.Now().UnixNano())
+	atomic.AddInt32(&s.polling, -1)
+}
+
+// idle 没有正在等待的请求并且超过wait没有收到请求
+func (s *Session) idle(wait time.Duration) bool {
+	if atomic.LoadInt32(&s.polling) > 0 {
+		return false
+	}
+	return time.Since(time.Unix(0, atomic.LoadInt64(&s.lastSeen))) > wait
+}
+
+// ReadFrame 读取客户端POST上来的一个帧
+func (s *Session) ReadFrame() (im.Frame, error) {
+	for {
+		select {
+		case f := <-s.in:
+			return f, nil
+		default:
+		}
+		s.lock.Lock()
+		deadline := s.rdeadline
+		s.lock.Unlock()
+
+		f, err := s.wait(deadline)
+		if f != nil || err != nil {
+			return f, err
+		}
+	}
+}
+
+// wait 等待一个上行帧；读超时被修改时返回nil, nil
+func (s *Session) wait(deadline time.Time) (im.Frame, error) {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return nil, os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case f := <-s.in:
+		return f, nil
+	case <-s.die:
+		return nil, s.err
+	case <-timeout:
+		return nil, os.ErrDeadlineExceeded
+	case <-s.dlchange:
+		return nil, nil
+	}
+}
+
+// push 写入一个上行帧，队列满时阻塞，直到请求结束
+func (s *Session) push(ctx context.Context, f im.Frame) error {
+	select {
+	case s.in <- f:
+		return nil
+	case <-s.die:
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WriteFrame 写入下行缓冲区，调用Flush后才会通知等待中的请求
+func (s *Session) WriteFrame(code im.OpCode, payload []byte) error {
+	var buf bytes.Buffer
+	if err := tcp.WriteFrame(&buf, code, payload); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+	case <-s.die:
+		// 关闭帧允许在Close之前或者之后写入，其它帧在关闭之后直接丢弃
+		if code != im.OpClose {
+			return s.err
+		}
+	default:
+	}
+	data := buf.Bytes()
+	if len(s.frames) >= s.maxPending || s.size+len(data) > s.maxBytes {
+		// SSE不会逐个确认，丢弃已经发送过的帧
+		s.trim(s.delivered)
+		if len(s.frames) >= s.maxPending {
+			return ErrTooManyPending
+		}
+		if s.size+len(data) > s.maxBytes {
+			return ErrPendingTooLarge
+		}
+	}
+	s.seq++
+	s.frames = append(s.frames, outFrame{seq: s.seq, data: data})
+	s.size += len(data)
+	return nil
+}
+
+// Flush 唤醒等待下行帧的请求
+func (s *Session) Flush() error {
+	s.lock.Lock()
+	s.broadcast()
+	s.lock.Unlock()
+	return nil
+}
+
+// broadcast 在持有lock时调用
+func (s *Session) broadcast() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// ack 丢弃客户端已经确认的帧
+func (s *Session) ack(seq uint64) {
+	s.lock.Lock()
+	s.trim(seq)
+	s.lock.Unlock()
+}
+
+// trim 丢弃序号不大于seq的帧，在持有lock时调用
+func (s *Session) trim(seq uint64) {
+	i := 0
+	for i < len(s.frames) && s.frames[i].seq <= seq {
+		s.size -= len(s.frames[i].data)
+		s.frames[i] = outFrame{}
+		i++
+	}
+	s.frames = s.frames[i:]
+}
+
+// next 返回序号大于after的帧，最多limit字节；没有数据时返回等待的通道
+func (s *Session) next(after uint64, limit int) ([]outFrame, <-chan struct{}, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var frames []outFrame
+	size := 0
+	for _, f := range s.frames {
+		if f.seq <= after {
+			continue
+		}
+		if len(frames) > 0 && size+len(f.data) > limit {
+			break
+		}
+		frames = append(frames, f)
+		size += len(f.data)
+	}
+	if n := len(frames); n > 0 && frames[n-1].seq > s.delivered {
+		s.delivered = frames[n-1].seq
+	}
+	closed := false
+	select {
+	case <-s.die:
+		closed = true
+	default:
+	}
+	return frames, s.wake, closed
+}
+
+// drained 会话已经关闭并且所有的下行帧都已经被确认
+func (s *Session) drained() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+	case <-s.die:
+		return len(s.frames) == 0
+	default:
+		return false
+	}
+}
+
+func (s *Session) closeWith(err error) {
+	s.once.Do(func() {
+		s.lock.Lock()
+		s.err = err
+		close(s.die)
+		s.broadcast()
+		s.lock.Unlock()
+	})
+}
+
+// Close 关闭会话，已经写入的下行帧仍然可以被客户端拉取
+func (s *Session) Close() error {
+	s.closeWith(io.EOF)
+	return nil
+}
+
+// Read 不支持，使用ReadFrame
+func (s *Session) Read(b []byte) (int, error) {
+	return 0, ErrRawIO
+}
+
+// Write 不支持，使用WriteFrame
+func (s *Session) Write(b []byte) (int, error) {
+	return 0, ErrRawIO
+}
+
+// LocalAddr implements net.Conn
+func (s *Session) LocalAddr() net.Addr {
+	return s.local
+}
+
+// RemoteAddr 最后一次请求的客户端地址
+func (s *Session) RemoteAddr() net.Addr {
+	return s.remote.Load().(net.Addr)
+}
+
+// SetDeadline implements net.Conn
+func (s *Session) SetDeadline(t time.Time) error {
+	return s.SetReadDeadline(t)
+}
+
+// SetReadDeadline 设置ReadFrame的超时时间
+func (s *Session) SetReadDeadline(t time.Time) error {
+	s.lock.Lock()
+	s.rdeadline = t
+	s.lock.Unlock()
+	select {
+	case s.dlchange <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SetWriteDeadline 写入只是追加到缓冲区，不会阻塞
+func (s *Session) SetWriteDeadline(t time.Time) error {
+	return nil
+}
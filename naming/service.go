@@ -63,9 +63,13 @@ func (e *DefaultService) PublicPort() int { return e.Port }
 // Protocol Protocol
 func (e *DefaultService) GetProtocol() string { return e.Protocol }
 
+// DialURL unix和pipe的Address是socket路径或者名称，没有端口
 func (e *DefaultService) DialURL() string {
-	if e.Protocol == "tcp" {
+	switch e.Protocol {
+	case "tcp":
 		return fmt.Sprintf("%s:%d", e.Address, e.Port)
+	case "unix", "pipe":
+		return fmt.Sprintf("%s://%s", e.Protocol, e.Address)
 	}
 	return fmt.Sprintf("%s://%s:%d", e.Protocol, e.Address, e.Port)
 }
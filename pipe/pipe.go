@@ -0,0 +1,130 @@
+package pipe
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheme 地址前缀
+const Scheme = "pipe://"
+
+// errors
+var (
+	ErrAddressInUse = errors.New("pipe: address already in use")
+	ErrNoListener   = errors.New("pipe: connection refused")
+)
+
+// Addr 内存中的地址
+type Addr string
+
+// Network implements net.Addr
+func (a Addr) Network() string { return "pipe" }
+
+func (a Addr) String() string { return string(a) }
+
+var (
+	lock      sync.Mutex
+	listeners = make(map[string]*Listener)
+)
+
+func name(address string) string {
+	return strings.TrimPrefix(address, Scheme)
+}
+
+// Listener 进程内的监听器，Dial通过net.Pipe创建连接，实现了net.Listener
+type Listener struct {
+	addr    Addr
+	accepts chan net.Conn
+	die     chan struct{}
+	once    sync.Once
+}
+
+// Listen 在进程内监听一个名称，address可以是name或者pipe://name
+func Listen(address string) (net.Listener, error) {
+	addr := name(address)
+	lock.Lock()
+	defer lock.Unlock()
+	if _, ok := listeners[addr]; ok {
+		return nil, ErrAddressInUse
+	}
+	l := &Listener{
+		addr:    Addr(addr),
+		accepts: make(chan net.Conn),
+		die:     make(chan struct{}),
+	}
+	listeners[addr] = l
+	return l, nil
+}
+
+// Accept implements net.Listener
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accepts:
+		return conn, nil
+	case <-l.die:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close 关闭监听，已经建立的连接不受影响
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		close(l.die)
+		lock.Lock()
+		if listeners[string(l.addr)] == l {
+			delete(listeners, string(l.addr))
+		}
+		lock.Unlock()
+	})
+	return nil
+}
+
+// Addr implements net.Listener
+func (l *Listener) Addr() net.Addr {
+	return l.addr
+}
+
+// Dial 连接到进程内的监听器，timeout为0表示一直等待Accept
+func Dial(address string, timeout time.Duration) (net.Conn, error) {
+	addr := name(address)
+	lock.Lock()
+	l, ok := listeners[addr]
+	lock.Unlock()
+	if !ok {
+		return nil, ErrNoListener
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	server, client := net.Pipe()
+	select {
+	case l.accepts <- &conn{Conn: server, local: l.addr, remote: Addr("client")}:
+		return &conn{Conn: client, local: Addr("client"), remote: l.addr}, nil
+	case <-l.die:
+		return nil, ErrNoListener
+	case <-expired:
+		return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: l.addr, Err: errTimeout{}}
+	}
+}
+
+// conn net.Pipe的地址没有意义，替换成监听的名称
+type conn struct {
+	net.Conn
+	local  net.Addr
+	remote net.Addr
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.local }
+func (c *conn) RemoteAddr() net.Addr { return c.remote }
+
+type errTimeout struct{}
+
+func (errTimeout) Error() string   { return "i/o timeout" }
+func (errTimeout) Timeout() bool   { return true }
+func (errTimeout) Temporary() bool { return true }
@@ -0,0 +1,97 @@
+package pipe
+
+import (
+	"context"
+	"im"
+	"im/naming"
+	"im/tcp"
+	"net"
+	"testing"
+	"time"
+)
+
+type testDialer struct{}
+
+func (d *testDialer) DialAndHandshake(ctx im.DialerContext) (net.Conn, error) {
+	return Dial(ctx.Address, ctx.Timeout)
+}
+
+type echoListener struct{}
+
+func (echoListener) Receive(agent im.Agent, payload []byte) {
+	_ = agent.Push(payload)
+}
+
+type nopStateListener struct{}
+
+func (nopStateListener) Disconnect(string) error { return nil }
+
+func TestListenAndDial(t *testing.T) {
+	if _, err := Dial("pipe://nobody", time.Second); err != ErrNoListener {
+		t.Fatalf("unexpected error %v", err)
+	}
+	lst, err := Listen("pipe://test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Listen("test"); err != ErrAddressInUse {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err = Dial("test", time.Millisecond*10); err == nil {
+		t.Fatal("dial should timeout without Accept")
+	}
+	go func() {
+		conn, err := lst.Accept()
+		if err == nil {
+			_, _ = conn.Write([]byte("hi"))
+		}
+	}()
+	conn, err := Dial("test", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2)
+	if _, err = conn.Read(buf); err != nil || string(buf) != "hi" {
+		t.Fatalf("unexpected read %q %v", buf, err)
+	}
+	if conn.RemoteAddr().String() != "test" {
+		t.Fatalf("unexpected remote %s", conn.RemoteAddr())
+	}
+	_ = lst.Close()
+	if _, err = Listen("test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerAndClient(t *testing.T) {
+	srv := NewServer("gateway", naming.NewEntry("gateway", "gateway", "pipe", "gateway", 0))
+	srv.SetMessageListener(echoListener{})
+	srv.SetStateListener(nopStateListener{})
+	go func() { _ = srv.Start() }()
+	defer func() { _ = srv.Shutdown(context.Background()) }()
+
+	cli := NewClient("client", "client", tcp.ClientOptions{})
+	cli.SetDialer(new(testDialer))
+	var err error
+	for i := 0; i < 50; i++ {
+		if err = cli.Connect("pipe://gateway"); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if err = cli.Send([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := cli.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(frame.GetPayload()) != "hello" {
+		t.Fatalf("unexpected frame %q", frame.GetPayload())
+	}
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import "time"
+
+// Bucket 令牌桶，按照rate持续补充令牌，最多容纳burst个
+//
+// Bucket不是并发安全的，由Limiter加锁访问
+type Bucket struct {
+	rate   float64 // 每秒补充的令牌数
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket 创建一个装满令牌的桶
+func NewBucket(rate float64, burst int, now time.Time) *Bucket {
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// Allow 取走一个令牌，没有令牌时返回false
+func (b *Bucket) Allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Full 桶是否已经装满，装满的桶与新建的桶等价，可以被回收
+func (b *Bucket) Full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+func (b *Bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
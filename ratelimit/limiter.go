@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope 限流的维度
+type Scope int
+
+const (
+	// ScopeChannel 每个连接单独计数
+	ScopeChannel Scope = iota
+	// ScopeAccount 同一个账号的所有连接一起计数
+	ScopeAccount
+)
+
+// Rule 一条限流规则
+//
+// Command 可以是完整的指令如 chat.group.create，也可以是以 .* 结尾的前缀如 chat.*，
+// 单独的 * 匹配所有指令。一条指令匹配多条规则时，完整指令优先，其次是最长的前缀。
+type Rule struct {
+	Command string
+	Scope   Scope
+	Rate    float64 // 每秒允许的请求数
+	Burst   int     // 允许的突发请求数
+}
+
+func (r *Rule) match(command string) (int, bool) {
+	if r.Command == "*" {
+		return 0, true
+	}
+	if strings.HasSuffix(r.Command, ".*") {
+		prefix := r.Command[:len(r.Command)-1]
+		return len(prefix), strings.HasPrefix(command, prefix)
+	}
+	// 完整指令的优先级高于任何前缀
+	return len(command) + 1, r.Command == command
+}
+
+type bucketKey struct {
+	rule *Rule
+	key  string
+}
+
+// limiterShards 分片数量，必须是2的幂
+const limiterShards = 64
+
+type limiterShard struct {
+	sync.Mutex
+	buckets map[bucketKey]*Bucket
+	swept   time.Time
+}
+
+// Limiter 按照指令前缀，以连接或者账号为维度的令牌桶限流器
+//
+// 令牌桶按照key的hash分散到多个分片中，每个分片一把锁，回收时也只锁住一个分片
+type Limiter struct {
+	rules  []*Rule
+	shards []*limiterShard
+	now    func() time.Time
+}
+
+// sweepInterval 回收已经装满的令牌桶的间隔
+const sweepInterval = time.Minute
+
+// NewLimiter NewLimiter
+func NewLimiter(rules ...Rule) *Limiter {
+	l := &Limiter{
+		shards: make([]*limiterShard, limiterShards),
+		now:    time.Now,
+	}
+	for i := range rules {
+		rule := rules[i]
+		l.rules = append(l.rules, &rule)
+	}
+	now := l.now()
+	for i := range l.shards {
+		l.shards[i] = &limiterShard{
+			buckets: make(map[bucketKey]*Bucket),
+			swept:   now,
+		}
+	}
+	return l
+}
+
+// shard return the shard of key, fnv-1a
+func (l *Limiter) shard(key string) *limiterShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return l.shards[hash&(limiterShards-1)]
+}
+
+// Match 返回command匹配的规则，没有匹配时返回nil
+func (l *Limiter) Match(command string) *Rule {
+	var matched *Rule
+	priority := -1
+	for _, rule := range l.rules {
+		if p, ok := rule.match(command); ok && p > priority {
+			matched, priority = rule, p
+		}
+	}
+	return matched
+}
+
+// Allow 返回是否允许channel发送这个指令
+//
+// account 为空时ScopeAccount的规则按照channel计数
+func (l *Limiter) Allow(channel, account, command string) bool {
+	rule := l.Match(command)
+	if rule == nil {
+		return true
+	}
+	key := channel
+	if rule.Scope == ScopeAccount && account != "" {
+		key = account
+	}
+
+	shard := l.shard(key)
+	shard.Lock()
+	defer shard.Unlock()
+	now := l.now()
+	shard.sweep(now)
+	bucket, ok := shard.buckets[bucketKey{rule, key}]
+	if !ok {
+		bucket = NewBucket(rule.Rate, rule.Burst, now)
+		shard.buckets[bucketKey{rule, key}] = bucket
+	}
+	return bucket.Allow(now)
+}
+
+// sweep 回收已经装满的令牌桶，避免断开的连接一直占用内存
+func (s *limiterShard) sweep(now time.Time) {
+	if now.Sub(s.swept) < sweepInterval {
+		return
+	}
+	s.swept = now
+	for key, bucket := range s.buckets {
+		if bucket.Full(now) {
+			delete(s.buckets, key)
+		}
+	}
+}
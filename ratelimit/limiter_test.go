@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"bytes"
+	"im"
+	"im/wire/pkt"
+	"testing"
+	"time"
+)
+
+func TestLimiterMatch(t *testing.T) {
+	l := NewLimiter(
+		Rule{Command: "*", Rate: 100, Burst: 100},
+		Rule{Command: "chat.*", Rate: 10, Burst: 10},
+		Rule{Command: "chat.group.*", Rate: 5, Burst: 5},
+		Rule{Command: "chat.group.create", Rate: 1, Burst: 1},
+	)
+	cases := map[string]string{
+		"login.signin":      "*",
+		"chat.user.talk":    "chat.*",
+		"chat.group.talk":   "chat.group.*",
+		"chat.group.create": "chat.group.create",
+	}
+	for command, expect := range cases {
+		if rule := l.Match(command); rule == nil || rule.Command != expect {
+			t.Errorf("%s: expect rule %s, got %v", command, expect, rule)
+		}
+	}
+	if NewLimiter(Rule{Command: "chat.*"}).Match("login.signin") != nil {
+		t.Error("expect no rule matched")
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(
+		Rule{Command: "chat.*", Rate: 1, Burst: 2},
+		Rule{Command: "chat.group.create", Scope: ScopeAccount, Rate: 1, Burst: 1},
+	)
+	l.now = func() time.Time { return now }
+
+	for i, expect := range []bool{true, true, false} {
+		if l.Allow("ch1", "u1", "chat.user.talk") != expect {
+			t.Fatalf("request %d: expect %v", i, expect)
+		}
+	}
+	// 每个连接单独计数
+	if !l.Allow("ch2", "u1", "chat.user.talk") {
+		t.Fatal("expect ch2 allowed")
+	}
+	// 同一个账号的连接一起计数
+	if !l.Allow("ch1", "u1", "chat.group.create") || l.Allow("ch2", "u1", "chat.group.create") {
+		t.Fatal("expect account limited")
+	}
+
+	now = now.Add(time.Second)
+	if !l.Allow("ch1", "u1", "chat.user.talk") || l.Allow("ch1", "u1", "chat.user.talk") {
+		t.Fatal("expect one token refilled")
+	}
+
+	// 每个分片单独回收，ch2与u1所在分片中的令牌桶已经装满
+	now = now.Add(sweepInterval)
+	for _, key := range []string{"ch1", "ch2", "u1"} {
+		l.Allow(key, "", "chat.user.talk")
+	}
+	buckets := 0
+	for _, shard := range l.shards {
+		buckets += len(shard.buckets)
+	}
+	if buckets != 3 {
+		t.Fatalf("expect full buckets swept, got %d", buckets)
+	}
+}
+
+type testAgent struct {
+	id     string
+	pushed [][]byte
+	closed bool
+}
+
+func (a *testAgent) ID() string { return a.id }
+
+func (a *testAgent) Push(data []byte) error {
+	a.pushed = append(a.pushed, data)
+	return nil
+}
+
+func (a *testAgent) Close() error {
+	a.closed = true
+	return nil
+}
+
+type countListener struct {
+	count int
+}
+
+func (l *countListener) Receive(im.Agent, []byte) { l.count++ }
+
+func TestListener(t *testing.T) {
+	next := new(countListener)
+	l := NewListener(next, NewLimiter(Rule{Command: "chat.*", Rate: 0.001, Burst: 1}), WithDisconnect(2, time.Minute))
+	agent := &testAgent{id: "ch1"}
+
+	req := pkt.Marshal(pkt.New("chat.user.talk", pkt.WithSeq(7)))
+	l.Receive(agent, req)
+	l.Receive(agent, pkt.Marshal(pkt.New("login.signin")))
+	if next.count != 2 {
+		t.Fatalf("expect 2 packets received, got %d", next.count)
+	}
+
+	l.Receive(agent, req)
+	if next.count != 2 || len(agent.pushed) != 1 {
+		t.Fatalf("expect over-limit packet rejected")
+	}
+	resp, err := pkt.MustReadLogicPkt(bytes.NewReader(agent.pushed[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != pkt.Status_TooManyRequests || resp.Flag != pkt.Flag_Response || resp.Sequence != 7 {
+		t.Fatalf("unexpected response %v", resp)
+	}
+	if agent.closed {
+		t.Fatal("expect not disconnected yet")
+	}
+	l.Receive(agent, req)
+	if !agent.closed {
+		t.Fatal("expect disconnected")
+	}
+}
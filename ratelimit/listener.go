@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"im"
+	"im/logger"
+	"im/wire/pkt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrTooManyRequests 超限时回复给客户端的错误
+var ErrTooManyRequests = pkt.NewError(pkt.Status_TooManyRequests, "too many requests")
+
+// ListenerOptions ListenerOptions
+type ListenerOptions struct {
+	account    func(im.Agent) string
+	maxStrikes int
+	window     time.Duration
+}
+
+// ListenerOption ListenerOption
+type ListenerOption func(*ListenerOptions)
+
+// WithAccount 设置从连接中获取账号的方法，用于ScopeAccount的规则
+func WithAccount(account func(im.Agent) string) ListenerOption {
+	return func(lo *ListenerOptions) {
+		lo.account = account
+	}
+}
+
+// WithDisconnect 在window时间内超限maxStrikes次后断开连接
+func WithDisconnect(maxStrikes int, window time.Duration) ListenerOption {
+	return func(lo *ListenerOptions) {
+		lo.maxStrikes = maxStrikes
+		lo.window = window
+	}
+}
+
+type strike struct {
+	count int
+	since time.Time
+}
+
+// Listener 在消息交给MessageListener之前按照指令限流
+//
+// 超限的请求不会被处理，而是直接回复一个状态为TooManyRequests的响应。
+type Listener struct {
+	im.MessageListener
+	limiter *Limiter
+	options ListenerOptions
+	lock    sync.Mutex
+	strikes map[string]*strike
+	swept   time.Time
+}
+
+// NewListener NewListener
+func NewListener(listener im.MessageListener, limiter *Limiter, opts ...ListenerOption) *Listener {
+	l := &Listener{
+		MessageListener: listener,
+		limiter:         limiter,
+		strikes:         make(map[string]*strike),
+		swept:           time.Now(),
+	}
+	for _, opt := range opts {
+		opt(&l.options)
+	}
+	return l
+}
+
+// Receive 只解码包头，Body引用payload不会复制，payload原样交给下一个MessageListener
+func (l *Listener) Receive(agent im.Agent, payload []byte) {
+	packet, err := pkt.Unmarshal(payload)
+	if err != nil {
+		l.MessageListener.Receive(agent, payload)
+		return
+	}
+	req, ok := packet.(*pkt.LogicPkt)
+	if !ok {
+		l.MessageListener.Receive(agent, payload)
+		return
+	}
+	var account string
+	if l.options.account != nil {
+		account = l.options.account(agent)
+	}
+	if l.limiter.Allow(agent.ID(), account, req.Command) {
+		l.MessageListener.Receive(agent, payload)
+		return
+	}
+
+	log := logger.WithFields(logger.Fields{
+		"module":  "ratelimit",
+		"channel": agent.ID(),
+		"command": req.Command,
+	})
+	if l.strike(agent.ID()) {
+		log.Warn("too many requests, disconnect the channel")
+		if closer, ok := agent.(io.Closer); ok {
+			_ = closer.Close()
+		}
+		return
+	}
+	log.Debug("too many requests")
+	_ = agent.Push(pkt.Marshal(pkt.NewErrorResp(req, ErrTooManyRequests)))
+}
+
+// strike 记录一次超限，返回true表示需要断开连接
+func (l *Listener) strike(id string) bool {
+	if l.options.maxStrikes <= 0 {
+		return false
+	}
+	now := time.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if now.Sub(l.swept) >= sweepInterval {
+		l.swept = now
+		for key, s := range l.strikes {
+			if now.Sub(s.since) > l.options.window {
+				delete(l.strikes, key)
+			}
+		}
+	}
+	s, ok := l.strikes[id]
+	if !ok || now.Sub(s.since) > l.options.window {
+		s = &strike{since: now}
+		l.strikes[id] = s
+	}
+	s.count++
+	if s.count >= l.options.maxStrikes {
+		delete(l.strikes, id)
+		return true
+	}
+	return false
+}
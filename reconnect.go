@@ -0,0 +1,156 @@
+package im
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ClientState 客户端连接状态
+type ClientState int32
+
+const (
+	// ClientClosed 初始状态或者已关闭，可以再次调用Connect
+	ClientClosed ClientState = iota
+	ClientConnecting
+	ClientConnected
+	ClientReconnecting
+)
+
+func (s ClientState) String() string {
+	switch s {
+	case ClientClosed:
+		return "closed"
+	case ClientConnecting:
+		return "connecting"
+	case ClientConnected:
+		return "connected"
+	case ClientReconnecting:
+		return "reconnecting"
+	}
+	return "unknown"
+}
+
+// StateHandler 连接状态变化的回调
+type StateHandler func(ClientState)
+
+// ReconnectPolicy 断线重连策略，使用带抖动的指数退避
+type ReconnectPolicy struct {
+	MinBackoff  time.Duration // 第一次重试前的等待时间
+	MaxBackoff  time.Duration // 等待时间上限
+	Jitter      float64       // 随机抖动比例 0-1
+	MaxAttempts int           // 最大重试次数，0表示不限制
+	// Sequencer 不为nil时，重连成功后会重发未收到响应的请求
+	Sequencer Sequencer
+	// MaxPending 最多保留的未收到响应的请求数，超过时丢弃最早的；0表示DefaultMaxUnacked
+	MaxPending int
+}
+
+// DefaultMaxUnacked 默认最多保留的未收到响应的请求数
+const DefaultMaxUnacked = 1024
+
+// DefaultReconnectPolicy DefaultReconnectPolicy
+func DefaultReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		MinBackoff:  time.Millisecond * 500,
+		MaxBackoff:  time.Second * 30,
+		Jitter:      0.2,
+		MaxAttempts: 0,
+	}
+}
+
+// Backoff return wait duration before the attempt, attempt starts at 1
+func (p *ReconnectPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.MinBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		delta := float64(backoff) * p.Jitter
+		backoff += time.Duration(delta * (rand.Float64()*2 - 1))
+	}
+	if backoff < 0 {
+		return 0
+	}
+	return backoff
+}
+
+// Retry return true if the attempt is allowed
+func (p *ReconnectPolicy) Retry(attempt int) bool {
+	return p.MaxAttempts == 0 || attempt <= p.MaxAttempts
+}
+
+// Sequencer 从payload中解析请求与响应的序列号
+type Sequencer interface {
+	// Request 返回需要等待响应的请求的序列号
+	Request(payload []byte) (seq uint32, ok bool)
+	// Response 返回响应对应的请求序列号
+	Response(payload []byte) (seq uint32, ok bool)
+}
+
+// Unacked 记录已发送但还没有收到响应的请求，最多保留max个
+type Unacked struct {
+	sync.Mutex
+	seqs    Sequencer
+	max     int
+	pending []unacked
+}
+
+type unacked struct {
+	seq     uint32
+	payload []byte
+}
+
+// NewUnacked max为0时使用DefaultMaxUnacked
+func NewUnacked(seqs Sequencer, max int) *Unacked {
+	if max <= 0 {
+		max = DefaultMaxUnacked
+	}
+	return &Unacked{seqs: seqs, max: max}
+}
+
+// Sent 记录一个发出的请求，超过上限时丢弃最早的请求，返回丢弃的数量
+func (u *Unacked) Sent(payload []byte) (dropped int) {
+	seq, ok := u.seqs.Request(payload)
+	if !ok {
+		return 0
+	}
+	u.Lock()
+	defer u.Unlock()
+	if n := len(u.pending) + 1 - u.max; n > 0 {
+		dropped = n
+		u.pending = append(u.pending[:0], u.pending[n:]...)
+	}
+	u.pending = append(u.pending, unacked{seq: seq, payload: payload})
+	return dropped
+}
+
+// Received 收到响应后移除对应的请求
+func (u *Unacked) Received(payload []byte) {
+	seq, ok := u.seqs.Response(payload)
+	if !ok {
+		return
+	}
+	u.Lock()
+	defer u.Unlock()
+	for i, p := range u.pending {
+		if p.seq == seq {
+			u.pending = append(u.pending[:i], u.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// Pending 按发送顺序返回未收到响应的请求
+func (u *Unacked) Pending() [][]byte {
+	u.Lock()
+	defer u.Unlock()
+	arr := make([][]byte, len(u.pending))
+	for i, p := range u.pending {
+		arr[i] = p.payload
+	}
+	return arr
+}
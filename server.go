@@ -2,6 +2,7 @@ package im
 
 import (
 	"context"
+	"errors"
 	"net"
 	"time"
 )
@@ -22,6 +23,12 @@ const (
 	OpPong           OpCode = 0xa
 )
 
+// DefaultMaxFrameSize 默认最大帧长度
+const DefaultMaxFrameSize = 4 << 20
+
+// ErrFrameTooLarge 读到的帧超过了最大长度，连接应该被关闭
+var ErrFrameTooLarge = errors.New("frame is too large")
+
 // 定义了基础服务的抽象接口
 type Service interface {
 	ServiceID() string
@@ -57,6 +64,7 @@ type Server interface {
 type Conn interface {
 	net.Conn
 	ReadFrame() (Frame, error)
+	// WriteFrame 可能只写入缓冲区，需要调用Flush发送
 	WriteFrame(OpCode, []byte) error
 	Flush() error
 }
@@ -95,6 +103,8 @@ type DialerContext struct {
 	Name    string
 	Address string
 	Timeout time.Duration
+	// Upgrade 不为nil时，Dialer需要在建立连接之后、发送登录包之前调用，之后通过返回的连接读写，比如tcp的加密握手
+	Upgrade func(net.Conn) (net.Conn, error)
 }
 
 // Dialer Dialer
@@ -2,161 +2,52 @@ package tcp
 
 import (
 	"errors"
-	"fmt"
 	"im"
-	"im/logger"
-	"net/url"
-	"sync"
-	"sync/atomic"
-	"time"
+	"net"
 )
 
+// ErrNotSecure 设置了ServerKey，但是Dialer返回的连接没有完成加密握手
+var ErrNotSecure = errors.New("connection is not upgraded by the dialer")
+
+// ClientOptions ClientOptions
 type ClientOptions struct {
-	Heartbeat time.Duration //登陆超时
-	ReadWait  time.Duration //读超时
-	WriteWait time.Duration //写超时
+	im.ClientOptions
+	// ServerKey 服务端WithSecure对应的公钥，设置后Dialer需要在登录之前调用DialerContext.Upgrade完成密钥协商
+	ServerKey []byte
 }
 
+// Client tcp客户端，连接状态、心跳与重连由im.ClientImpl实现
 type Client struct {
-	sync.Mutex
-	im.Dialer
-	once    sync.Once
-	id      string
-	name    string
-	conn    im.Conn
-	state   int32
-	options ClientOptions
+	*im.ClientImpl
 }
 
 // NewClient NewClient
 func NewClient(id, name string, opts ClientOptions) im.Client {
-	if opts.WriteWait == 0 {
-		opts.WriteWait = im.DefaultWriteWait
-	}
-	if opts.ReadWait == 0 {
-		opts.ReadWait = im.DefaultReadWait
-	}
-	cli := &Client{
-		id:      id,
-		name:    name,
-		options: opts,
-	}
-	return cli
-}
-
-// ID return id
-func (c *Client) ID() string {
-	return c.id
-}
-
-// Name Name
-func (c *Client) Name() string {
-	return c.name
-}
-
-// Connect to server
-func (c *Client) Connect(addr string) error {
-	_, err := url.Parse(addr)
-	if err != nil {
-		return err
-	}
-	if !atomic.CompareAndSwapInt32(&c.state, 0, 1) {
-		return fmt.Errorf("client has connected")
-	}
-
-	rawconn, err := c.Dialer.DialAndHandshake(im.DialerContext{
-		Id:      c.id,
-		Name:    c.name,
-		Address: addr,
-		Timeout: im.DefaultLoginWait,
-	})
-	if err != nil {
-		atomic.CompareAndSwapInt32(&c.state, 1, 0)
-		return err
-	}
-	if rawconn == nil {
-		return fmt.Errorf("conn is nil")
-	}
-	c.conn = NewConn(rawconn)
-
-	if c.options.Heartbeat > 0 {
-		go func() {
-			err := c.heartbealoop()
-			if err != nil {
-				logger.WithField("module", "tcp.client").Warn("heartbealoop stopped - ", err)
-			}
-		}()
-	}
-	return nil
-}
-
-// SetDialer 设置握手逻辑
-func (c *Client) SetDialer(dialer im.Dialer) {
-	c.Dialer = dialer
-}
-
-// Send data to connection
-func (c *Client) Send(payload []byte) error {
-	if atomic.LoadInt32(&c.state) == 0 {
-		return fmt.Errorf("connection is nil")
-	}
-	c.Lock()
-	defer c.Unlock()
-	err := c.conn.SetWriteDeadline(time.Now().Add(c.options.WriteWait))
-	if err != nil {
-		return err
-	}
-	return c.conn.WriteFrame(im.OpBinary, payload)
-}
-
-// Close 关闭
-func (c *Client) Close() {
-	c.once.Do(func() {
-		if c.conn == nil {
-			return
+	options := opts.ClientOptions
+	secure := len(opts.ServerKey) > 0
+	if secure {
+		key := opts.ServerKey
+		options.Upgrade = func(rawconn net.Conn) (net.Conn, error) {
+			return ClientHandshake(rawconn, key, im.DefaultLoginWait)
 		}
-		// graceful close connection
-		_ = WriteFrame(c.conn, im.OpClose, nil)
-
-		c.conn.Close()
-		atomic.CompareAndSwapInt32(&c.state, 1, 0)
-	})
-}
-
-func (c *Client) Read() (im.Frame, error) {
-	if c.conn == nil {
-		return nil, errors.New("connection is nil")
-	}
-	if c.options.Heartbeat > 0 {
-		_ = c.conn.SetReadDeadline(time.Now().Add(c.options.ReadWait))
 	}
-	frame, err := c.conn.ReadFrame()
-	if err != nil {
-		return nil, err
+	wrap := func(rawconn net.Conn, opts im.ClientOptions) (im.Conn, error) {
+		return wrapConn(rawconn, opts, secure)
 	}
-	if frame.GetOpCode() == im.OpClose {
-		return nil, errors.New("remote side close the channel")
+	return &Client{
+		ClientImpl: im.NewClient(id, name, "tcp.client", wrap, options),
 	}
-	return frame, nil
 }
 
-func (c *Client) heartbealoop() error {
-	tick := time.NewTicker(c.options.Heartbeat)
-	for range tick.C {
-		// 发送一个ping的心跳包给服务端
-		if err := c.ping(); err != nil {
-			return err
-		}
+// wrapConn 复用Dialer返回的TcpConn，加密握手之后的连接只能是Upgrade返回的TcpConn
+func wrapConn(rawconn net.Conn, opts im.ClientOptions, secure bool) (im.Conn, error) {
+	conn, ok := rawconn.(*TcpConn)
+	if secure && (!ok || conn.wcipher == nil) {
+		return nil, ErrNotSecure
 	}
-	return nil
-}
-
-func (c *Client) ping() error {
-	logger.WithField("module", "tcp.client").Tracef("%s send ping to server", c.id)
-
-	err := c.conn.SetWriteDeadline(time.Now().Add(c.options.WriteWait))
-	if err != nil {
-		return err
+	if !ok {
+		conn = NewConn(rawconn)
 	}
-	return c.conn.WriteFrame(im.OpPing, nil)
+	conn.SetMaxFrameSize(opts.MaxFrameSize)
+	return conn, nil
 }
@@ -0,0 +1,113 @@
+package tcp
+
+import (
+	"im"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testDialer struct{}
+
+func (d *testDialer) DialAndHandshake(ctx im.DialerContext) (net.Conn, error) {
+	u, err := url.Parse(ctx.Address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, ctx.Timeout)
+	if err != nil || ctx.Upgrade == nil {
+		return conn, err
+	}
+	return ctx.Upgrade(conn)
+}
+
+// testSequencer payload[0] is the sequence, payload[1] is 0 for request and 1 for response
+type testSequencer struct{}
+
+func (testSequencer) Request(payload []byte) (uint32, bool) {
+	return uint32(payload[0]), payload[1] == 0
+}
+
+func (testSequencer) Response(payload []byte) (uint32, bool) {
+	return uint32(payload[0]), payload[1] == 1
+}
+
+func TestClientReconnect(t *testing.T) {
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lst.Close()
+
+	var lock sync.Mutex
+	var states []im.ClientState
+	cli := NewClient("test", "test", ClientOptions{ClientOptions: im.ClientOptions{
+		Reconnect: &im.ReconnectPolicy{
+			MinBackoff:  time.Millisecond * 10,
+			MaxBackoff:  time.Millisecond * 50,
+			MaxAttempts: 3,
+			Sequencer:   testSequencer{},
+		},
+		OnState: func(state im.ClientState) {
+			lock.Lock()
+			states = append(states, state)
+			lock.Unlock()
+		},
+	}})
+	cli.SetDialer(new(testDialer))
+
+	go func() {
+		// the first connection is closed without response
+		conn1, err := lst.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = NewConn(conn1).ReadFrame()
+		_ = conn1.Close()
+
+		// the request is resent after reconnected
+		conn2, err := lst.Accept()
+		if err != nil {
+			return
+		}
+		defer conn2.Close()
+		srv := NewConn(conn2)
+		frame, err := srv.ReadFrame()
+		if err != nil {
+			return
+		}
+		req := frame.GetPayload()
+		_ = srv.WriteFrame(im.OpBinary, []byte{req[0], 1})
+		_ = srv.Flush()
+		time.Sleep(time.Millisecond * 100)
+	}()
+
+	if err := cli.Connect("tcp://" + lst.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Send([]byte{7, 0}); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := cli.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := frame.GetPayload(); p[0] != 7 || p[1] != 1 {
+		t.Fatalf("unexpected response %v", p)
+	}
+	cli.Close()
+
+	expect := []im.ClientState{im.ClientConnecting, im.ClientConnected, im.ClientReconnecting, im.ClientConnected, im.ClientClosed}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(states) != len(expect) {
+		t.Fatalf("unexpected states %v", states)
+	}
+	for i := range expect {
+		if states[i] != expect[i] {
+			t.Fatalf("unexpected states %v", states)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package tcp
 
 import (
+	"bufio"
+	"github.com/gobwas/pool/pbufio"
 	"im"
 	"im/wire/endian"
 	"io"
 	"net"
+	"sync"
 )
 
 type Frame struct {
@@ -32,17 +35,33 @@ func (f *Frame) GetPayload() []byte {
 	return f.Payload
 }
 
+// TcpConn 写入时使用从pool中获取的bufio.Writer缓冲，Flush时一次写出并归还
 type TcpConn struct {
 	net.Conn
+	wlock        sync.Mutex
+	wr           *bufio.Writer
+	maxFrameSize uint32
+	// 完成ServerHandshake或者ClientHandshake之后设置
+	rcipher *cipherState
+	wcipher *cipherState
 }
 
 // NewConn NewConn
 func NewConn(conn net.Conn) *TcpConn {
 	return &TcpConn{
-		Conn: conn,
+		Conn:         conn,
+		maxFrameSize: im.DefaultMaxFrameSize,
 	}
 }
 
+// SetMaxFrameSize 设置最大帧长度，超过时ReadFrame返回im.ErrFrameTooLarge
+func (c *TcpConn) SetMaxFrameSize(size int) {
+	if size <= 0 {
+		return
+	}
+	c.maxFrameSize = uint32(size)
+}
+
 func (c *TcpConn) ReadFrame() (im.Frame, error) {
 	// 从 reader 中读取一个 uint8
 	opcode, err := endian.ReadUint8(c.Conn)
@@ -50,23 +69,101 @@ func (c *TcpConn) ReadFrame() (im.Frame, error) {
 		return nil, err
 	}
 	// 从 reader 中读取一个 []byte
-	payload, err := endian.ReadBytes(c.Conn)
+	payload, err := endian.ReadBytesLimit(c.Conn, c.frameLimit())
+	if err == endian.ErrTooLarge {
+		return nil, im.ErrFrameTooLarge
+	}
 	if err != nil {
 		return nil, err
 	}
+	return c.openFrame(opcode, payload)
+}
+
+// frameHeaderSize opcode以及payload的长度前缀
+const frameHeaderSize = 5
+
+// frameLimit 帧中payload的最大长度，加密时包括AEAD的overhead
+func (c *TcpConn) frameLimit() uint32 {
+	limit := c.maxFrameSize
+	if c.rcipher != nil {
+		limit += uint32(c.rcipher.aead.Overhead())
+	}
+	return limit
+}
+
+// parseFrame 从b的开头解析一个完整的帧，返回帧占用的长度
+//
+// 数据不完整时frame为nil，n为需要的总长度(帧头都不完整时为0)；返回的payload不引用b
+func (c *TcpConn) parseFrame(b []byte) (frame im.Frame, n int, err error) {
+	if len(b) < frameHeaderSize {
+		return nil, 0, nil
+	}
+	length := endian.Default.Uint32(b[1:])
+	if length > c.frameLimit() {
+		return nil, 0, im.ErrFrameTooLarge
+	}
+	n = frameHeaderSize + int(length)
+	if len(b) < n {
+		return nil, n, nil
+	}
+	payload := make([]byte, length)
+	copy(payload, b[frameHeaderSize:n])
+	frame, err = c.openFrame(b[0], payload)
+	return frame, n, err
+}
+
+// openFrame 完成加密握手后解密payload
+func (c *TcpConn) openFrame(opcode byte, payload []byte) (im.Frame, error) {
+	if c.rcipher != nil {
+		var err error
+		if payload, err = c.rcipher.open(opcode, payload); err != nil {
+			return nil, err
+		}
+	}
 	return &Frame{
 		OpCode:  im.OpCode(opcode),
 		Payload: payload,
 	}, nil
 }
 
+// WriteFrame 写入缓冲区，调用Flush后才会发送；完成加密握手后payload会被加密
 func (c *TcpConn) WriteFrame(code im.OpCode, payload []byte) error {
-	return WriteFrame(c.Conn, code, payload)
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	if c.wcipher != nil {
+		var err error
+		if payload, err = c.wcipher.seal(byte(code), payload); err != nil {
+			return err
+		}
+	}
+	if c.wr == nil {
+		c.wr = pbufio.GetWriter(c.Conn, im.DefaultWriteBufferSize)
+	}
+	return WriteFrame(c.wr, code, payload)
 }
 
-// Flush Flush
+// Flush 将缓冲区中的数据写到连接中，并将缓冲区归还到pool
 func (c *TcpConn) Flush() error {
-	return nil
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	if c.wr == nil {
+		return nil
+	}
+	err := c.wr.Flush()
+	pbufio.PutWriter(c.wr)
+	c.wr = nil
+	return err
+}
+
+// Close 关闭连接，未Flush的数据会被丢弃
+func (c *TcpConn) Close() error {
+	c.wlock.Lock()
+	if c.wr != nil {
+		pbufio.PutWriter(c.wr)
+		c.wr = nil
+	}
+	c.wlock.Unlock()
+	return c.Conn.Close()
 }
 
 // WriteFrame write a frame to w
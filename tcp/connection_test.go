@@ -0,0 +1,137 @@
+package tcp
+
+import (
+	"bytes"
+	"im"
+	"im/wire/endian"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+// countConn counts the Write calls(syscalls) on a net.Conn
+type countConn struct {
+	net.Conn
+	writes int64
+}
+
+func (c *countConn) Write(b []byte) (int, error) {
+	atomic.AddInt64(&c.writes, 1)
+	return c.Conn.Write(b)
+}
+
+func pipe(tb testing.TB) (net.Conn, net.Conn) {
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer lst.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := lst.Accept()
+		accepted <- conn
+	}()
+	cli, err := net.Dial("tcp", lst.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return cli, <-accepted
+}
+
+func TestTcpConnBatchWrite(t *testing.T) {
+	cli, srv := pipe(t)
+	defer cli.Close()
+	defer srv.Close()
+
+	counter := &countConn{Conn: cli}
+	conn := NewConn(counter)
+	for i := 0; i < 10; i++ {
+		if err := conn.WriteFrame(im.OpBinary, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if counter.writes != 0 {
+		t.Fatalf("frames should be buffered before Flush, got %d writes", counter.writes)
+	}
+	if err := conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if counter.writes != 1 {
+		t.Fatalf("expect 1 write, got %d", counter.writes)
+	}
+
+	reader := NewConn(srv)
+	for i := 0; i < 10; i++ {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.GetOpCode() != im.OpBinary || !bytes.Equal(frame.GetPayload(), []byte{byte(i)}) {
+			t.Fatalf("unexpected frame %d: %v", i, frame)
+		}
+	}
+}
+
+const benchBatch = 16
+
+var benchPayload = bytes.Repeat([]byte("x"), 128)
+
+func BenchmarkWriteFrameUnbuffered(b *testing.B) {
+	cli, srv := pipe(b)
+	defer cli.Close()
+	defer srv.Close()
+	go func() { _, _ = io.Copy(io.Discard, srv) }()
+
+	counter := &countConn{Conn: cli}
+	b.SetBytes(int64(len(benchPayload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := WriteFrame(counter, im.OpBinary, benchPayload); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(counter.writes)/float64(b.N), "writes/op")
+}
+
+func BenchmarkWriteFrameBuffered(b *testing.B) {
+	cli, srv := pipe(b)
+	defer cli.Close()
+	defer srv.Close()
+	go func() { _, _ = io.Copy(io.Discard, srv) }()
+
+	counter := &countConn{Conn: cli}
+	conn := NewConn(counter)
+	b.SetBytes(int64(len(benchPayload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := conn.WriteFrame(im.OpBinary, benchPayload); err != nil {
+			b.Fatal(err)
+		}
+		// writeloop flushes after draining a batch
+		if i%benchBatch == benchBatch-1 {
+			if err := conn.Flush(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	_ = conn.Flush()
+	b.ReportMetric(float64(counter.writes)/float64(b.N), "writes/op")
+}
+
+func TestTcpConnMaxFrameSize(t *testing.T) {
+	cli, srv := pipe(t)
+	defer cli.Close()
+	defer srv.Close()
+
+	// only the length prefix is sent, a 4GiB payload would be allocated without the limit
+	go func() {
+		_ = endian.WriteUint8(cli, uint8(im.OpBinary))
+		_ = endian.WriteUint32(cli, 0xffffffff)
+	}()
+	conn := NewConn(srv)
+	conn.SetMaxFrameSize(1024)
+	if _, err := conn.ReadFrame(); err != im.ErrFrameTooLarge {
+		t.Fatalf("expect ErrFrameTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,667 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"im"
+	"im/logger"
+	"im/naming"
+	"im/wire"
+	"io"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// poller 监听连接的可读事件，一次通知之后需要调用Rearm才会再次通知
+//
+// 注册时带上一个id，fd被新连接复用时用来过滤掉属于旧连接的事件
+type poller interface {
+	Add(fd int, id uint32) error
+	Rearm(fd int, id uint32) error
+	Remove(fd int) error
+	// Wait 等待最多msec毫秒，把可读事件追加到events中返回
+	Wait(events []pollEvent, msec int) ([]pollEvent, error)
+	Close() error
+}
+
+type pollEvent struct {
+	fd int
+	id uint32
+}
+
+// ErrReadloopNotSupported EpollServer的channel由server读取数据
+var ErrReadloopNotSupported = errors.New("readloop is driven by the epoll server")
+
+// errWouldBlock 连接中暂时没有可读的数据
+var errWouldBlock = errors.New("read would block")
+
+const (
+	// pollWaitMillis poller等待的超时时间，用于检查server是否已经关闭
+	pollWaitMillis = 100
+	// epollSweepInterval 检查空闲连接与发送心跳的间隔
+	epollSweepInterval = time.Second
+	// epollReadBufferSize 每次从连接中读取的数据量，没有未解析完的数据时缓冲区会被归还
+	epollReadBufferSize = 4096
+)
+
+// readBufPool 读缓冲区，空闲连接不持有缓冲区
+var readBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, epollReadBufferSize)
+		return &b
+	},
+}
+
+// EpollServer 基于epoll的tcp server，只支持linux
+//
+// 与Server使用相同的协议、Acceptor/MessageListener/StateListener以及ServerOption。
+// 登录完成之后连接不再占用协程：可读时由固定数量的worker以非阻塞的方式读取当前可读的数据，
+// 解析出完整的帧交给Dispatcher，不完整的数据保留在连接的缓冲区中，worker不会等待慢速的客户端；
+// 邮箱满时关闭连接而不是阻塞worker。
+// Push只写入连接的写队列，队列中有数据时才启动一个写协程写出，队列满时按照OverflowPolicy处理；
+// 空闲超时与心跳由一个协程统一检查。
+type EpollServer struct {
+	*Server
+	poller   poller
+	chopts   im.ChannelOptions
+	tasks    chan *epollChannel
+	fdlock   sync.RWMutex
+	channels map[int]*epollChannel
+	seq      uint32
+}
+
+// NewEpollServer NewEpollServer
+func NewEpollServer(listen string, service naming.ServiceRegistration, options ...ServerOption) im.Server {
+	srv := &EpollServer{
+		Server:   NewServer(listen, service, options...).(*Server),
+		channels: make(map[int]*epollChannel),
+		chopts: im.ChannelOptions{
+			QueueSize:      im.DefaultWriteQueueSize,
+			OverflowPolicy: im.OverflowBlock,
+			OverflowWait:   im.DefaultWriteWait,
+			Dispatcher:     im.DefaultDispatcher,
+		},
+	}
+	for _, opt := range srv.options.channel {
+		opt(&srv.chopts)
+	}
+	if srv.chopts.QueueSize <= 0 {
+		srv.chopts.QueueSize = im.DefaultWriteQueueSize
+	}
+	if srv.chopts.Dispatcher == nil {
+		srv.chopts.Dispatcher = im.DefaultDispatcher
+	}
+	if srv.options.workers <= 0 {
+		srv.options.workers = runtime.NumCPU()
+	}
+	return srv
+}
+
+// Start server
+func (s *EpollServer) Start() error {
+	if s.StateListener == nil {
+		return fmt.Errorf("StateListener is nil")
+	}
+	if s.Acceptor == nil {
+		s.Acceptor = new(defaultAcceptor)
+	}
+	var err error
+	s.poller, err = newPoller()
+	if err != nil {
+		return err
+	}
+	s.tasks = make(chan *epollChannel, s.options.workers)
+	for i := 0; i < s.options.workers; i++ {
+		go s.work()
+	}
+	go s.poll()
+	go s.sweep()
+	return s.listenAndAccept(s.serve)
+}
+
+// Shutdown Shutdown
+func (s *EpollServer) Shutdown(ctx context.Context) error {
+	err := s.Server.Shutdown(ctx)
+	// channel关闭时会从poller中移除，因此最后关闭poller
+	if s.poller != nil {
+		_ = s.poller.Close()
+	}
+	return err
+}
+
+// serve 完成登录之后把连接注册到poller中，登录阶段仍然占用一个协程
+func (s *EpollServer) serve(rawconn net.Conn, release func()) {
+	log := logger.WithFields(logger.Fields{
+		"module": "tcp.epoll",
+		"listen": s.listen,
+		"id":     s.ServiceID(),
+	})
+	conn := NewConn(rawconn)
+	conn.SetMaxFrameSize(s.options.maxframe)
+
+	hello, id, err := s.login(conn)
+	if err != nil {
+		log.Warnf("reject %s - %v", rawconn.RemoteAddr(), err)
+		s.reject(conn, err)
+		release()
+		return
+	}
+	raw, fd, err := socketFD(rawconn)
+	if err != nil {
+		log.Warnf("reject %s - %v", rawconn.RemoteAddr(), err)
+		s.reject(conn, err)
+		release()
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	channel := newEpollChannel(s, id, fd, atomic.AddUint32(&s.seq, 1), conn)
+	channel.version = hello.Version()
+	channel.raw = raw
+	channel.release = release
+	if err = s.addChannel(channel); err != nil {
+		s.reject(conn, err)
+		release()
+		return
+	}
+	s.fdlock.Lock()
+	s.channels[fd] = channel
+	s.fdlock.Unlock()
+	if err = s.poller.Add(fd, channel.pollID); err != nil {
+		log.Warnf("channel %s - %v", id, err)
+		_ = channel.Close()
+		return
+	}
+	log.Info("accept ", channel)
+}
+
+// socketFD return raw conn and fd of the connection
+func socketFD(conn net.Conn) (syscall.RawConn, int, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil, 0, fmt.Errorf("%T is not a syscall.Conn", conn)
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, 0, err
+	}
+	var fd int
+	err = raw.Control(func(f uintptr) {
+		fd = int(f)
+	})
+	return raw, fd, err
+}
+
+func (s *EpollServer) poll() {
+	log := logger.WithFields(logger.Fields{
+		"module": "tcp.epoll",
+		"id":     s.ServiceID(),
+	})
+	events := make([]pollEvent, 0, 1024)
+	for !s.quit.HasFired() {
+		var err error
+		events, err = s.poller.Wait(events[:0], pollWaitMillis)
+		if err != nil {
+			if !s.quit.HasFired() {
+				log.Error(err)
+			}
+			return
+		}
+		for _, ev := range events {
+			s.fdlock.RLock()
+			channel, ok := s.channels[ev.fd]
+			s.fdlock.RUnlock()
+			if !ok || channel.pollID != ev.id {
+				continue
+			}
+			select {
+			case s.tasks <- channel:
+			case <-s.quit.Done():
+				return
+			}
+		}
+	}
+}
+
+func (s *EpollServer) work() {
+	for {
+		select {
+		case channel := <-s.tasks:
+			s.read(channel)
+		case <-s.quit.Done():
+			return
+		}
+	}
+}
+
+// read 非阻塞地读取当前可读的数据，处理其中完整的帧，然后重新注册可读事件
+//
+// 连接中剩余的数据会立即再次触发；不完整的帧保留在缓冲区中等待下一次可读
+func (s *EpollServer) read(ch *epollChannel) {
+	log := logger.WithFields(logger.Fields{
+		"module": "tcp.epoll",
+		"id":     ch.id,
+	})
+	ch.rlock.Lock()
+	defer ch.rlock.Unlock()
+	if err := ch.fill(); err != nil {
+		if err == errWouldBlock {
+			ch.rearm()
+			return
+		}
+		log.Info(err)
+		_ = ch.Close()
+		return
+	}
+	for {
+		frame, err := ch.next()
+		if err != nil {
+			if err == im.ErrFrameTooLarge {
+				_ = ch.write(im.OpClose, []byte(err.Error()))
+			}
+			log.Info(err)
+			_ = ch.Close()
+			return
+		}
+		if frame == nil {
+			break
+		}
+		if !s.handle(ch, frame) {
+			return
+		}
+	}
+	ch.rearm()
+}
+
+// handle 处理一个完整的帧，返回false表示连接已经关闭
+func (s *EpollServer) handle(ch *epollChannel, frame im.Frame) bool {
+	log := logger.WithFields(logger.Fields{
+		"module": "tcp.epoll",
+		"id":     ch.id,
+	})
+	atomic.StoreInt64(&ch.active, time.Now().UnixNano())
+
+	switch frame.GetOpCode() {
+	case im.OpClose:
+		log.Info("remote side close the channel")
+		_ = ch.Close()
+		return false
+	case im.OpPing:
+		ch.control(im.OpPong)
+	case im.OpPong:
+	default:
+		if err := s.dispatch(ch, frame.GetPayload()); err != nil {
+			log.Warn(err)
+			_ = ch.Close()
+			return false
+		}
+	}
+	return true
+}
+
+// dispatch worker由所有连接共享，Dispatcher实现了TryDispatcher时邮箱满不会阻塞，
+// 而是关闭这个处理不过来的连接；其它Dispatcher需要保证Dispatch不会长时间阻塞
+func (s *EpollServer) dispatch(ch *epollChannel, payload []byte) error {
+	if d, ok := s.chopts.Dispatcher.(im.TryDispatcher); ok {
+		return d.TryDispatch(s.MessageListener, ch, payload)
+	}
+	return s.chopts.Dispatcher.Dispatch(s.MessageListener, ch, payload)
+}
+
+// sweep 关闭空闲超时的连接，开启了心跳时发送ping
+func (s *EpollServer) sweep() {
+	tick := time.NewTicker(epollSweepInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case now := <-tick.C:
+			s.Range(func(channel im.Channel) bool {
+				if ch, ok := channel.(*epollChannel); ok {
+					ch.check(now)
+				}
+				return true
+			})
+		case <-s.quit.Done():
+			return
+		}
+	}
+}
+
+// remove 从poller与map中移除channel，必须在关闭连接之前调用，避免fd被新连接复用
+func (s *EpollServer) remove(ch *epollChannel) {
+	_ = s.poller.Remove(ch.fd)
+	s.fdlock.Lock()
+	if s.channels[ch.fd] == ch {
+		delete(s.channels, ch.fd)
+	}
+	s.fdlock.Unlock()
+	// 被替换的channel已经不在map中，不能通知Disconnect
+	if s.RemoveChannel(ch) {
+		_ = s.Disconnect(ch.id)
+	}
+}
+
+// epollChannel 由EpollServer驱动的channel，没有读写协程
+type epollChannel struct {
+	*TcpConn
+	srv       *EpollServer
+	conn      *TcpConn
+	id        string
+	fd        int
+	pollID    uint32
+	raw       syscall.RawConn
+	release   func()
+	rlock     sync.Mutex // 同一时刻只有一个worker读取，锁只用于保证worker之间的可见性
+	rbuf      *[]byte    // 未解析完的数据，没有数据时为nil
+	wlock     sync.Mutex // Push与ping等写操作
+	qlock     sync.Mutex // 写队列
+	queue     []Frame
+	writing   bool          // 是否有写协程正在写出队列中的数据
+	space     chan struct{} // 写出一批数据后关闭，唤醒等待队列空位的Push
+	state     sync.Mutex    // rearm与Close互斥
+	closed    *im.Event
+	writeWait int64 // time.Duration, accessed atomically
+	readwait  int64 // time.Duration, accessed atomically
+	active    int64 // unix nano of last activity
+	pinged    int64 // unix nano of last ping, only used in sweep
+	version   wire.Version
+}
+
+func newEpollChannel(srv *EpollServer, id string, fd int, pollID uint32, conn *TcpConn) *epollChannel {
+	return &epollChannel{
+		TcpConn:   conn,
+		srv:       srv,
+		conn:      conn,
+		id:        id,
+		fd:        fd,
+		pollID:    pollID,
+		closed:    im.NewEvent(),
+		space:     make(chan struct{}),
+		writeWait: int64(srv.options.writewait),
+		readwait:  int64(srv.options.readwait),
+		active:    time.Now().UnixNano(),
+	}
+}
+
+// ID id
+func (ch *epollChannel) ID() string { return ch.id }
+
+// Version 登录时协商的版本
+func (ch *epollChannel) Version() wire.Version { return ch.version }
+
+// fill 从连接中读取当前可读的数据追加到缓冲区，不会阻塞
+func (ch *epollChannel) fill() error {
+	if ch.rbuf == nil {
+		ch.rbuf = readBufPool.Get().(*[]byte)
+	}
+	buf := *ch.rbuf
+	if len(buf) == cap(buf) {
+		buf = append(buf, make([]byte, epollReadBufferSize)...)[:len(buf)]
+	}
+	n, err := readNonblock(ch.raw, buf[len(buf):cap(buf)])
+	if err == nil && n == 0 {
+		err = io.EOF
+	}
+	*ch.rbuf = buf[:len(buf)+n]
+	if err != nil && (err != errWouldBlock || len(*ch.rbuf) == 0) {
+		ch.releaseBuffer()
+	}
+	return err
+}
+
+// next 从缓冲区中取出一个完整的帧，没有完整的帧时返回nil
+func (ch *epollChannel) next() (im.Frame, error) {
+	if ch.rbuf == nil {
+		return nil, nil
+	}
+	buf := *ch.rbuf
+	frame, n, err := ch.conn.parseFrame(buf)
+	if err != nil {
+		ch.releaseBuffer()
+		return nil, err
+	}
+	if frame == nil {
+		// 预留出整个帧的空间，避免大帧被多次扩容
+		if n > cap(buf) {
+			grown := make([]byte, len(buf), n)
+			copy(grown, buf)
+			*ch.rbuf = grown
+		}
+		if len(buf) == 0 {
+			ch.releaseBuffer()
+		}
+		return nil, nil
+	}
+	*ch.rbuf = append(buf[:0], buf[n:]...)
+	return frame, nil
+}
+
+// releaseBuffer 归还读缓冲区，扩容过的缓冲区不放回pool
+func (ch *epollChannel) releaseBuffer() {
+	if ch.rbuf == nil {
+		return
+	}
+	if cap(*ch.rbuf) == epollReadBufferSize {
+		*ch.rbuf = (*ch.rbuf)[:0]
+		readBufPool.Put(ch.rbuf)
+	}
+	ch.rbuf = nil
+}
+
+// Push 加入写队列，由写协程写出，调用者不会等待慢速的客户端
+//
+// 写队列满时按OverflowPolicy处理
+func (ch *epollChannel) Push(payload []byte) error {
+	if ch.closed.HasFired() {
+		return im.ErrChannelClosed
+	}
+	opts := ch.srv.chopts
+	var timeout <-chan time.Time
+	ch.qlock.Lock()
+	for len(ch.queue) >= opts.QueueSize {
+		switch opts.OverflowPolicy {
+		case im.OverflowDropNewest:
+			ch.qlock.Unlock()
+			return im.ErrChannelFull
+		case im.OverflowDisconnect:
+			ch.qlock.Unlock()
+			logger.WithFields(logger.Fields{
+				"module": "tcp.epoll",
+				"id":     ch.id,
+			}).Warn("write queue is full, close the slow consumer")
+			_ = ch.Close()
+			return im.ErrChannelFull
+		case im.OverflowDropOldest:
+			ch.queue = append(ch.queue[:0], ch.queue[1:]...)
+		default:
+			space := ch.space
+			ch.qlock.Unlock()
+			if timeout == nil {
+				timer := time.NewTimer(opts.OverflowWait)
+				defer timer.Stop()
+				timeout = timer.C
+			}
+			select {
+			case <-space:
+			case <-ch.closed.Done():
+				return im.ErrChannelClosed
+			case <-timeout:
+				return im.ErrChannelFull
+			}
+			ch.qlock.Lock()
+		}
+	}
+	ch.queue = append(ch.queue, Frame{OpCode: im.OpBinary, Payload: payload})
+	ch.startWriter()
+	return nil
+}
+
+// control 将ping/pong加入写队列，不受队列长度限制，worker与sweep协程不会被慢速的客户端阻塞
+func (ch *epollChannel) control(code im.OpCode) {
+	if ch.closed.HasFired() {
+		return
+	}
+	ch.qlock.Lock()
+	ch.queue = append(ch.queue, Frame{OpCode: code})
+	ch.startWriter()
+}
+
+// startWriter 调用时持有qlock，没有写协程时启动一个
+func (ch *epollChannel) startWriter() {
+	if ch.writing {
+		ch.qlock.Unlock()
+		return
+	}
+	ch.writing = true
+	ch.qlock.Unlock()
+	go ch.drain()
+}
+
+// drain 写协程，写出队列中的数据直到队列为空，空闲的连接不占用协程
+func (ch *epollChannel) drain() {
+	for {
+		ch.qlock.Lock()
+		batch := ch.queue
+		ch.queue = nil
+		if len(batch) == 0 {
+			ch.writing = false
+			ch.qlock.Unlock()
+			return
+		}
+		close(ch.space)
+		ch.space = make(chan struct{})
+		ch.qlock.Unlock()
+
+		if err := ch.writeBatch(batch); err != nil {
+			logger.WithFields(logger.Fields{
+				"module": "tcp.epoll",
+				"id":     ch.id,
+			}).Info(err)
+			ch.qlock.Lock()
+			ch.queue = nil
+			ch.writing = false
+			ch.qlock.Unlock()
+			_ = ch.Close()
+			return
+		}
+	}
+}
+
+func (ch *epollChannel) writeBatch(batch []Frame) error {
+	ch.wlock.Lock()
+	defer ch.wlock.Unlock()
+	_ = ch.conn.SetWriteDeadline(time.Now().Add(time.Duration(atomic.LoadInt64(&ch.writeWait))))
+	for _, frame := range batch {
+		if err := ch.conn.WriteFrame(frame.OpCode, frame.Payload); err != nil {
+			return err
+		}
+	}
+	return ch.conn.Flush()
+}
+
+func (ch *epollChannel) write(code im.OpCode, payload []byte) error {
+	ch.wlock.Lock()
+	defer ch.wlock.Unlock()
+	_ = ch.conn.SetWriteDeadline(time.Now().Add(time.Duration(atomic.LoadInt64(&ch.writeWait))))
+	if err := ch.conn.WriteFrame(code, payload); err != nil {
+		return err
+	}
+	return ch.conn.Flush()
+}
+
+// WriteFrame overwrite Conn
+func (ch *epollChannel) WriteFrame(code im.OpCode, payload []byte) error {
+	ch.wlock.Lock()
+	defer ch.wlock.Unlock()
+	return ch.conn.WriteFrame(code, payload)
+}
+
+// Flush overwrite Conn
+func (ch *epollChannel) Flush() error {
+	ch.wlock.Lock()
+	defer ch.wlock.Unlock()
+	return ch.conn.Flush()
+}
+
+func (ch *epollChannel) rearm() {
+	ch.state.Lock()
+	defer ch.state.Unlock()
+	if ch.closed.HasFired() {
+		return
+	}
+	if err := ch.srv.poller.Rearm(ch.fd, ch.pollID); err != nil {
+		go ch.Close()
+	}
+}
+
+// check 在sweep协程中调用
+func (ch *epollChannel) check(now time.Time) {
+	active := atomic.LoadInt64(&ch.active)
+	idle := now.Sub(time.Unix(0, active))
+	if idle > time.Duration(atomic.LoadInt64(&ch.readwait)) {
+		logger.WithField("module", "tcp.epoll").Infof("channel %s idle timeout", ch.id)
+		go ch.Close()
+		return
+	}
+	opts := ch.srv.chopts
+	if opts.Heartbeat <= 0 || idle < opts.Heartbeat {
+		return
+	}
+	// 上一个ping还没有收到响应
+	if active < ch.pinged {
+		if now.Sub(time.Unix(0, ch.pinged)) > opts.PongWait {
+			logger.WithField("module", "tcp.epoll").Infof("channel %s pong timeout", ch.id)
+			go ch.Close()
+		}
+		return
+	}
+	ch.pinged = now.UnixNano()
+	ch.control(im.OpPing)
+}
+
+// Close 关闭连接
+func (ch *epollChannel) Close() error {
+	ch.state.Lock()
+	defer ch.state.Unlock()
+	if !ch.closed.Fire() {
+		return nil
+	}
+	ch.srv.remove(ch)
+	ch.release()
+	return ch.conn.Close()
+}
+
+// Readloop 数据由EpollServer读取
+func (ch *epollChannel) Readloop(lst im.MessageListener) error {
+	return ErrReadloopNotSupported
+}
+
+// SetWriteWait 设置写超时
+func (ch *epollChannel) SetWriteWait(writeWait time.Duration) {
+	if writeWait == 0 {
+		return
+	}
+	atomic.StoreInt64(&ch.writeWait, int64(writeWait))
+}
+
+// SetReadWait 设置空闲超时
+func (ch *epollChannel) SetReadWait(readwait time.Duration) {
+	if readwait == 0 {
+		return
+	}
+	atomic.StoreInt64(&ch.readwait, int64(readwait))
+}
+
+// LastActive 最后一次收到数据的时间
+func (ch *epollChannel) LastActive() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&ch.active))
+}
+
+func (ch *epollChannel) String() string {
+	return fmt.Sprintf("channel %s(%v)", ch.id, ch.conn.RemoteAddr())
+}
@@ -0,0 +1,319 @@
+//go:build linux
+
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"im"
+	"im/naming"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEpollServer(t *testing.T) {
+	addr := freeAddr(t)
+	lst := testStateListener{disconnected: make(chan string, 4)}
+	dispatcher := im.NewShardedDispatcher(2, 16)
+	defer dispatcher.Close()
+	srv := NewEpollServer(addr, naming.NewEntry("test", "test", "tcp", "127.0.0.1", 0),
+		WithPollWorkers(2), WithChannelOptions(im.WithDispatcher(dispatcher)))
+	srv.SetStateListener(lst)
+	srv.SetMessageListener(echoListener{})
+	go func() { _ = srv.Start() }()
+	defer func() { _ = srv.Shutdown(context.Background()) }()
+
+	conn := dial(t, addr)
+	defer conn.Close()
+	cli := NewConn(conn)
+	_ = cli.SetReadDeadline(time.Now().Add(time.Second * 2))
+
+	// 多个帧一次写出，每个帧都需要被读取
+	for _, msg := range []string{"hello", "world"} {
+		_ = cli.WriteFrame(im.OpBinary, []byte(msg))
+	}
+	_ = cli.WriteFrame(im.OpPing, nil)
+	if err := cli.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{"hello", "world"} {
+		frame, err := cli.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.GetOpCode() == im.OpPong {
+			if frame, err = cli.ReadFrame(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if string(frame.GetPayload()) != expect {
+			t.Fatalf("expect %s, got %q", expect, frame.GetPayload())
+		}
+	}
+
+	_ = cli.WriteFrame(im.OpClose, nil)
+	_ = cli.Flush()
+	select {
+	case <-lst.disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("expect disconnect")
+	}
+}
+
+func TestEpollServerIdleTimeout(t *testing.T) {
+	addr := freeAddr(t)
+	lst := testStateListener{disconnected: make(chan string, 4)}
+	srv := NewEpollServer(addr, naming.NewEntry("test", "test", "tcp", "127.0.0.1", 0))
+	srv.SetStateListener(lst)
+	srv.SetMessageListener(nopListener{})
+	srv.SetReadWait(time.Millisecond * 500)
+	go func() { _ = srv.Start() }()
+	defer func() { _ = srv.Shutdown(context.Background()) }()
+
+	conn := dial(t, addr)
+	defer conn.Close()
+	select {
+	case <-lst.disconnected:
+	case <-time.After(time.Second * 3):
+		t.Fatal("expect idle connection closed")
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := NewConn(conn).ReadFrame(); err == nil {
+		t.Fatal("expect connection closed")
+	}
+}
+
+func TestEpollServerPartialFrames(t *testing.T) {
+	addr := freeAddr(t)
+	srv := NewEpollServer(addr, naming.NewEntry("test", "test", "tcp", "127.0.0.1", 0), WithPollWorkers(1))
+	srv.SetStateListener(testStateListener{})
+	srv.SetMessageListener(echoListener{})
+	go func() { _ = srv.Start() }()
+	defer func() { _ = srv.Shutdown(context.Background()) }()
+
+	// 只发送帧头的一部分，不能占用worker
+	for i := 0; i < 4; i++ {
+		slow := dial(t, addr)
+		defer slow.Close()
+		if _, err := slow.Write([]byte{byte(im.OpBinary)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn := dial(t, addr)
+	defer conn.Close()
+	var buf bytes.Buffer
+	payload := bytes.Repeat([]byte("a"), 10000)
+	_ = WriteFrame(&buf, im.OpBinary, payload)
+	frame := buf.Bytes()
+	start := time.Now()
+	// 一个帧分多次到达
+	for _, part := range [][]byte{frame[:3], frame[3:100], frame[100:]} {
+		if _, err := conn.Write(part); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+	resp, err := NewConn(conn).ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(resp.GetPayload(), payload) {
+		t.Fatalf("unexpected payload length %d", len(resp.GetPayload()))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("blocked by slow clients for %v", elapsed)
+	}
+}
+
+func TestEpollChannelOverflow(t *testing.T) {
+	addr := freeAddr(t)
+	pushed := make(chan error, 1)
+	srv := NewEpollServer(addr, naming.NewEntry("test", "test", "tcp", "127.0.0.1", 0),
+		WithChannelOptions(im.WithQueueSize(1), im.WithOverflowPolicy(im.OverflowDropNewest)))
+	srv.SetStateListener(testStateListener{})
+	srv.SetMessageListener(floodListener{pushed})
+	go func() { _ = srv.Start() }()
+	defer func() { _ = srv.Shutdown(context.Background()) }()
+
+	// 客户端不读取数据，写队列最终会满
+	conn := dial(t, addr)
+	defer conn.Close()
+	cli := NewConn(conn)
+	_ = cli.WriteFrame(im.OpBinary, []byte("flood"))
+	_ = cli.Flush()
+	select {
+	case err := <-pushed:
+		if err != im.ErrChannelFull {
+			t.Fatalf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second * 10):
+		t.Fatal("expect write queue full")
+	}
+}
+
+// floodListener pushes concurrently until the write queue is full
+type floodListener struct {
+	pushed chan error
+}
+
+func (l floodListener) Receive(agent im.Agent, _ []byte) {
+	payload := bytes.Repeat([]byte("x"), 64<<10)
+	for i := 0; i < 1000; i++ {
+		go func() {
+			if err := agent.Push(payload); err == im.ErrChannelFull {
+				select {
+				case l.pushed <- err:
+				default:
+				}
+			}
+		}()
+	}
+}
+
+// 客户端不读取数据时Push只写入队列，调用者不会被阻塞
+func TestEpollChannelPushNonBlocking(t *testing.T) {
+	addr := freeAddr(t)
+	elapsed := make(chan time.Duration, 1)
+	srv := NewEpollServer(addr, naming.NewEntry("test", "test", "tcp", "127.0.0.1", 0),
+		WithChannelOptions(im.WithQueueSize(1000), im.WithOverflowPolicy(im.OverflowDropNewest)))
+	srv.SetStateListener(testStateListener{})
+	srv.SetMessageListener(fanoutListener{elapsed})
+	go func() { _ = srv.Start() }()
+	defer func() { _ = srv.Shutdown(context.Background()) }()
+
+	conn := dial(t, addr)
+	defer conn.Close()
+	cli := NewConn(conn)
+	_ = cli.WriteFrame(im.OpBinary, []byte("fanout"))
+	_ = cli.Flush()
+	select {
+	case d := <-elapsed:
+		if d > time.Second {
+			t.Fatalf("push blocked by a slow consumer for %v", d)
+		}
+	case <-time.After(time.Second * 10):
+		t.Fatal("push blocked by a slow consumer")
+	}
+}
+
+// fanoutListener 写入远超过socket缓冲区的数据
+type fanoutListener struct {
+	elapsed chan time.Duration
+}
+
+func (l fanoutListener) Receive(agent im.Agent, _ []byte) {
+	payload := bytes.Repeat([]byte("x"), 64<<10)
+	start := time.Now()
+	for i := 0; i < 500; i++ {
+		_ = agent.Push(payload)
+	}
+	l.elapsed <- time.Since(start)
+}
+
+// blockListener 收到block之后阻塞，其它消息原样返回
+type blockListener struct {
+	release chan struct{}
+}
+
+func (l blockListener) Receive(agent im.Agent, payload []byte) {
+	if string(payload) == "block" {
+		<-l.release
+		return
+	}
+	_ = agent.Push(payload)
+}
+
+// 一个channel的邮箱满时关闭这个连接，poll worker不会被阻塞
+func TestEpollServerBlockedListener(t *testing.T) {
+	addr := freeAddr(t)
+	lst := testStateListener{disconnected: make(chan string, 4)}
+	dispatcher := im.NewShardedDispatcher(2, 1)
+	defer dispatcher.Close()
+	release := make(chan struct{})
+	defer close(release)
+	srv := NewEpollServer(addr, naming.NewEntry("test", "test", "tcp", "127.0.0.1", 0),
+		WithPollWorkers(1), WithChannelOptions(im.WithDispatcher(dispatcher)))
+	srv.SetStateListener(lst)
+	srv.SetMessageListener(blockListener{release})
+	go func() { _ = srv.Start() }()
+	defer func() { _ = srv.Shutdown(context.Background()) }()
+
+	slow := dial(t, addr)
+	defer slow.Close()
+	cli := NewConn(slow)
+	for i := 0; i < 10; i++ {
+		_ = cli.WriteFrame(im.OpBinary, []byte("block"))
+	}
+	if err := cli.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lst.disconnected:
+	case <-time.After(time.Second * 2):
+		t.Fatal("expect the blocked channel closed")
+	}
+
+	conn := dial(t, addr)
+	defer conn.Close()
+	cli = NewConn(conn)
+	_ = cli.WriteFrame(im.OpBinary, []byte("hello"))
+	_ = cli.Flush()
+	_ = cli.SetReadDeadline(time.Now().Add(time.Second * 2))
+	frame, err := cli.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(frame.GetPayload()) != "hello" {
+		t.Fatalf("unexpected frame %q", frame.GetPayload())
+	}
+}
+
+// EpollServer同样在登录之前完成密钥协商，客户端通过ServerKey开启加密
+func TestEpollServerSecure(t *testing.T) {
+	private, public, err := GenerateSecureKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := freeAddr(t)
+	srv := NewEpollServer(addr, naming.NewEntry("test", "test", "tcp", "127.0.0.1", 0), WithSecure(private))
+	srv.SetAcceptor(idAcceptor("u1"))
+	srv.SetStateListener(testStateListener{})
+	srv.SetMessageListener(echoListener{})
+	go func() { _ = srv.Start() }()
+	defer func() { _ = srv.Shutdown(context.Background()) }()
+	_ = dial(t, addr).Close()
+
+	cli := NewClient("u1", "test", ClientOptions{ServerKey: public})
+	cli.SetDialer(new(testDialer))
+	if err = cli.Connect("tcp://" + addr); err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if err = cli.Send([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := cli.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(frame.GetPayload()) != "hello" {
+		t.Fatalf("unexpected frame %q", frame.GetPayload())
+	}
+
+	// Dialer没有调用Upgrade时不能退化成明文
+	cli = NewClient("u2", "test", ClientOptions{ServerKey: public})
+	cli.SetDialer(plainDialer{})
+	if err = cli.Connect("tcp://" + addr); err != ErrNotSecure {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+type plainDialer struct{}
+
+func (plainDialer) DialAndHandshake(ctx im.DialerContext) (net.Conn, error) {
+	return net.Dial("tcp", strings.TrimPrefix(ctx.Address, "tcp://"))
+}
@@ -0,0 +1,56 @@
+package tcp
+
+import (
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// 地址前缀
+const (
+	SchemeTCP  = "tcp://"
+	SchemeUnix = "unix://"
+)
+
+// ParseAddress 返回地址的network，支持host:port、tcp://host:port、unix:///path/to/socket
+func ParseAddress(address string) (network, addr string) {
+	switch {
+	case strings.HasPrefix(address, SchemeUnix):
+		return "unix", strings.TrimPrefix(address, SchemeUnix)
+	case strings.HasPrefix(address, SchemeTCP):
+		return "tcp", strings.TrimPrefix(address, SchemeTCP)
+	}
+	return "tcp", address
+}
+
+// Listen 监听tcp地址或者unix socket，Server默认的ListenFunc
+//
+// 上一次进程退出时没有删除的socket文件会被删除
+func Listen(address string) (net.Listener, error) {
+	network, addr := ParseAddress(address)
+	if network == "unix" {
+		removeStaleSocket(addr)
+	}
+	return net.Listen(network, addr)
+}
+
+// removeStaleSocket 删除没有进程监听的socket文件
+func removeStaleSocket(path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return
+	}
+	_ = os.Remove(path)
+}
+
+// Dial 连接tcp地址或者unix socket，可以在Dialer中使用
+func Dial(address string, timeout time.Duration) (net.Conn, error) {
+	network, addr := ParseAddress(address)
+	return net.DialTimeout(network, addr, timeout)
+}
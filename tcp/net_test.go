@@ -0,0 +1,77 @@
+package tcp
+
+import (
+	"context"
+	"im"
+	"im/naming"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// echoListener push the payload back to the agent
+type echoListener struct{}
+
+func (echoListener) Receive(agent im.Agent, payload []byte) {
+	_ = agent.Push(payload)
+}
+
+func TestParseAddress(t *testing.T) {
+	cases := []struct {
+		address, network, addr string
+	}{
+		{"127.0.0.1:8000", "tcp", "127.0.0.1:8000"},
+		{"tcp://127.0.0.1:8000", "tcp", "127.0.0.1:8000"},
+		{"unix:///tmp/im.sock", "unix", "/tmp/im.sock"},
+		{"unix://@im", "unix", "@im"},
+	}
+	for _, c := range cases {
+		network, addr := ParseAddress(c.address)
+		if network != c.network || addr != c.addr {
+			t.Errorf("ParseAddress(%q) = %s %s", c.address, network, addr)
+		}
+	}
+}
+
+func TestServerUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "im.sock")
+	// 模拟上一次进程异常退出留下的socket文件
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	addr := "unix://" + path
+	srv := NewServer(addr, naming.NewEntry("test", "test", "unix", path, 0))
+	srv.SetAcceptor(idAcceptor("u1"))
+	srv.SetMessageListener(echoListener{})
+	srv.SetStateListener(testStateListener{})
+	go func() { _ = srv.Start() }()
+	defer func() { _ = srv.Shutdown(context.Background()) }()
+
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		if conn, err = Dial(addr, time.Second); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cli := NewConn(conn)
+	_ = cli.WriteFrame(im.OpBinary, []byte("hello"))
+	_ = cli.Flush()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	frame, err := cli.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(frame.GetPayload()) != "hello" {
+		t.Fatalf("unexpected frame %q", frame.GetPayload())
+	}
+}
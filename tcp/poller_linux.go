@@ -0,0 +1,76 @@
+//go:build linux
+
+package tcp
+
+import (
+	"golang.org/x/sys/unix"
+	"syscall"
+)
+
+// epoll 使用EPOLLONESHOT，fd可读后在Rearm之前不会再次通知，保证同一个连接同时只被一个worker读取
+type epoll struct {
+	fd     int
+	events []unix.EpollEvent
+}
+
+func newPoller() (poller, error) {
+	fd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	return &epoll{
+		fd:     fd,
+		events: make([]unix.EpollEvent, 1024),
+	}, nil
+}
+
+const epollEvents = unix.EPOLLIN | unix.EPOLLRDHUP | unix.EPOLLONESHOT
+
+// id 保存在epoll_data的高32位中
+func (e *epoll) Add(fd int, id uint32) error {
+	return unix.EpollCtl(e.fd, unix.EPOLL_CTL_ADD, fd, &unix.EpollEvent{Events: epollEvents, Fd: int32(fd), Pad: int32(id)})
+}
+
+func (e *epoll) Rearm(fd int, id uint32) error {
+	return unix.EpollCtl(e.fd, unix.EPOLL_CTL_MOD, fd, &unix.EpollEvent{Events: epollEvents, Fd: int32(fd), Pad: int32(id)})
+}
+
+func (e *epoll) Remove(fd int) error {
+	return unix.EpollCtl(e.fd, unix.EPOLL_CTL_DEL, fd, nil)
+}
+
+func (e *epoll) Wait(events []pollEvent, msec int) ([]pollEvent, error) {
+	n, err := unix.EpollWait(e.fd, e.events, msec)
+	if err == unix.EINTR {
+		return events, nil
+	}
+	if err != nil {
+		return events, err
+	}
+	for i := 0; i < n; i++ {
+		events = append(events, pollEvent{fd: int(e.events[i].Fd), id: uint32(e.events[i].Pad)})
+	}
+	return events, nil
+}
+
+func (e *epoll) Close() error {
+	return unix.Close(e.fd)
+}
+
+// readNonblock 读取fd中当前可读的数据，没有数据时返回errWouldBlock，不会阻塞
+func readNonblock(raw syscall.RawConn, b []byte) (n int, err error) {
+	cerr := raw.Read(func(fd uintptr) bool {
+		n, err = unix.Read(int(fd), b)
+		return true
+	})
+	if cerr != nil {
+		return 0, cerr
+	}
+	if err == unix.EAGAIN {
+		return 0, errWouldBlock
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n, err
+}
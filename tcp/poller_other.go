@@ -0,0 +1,16 @@
+//go:build !linux
+
+package tcp
+
+import (
+	"errors"
+	"syscall"
+)
+
+func newPoller() (poller, error) {
+	return nil, errors.New("epoll is only supported on linux")
+}
+
+func readNonblock(raw syscall.RawConn, b []byte) (int, error) {
+	return 0, errors.New("epoll is only supported on linux")
+}
@@ -0,0 +1,245 @@
+package tcp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"im/wire/endian"
+	"io"
+	"net"
+	"time"
+)
+
+// errors of the secure handshake
+var (
+	ErrHandshake        = errors.New("secure handshake failed")
+	ErrServerKey        = errors.New("server key mismatch")
+	ErrDecrypt          = errors.New("frame authentication failed")
+	ErrNonceExhausted   = errors.New("nonce exhausted")
+	errInvalidSecureKey = errors.New("invalid X25519 key")
+)
+
+// secureMagic 握手的第一个字节序列，同时表示协议版本
+var secureMagic = [4]byte{'I', 'M', 'S', '1'}
+
+const (
+	secureKeySize = 32
+	// client hello: magic + ephemeral
+	clientHelloSize = 4 + secureKeySize
+	// server hello: magic + ephemeral + static + finished
+	serverHelloSize = 4 + secureKeySize*2 + 16
+)
+
+// GenerateSecureKey 生成服务端的X25519静态密钥，公钥分发给客户端用于校验服务端
+func GenerateSecureKey() (private, public []byte, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key.Bytes(), key.PublicKey().Bytes(), nil
+}
+
+// WithSecure 在登录之前与客户端完成密钥协商，之后每一帧的payload都使用AES-GCM加密
+//
+// staticKey是服务端的X25519私钥，客户端可以预置对应的公钥来防止中间人。
+// Server与EpollServer都在登录阶段完成握手，客户端通过ClientOptions.ServerKey开启。
+func WithSecure(staticKey []byte) ServerOption {
+	return func(so *ServerOptions) {
+		so.secure = staticKey
+	}
+}
+
+// cipherState 一个方向的加密状态，nonce是递增的计数器，不在帧中传输
+type cipherState struct {
+	aead  cipher.AEAD
+	nonce [12]byte
+	count uint64
+}
+
+func newCipherState(key []byte) (*cipherState, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &cipherState{aead: aead}, nil
+}
+
+func (cs *cipherState) next() ([]byte, error) {
+	if cs.count == ^uint64(0) {
+		return nil, ErrNonceExhausted
+	}
+	endian.Default.PutUint64(cs.nonce[4:], cs.count)
+	cs.count++
+	return cs.nonce[:], nil
+}
+
+// seal opcode作为附加数据，防止被篡改
+func (cs *cipherState) seal(code byte, payload []byte) ([]byte, error) {
+	nonce, err := cs.next()
+	if err != nil {
+		return nil, err
+	}
+	return cs.aead.Seal(make([]byte, 0, len(payload)+cs.aead.Overhead()), nonce, payload, []byte{code}), nil
+}
+
+// open 在原来的切片上解密
+func (cs *cipherState) open(code byte, payload []byte) ([]byte, error) {
+	nonce, err := cs.next()
+	if err != nil {
+		return nil, err
+	}
+	plain, err := cs.aead.Open(payload[:0], nonce, payload, []byte{code})
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+// ServerHandshake 服务端完成密钥协商，成功后conn的帧都会被加密
+func ServerHandshake(conn *TcpConn, staticKey []byte, timeout time.Duration) error {
+	static, err := ecdh.X25519().NewPrivateKey(staticKey)
+	if err != nil {
+		return errInvalidSecureKey
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	hello := make([]byte, clientHelloSize)
+	if _, err = io.ReadFull(conn.Conn, hello); err != nil {
+		return err
+	}
+	if !bytes.Equal(hello[:4], secureMagic[:]) {
+		return ErrHandshake
+	}
+	peer, err := ecdh.X25519().NewPublicKey(hello[4:])
+	if err != nil {
+		return ErrHandshake
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	ee, err := ephemeral.ECDH(peer)
+	if err != nil {
+		return ErrHandshake
+	}
+	es, err := static.ECDH(peer)
+	if err != nil {
+		return ErrHandshake
+	}
+	transcript := make([]byte, 0, serverHelloSize+clientHelloSize)
+	transcript = append(transcript, hello...)
+	transcript = append(transcript, secureMagic[:]...)
+	transcript = append(transcript, ephemeral.PublicKey().Bytes()...)
+	transcript = append(transcript, static.PublicKey().Bytes()...)
+
+	read, write, err := secureKeys(ee, es, transcript, false)
+	if err != nil {
+		return err
+	}
+	// finished: 使用发送方向的第一个nonce加密空数据，客户端校验后才发送登录包
+	finished, err := write.seal(0, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = conn.Conn.Write(append(transcript[clientHelloSize:], finished...)); err != nil {
+		return err
+	}
+	conn.rcipher, conn.wcipher = read, write
+	return nil
+}
+
+// ClientHandshake 客户端完成密钥协商，返回加密的连接
+//
+// serverKey是预置的服务端公钥，为空时不校验服务端身份，只能防止被动窃听。
+func ClientHandshake(rawconn net.Conn, serverKey []byte, timeout time.Duration) (*TcpConn, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	_ = rawconn.SetDeadline(time.Now().Add(timeout))
+	defer rawconn.SetDeadline(time.Time{})
+
+	transcript := make([]byte, 0, serverHelloSize+clientHelloSize)
+	transcript = append(transcript, secureMagic[:]...)
+	transcript = append(transcript, ephemeral.PublicKey().Bytes()...)
+	if _, err = rawconn.Write(transcript); err != nil {
+		return nil, err
+	}
+	hello := make([]byte, serverHelloSize)
+	if _, err = io.ReadFull(rawconn, hello); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hello[:4], secureMagic[:]) {
+		return nil, ErrHandshake
+	}
+	peer, err := ecdh.X25519().NewPublicKey(hello[4 : 4+secureKeySize])
+	if err != nil {
+		return nil, ErrHandshake
+	}
+	staticKey := hello[4+secureKeySize : 4+secureKeySize*2]
+	if len(serverKey) > 0 && !hmac.Equal(serverKey, staticKey) {
+		return nil, ErrServerKey
+	}
+	static, err := ecdh.X25519().NewPublicKey(staticKey)
+	if err != nil {
+		return nil, ErrHandshake
+	}
+	ee, err := ephemeral.ECDH(peer)
+	if err != nil {
+		return nil, ErrHandshake
+	}
+	es, err := ephemeral.ECDH(static)
+	if err != nil {
+		return nil, ErrHandshake
+	}
+	transcript = append(transcript, hello[:4+secureKeySize*2]...)
+
+	read, write, err := secureKeys(ee, es, transcript, true)
+	if err != nil {
+		return nil, err
+	}
+	// 只有持有静态私钥的服务端才能算出相同的密钥
+	if _, err = read.open(0, hello[4+secureKeySize*2:]); err != nil {
+		return nil, ErrHandshake
+	}
+	conn := NewConn(rawconn)
+	conn.rcipher, conn.wcipher = read, write
+	return conn, nil
+}
+
+// secureKeys 从两次DH的结果以及握手记录中派生两个方向的密钥
+func secureKeys(ee, es, transcript []byte, client bool) (read, write *cipherState, err error) {
+	hash := sha256.Sum256(transcript)
+	extract := hmac.New(sha256.New, hash[:])
+	extract.Write(ee)
+	extract.Write(es)
+	prk := extract.Sum(nil)
+	expand := func(info string) []byte {
+		h := hmac.New(sha256.New, prk)
+		h.Write([]byte(info))
+		h.Write([]byte{1})
+		return h.Sum(nil)
+	}
+	c2s, err := newCipherState(expand("im tcp c2s"))
+	if err != nil {
+		return nil, nil, err
+	}
+	s2c, err := newCipherState(expand("im tcp s2c"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if client {
+		return s2c, c2s, nil
+	}
+	return c2s, s2c, nil
+}
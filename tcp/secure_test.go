@@ -0,0 +1,99 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"im"
+	"im/naming"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServerSecure(t *testing.T) {
+	private, public, err := GenerateSecureKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := freeAddr(t)
+	srv := NewServer(addr, naming.NewEntry("test", "test", "tcp", "127.0.0.1", 0), WithSecure(private))
+	srv.SetAcceptor(idAcceptor("u1"))
+	srv.SetMessageListener(echoListener{})
+	srv.SetStateListener(testStateListener{})
+	go func() { _ = srv.Start() }()
+	defer func() { _ = srv.Shutdown(context.Background()) }()
+
+	cli, err := ClientHandshake(dial(t, addr), public, time.Second*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	_ = cli.WriteFrame(im.OpBinary, []byte("hello"))
+	_ = cli.Flush()
+	_ = cli.SetReadDeadline(time.Now().Add(time.Second * 5))
+	frame, err := cli.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(frame.GetPayload()) != "hello" {
+		t.Fatalf("unexpected frame %q", frame.GetPayload())
+	}
+
+	// 预置的公钥不一致
+	_, other, _ := GenerateSecureKey()
+	if _, err = ClientHandshake(dial(t, addr), other, time.Second*5); err != ErrServerKey {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// record 记录写到连接上的数据
+type record struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (r *record) Write(b []byte) (int, error) {
+	r.buf.Write(b)
+	return r.Conn.Write(b)
+}
+
+func TestSecureFrames(t *testing.T) {
+	private, _, _ := GenerateSecureKey()
+	c1, c2 := net.Pipe()
+	server := NewConn(c2)
+	done := make(chan error, 1)
+	go func() { done <- ServerHandshake(server, private, time.Second*5) }()
+	rec := &record{Conn: c1}
+	cli, err := ClientHandshake(rec, nil, time.Second*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_ = cli.WriteFrame(im.OpBinary, []byte("secret"))
+		_ = cli.WriteFrame(im.OpPing, nil)
+		_ = cli.Flush()
+	}()
+	for _, want := range []string{"secret", ""} {
+		frame, err := server.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(frame.GetPayload()) != want {
+			t.Fatalf("unexpected frame %q", frame.GetPayload())
+		}
+	}
+	if bytes.Contains(rec.buf.Bytes(), []byte("secret")) {
+		t.Fatal("payload is not encrypted")
+	}
+
+	// 重放之前的帧
+	frames := rec.buf.Bytes()[clientHelloSize:]
+	go func() { _, _ = c1.Write(frames) }()
+	if _, err = server.ReadFrame(); err != ErrDecrypt {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -10,13 +10,96 @@ import (
 	"im/naming"
 	"net"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+// errors sent to the client as OpClose reasons when a connection is rejected
+var (
+	ErrTooManyConnections      = errors.New("too many connections")
+	ErrTooManyConnectionsPerIP = errors.New("too many connections from the same ip")
+	ErrTooManyLogins           = errors.New("too many concurrent logins")
+)
+
+// rejectWait accept循环中发送拒绝原因的写超时
+const rejectWait = time.Millisecond * 100
+
 type ServerOptions struct {
 	loginwait time.Duration //登陆超时
 	readwait  time.Duration //读超时
 	writewait time.Duration //读超时
+	channel   []im.ChannelOption
+	maxframe  int            //最大帧长度
+	maxconns  int            //最大连接数，0表示不限制
+	maxperip  int            //单个IP的最大连接数，0表示不限制
+	maxlogins int            //同时处于登录阶段的最大连接数，0表示不限制
+	login     im.LoginPolicy //重复登录的处理策略
+	workers   int            //EpollServer读取数据的协程数
+	listener  ListenFunc     //创建监听，默认使用Listen
+	secure    []byte         //传输层加密的静态私钥，为空时不加密
+}
+
+// ListenFunc 创建一个监听器，用于在其它流式传输上复用Server
+type ListenFunc func(address string) (net.Listener, error)
+
+// ServerOption ServerOption
+type ServerOption func(*ServerOptions)
+
+// WithMaxFrameSize set max size of a frame read from the connections
+func WithMaxFrameSize(size int) ServerOption {
+	return func(so *ServerOptions) {
+		so.maxframe = size
+	}
+}
+
+// WithMaxConnections limit the number of connections, including those in login phase
+func WithMaxConnections(max int) ServerOption {
+	return func(so *ServerOptions) {
+		so.maxconns = max
+	}
+}
+
+// WithMaxConnectionsPerIP limit the number of connections from a remote ip
+func WithMaxConnectionsPerIP(max int) ServerOption {
+	return func(so *ServerOptions) {
+		so.maxperip = max
+	}
+}
+
+// WithMaxConcurrentLogins limit the number of connections in login phase
+func WithMaxConcurrentLogins(max int) ServerOption {
+	return func(so *ServerOptions) {
+		so.maxlogins = max
+	}
+}
+
+// WithLoginPolicy set policy of duplicate login, default is im.LoginRejectNew
+func WithLoginPolicy(policy im.LoginPolicy) ServerOption {
+	return func(so *ServerOptions) {
+		so.login = policy
+	}
+}
+
+// WithPollWorkers set number of goroutines reading frames in EpollServer
+func WithPollWorkers(workers int) ServerOption {
+	return func(so *ServerOptions) {
+		so.workers = workers
+	}
+}
+
+// WithListenFunc set function to create the listener, default is Listen which accepts tcp and unix:// addresses
+func WithListenFunc(listen ListenFunc) ServerOption {
+	return func(so *ServerOptions) {
+		so.listener = listen
+	}
+}
+
+// WithChannelOptions set options of the channels created by the server
+func WithChannelOptions(opts ...im.ChannelOption) ServerOption {
+	return func(so *ServerOptions) {
+		so.channel = append(so.channel, opts...)
+	}
 }
 
 type Server struct {
@@ -30,88 +113,254 @@ type Server struct {
 	once    sync.Once
 	options ServerOptions
 	quit    *im.Event
+	lock    sync.Mutex
+	lst     net.Listener
+	conns   int32
+	ips     map[string]int
+	logins  chan struct{}
 }
 
-func NewServer(listen string, service naming.ServiceRegistration) im.Server {
-	return &Server{
+func NewServer(listen string, service naming.ServiceRegistration, options ...ServerOption) im.Server {
+	srv := &Server{
 		listen:              listen,
 		ServiceRegistration: service,
 		ChannelMap:          im.NewChannels(100),
 		quit:                im.NewEvent(),
+		ips:                 make(map[string]int),
 		options: ServerOptions{
 			loginwait: im.DefaultLoginWait,
 			readwait:  im.DefaultReadWait,
 			writewait: time.Second * 10,
+			maxframe:  im.DefaultMaxFrameSize,
 		},
 	}
+	for _, option := range options {
+		option(&srv.options)
+	}
+	return srv
 }
 
 // Start server
 func (s *Server) Start() error {
-	log := logger.WithFields(logger.Fields{
-		"module": "tcp.server",
-		"listen": s.listen,
-		"id":     s.ServiceID(),
-	})
-
 	if s.StateListener == nil {
 		return fmt.Errorf("StateListener is nil")
 	}
 	if s.Acceptor == nil {
 		s.Acceptor = new(defaultAcceptor)
 	}
+	return s.listenAndAccept(s.serve)
+}
 
-	lst, err := net.Listen("tcp", s.listen)
+// listenAndAccept 监听并接受连接，通过连接数限制的连接交给serve处理
+func (s *Server) listenAndAccept(serve func(net.Conn, func())) error {
+	log := logger.WithFields(logger.Fields{
+		"module": "tcp.server",
+		"listen": s.listen,
+		"id":     s.ServiceID(),
+	})
+
+	listen := s.options.listener
+	if listen == nil {
+		listen = Listen
+	}
+	lst, err := listen(s.listen)
 	if err != nil {
 		return err
 	}
+	s.lock.Lock()
+	s.lst = lst
+	s.lock.Unlock()
+	if s.options.maxlogins > 0 {
+		s.logins = make(chan struct{}, s.options.maxlogins)
+	}
 	log.Info("started")
+
+	var delay time.Duration
 	for {
 		rawconn, err := lst.Accept()
 		if err != nil {
-			rawconn.Close()
-			log.Warn(err)
+			if s.quit.HasFired() {
+				return fmt.Errorf("listen exited")
+			}
+			// 文件描述符耗尽等暂时性错误退避后重试
+			if retryable(err) {
+				delay = acceptBackoff(delay)
+				log.Warnf("accept error: %v; retrying in %v", err, delay)
+				select {
+				case <-time.After(delay):
+				case <-s.quit.Done():
+					return fmt.Errorf("listen exited")
+				}
+				continue
+			}
+			return err
+		}
+		delay = 0
+
+		release, err := s.admit(rawconn)
+		if err != nil {
+			log.Warnf("reject %s - %v", rawconn.RemoteAddr(), err)
+			// 在accept循环中同步发送拒绝原因，写超时很短，不为每个被拒绝的连接启动协程
+			rejectWithin(NewConn(rawconn), err, rejectWait)
 			continue
 		}
-		go func(rawconn net.Conn) {
-			conn := NewConn(rawconn)
+		go serve(rawconn, release)
+	}
+}
 
-			id, err := s.Accept(conn, s.options.loginwait)
-			if err != nil {
-				_ = conn.WriteFrame(im.OpClose, []byte(err.Error()))
-				conn.Close()
-				return
-			}
-			if _, ok := s.Get(id); ok {
-				log.Warnf("channel %s existed", id)
-				_ = conn.WriteFrame(im.OpClose, []byte("channelId is repeated"))
-				conn.Close()
-				return
-			}
+// retryable 资源暂时不足或者超时的accept错误
+func retryable(err error) bool {
+	if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) || errors.Is(err, syscall.ENOBUFS) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
 
-			channel := im.NewChannel(id, conn)
-			channel.SetReadWait(s.options.readwait)
-			channel.SetWriteWait(s.options.writewait)
+func acceptBackoff(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return 5 * time.Millisecond
+	}
+	delay *= 2
+	if delay > time.Second {
+		delay = time.Second
+	}
+	return delay
+}
 
-			s.Add(channel)
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
 
-			log.Info("accept ", channel)
-			err = channel.Readloop(s.MessageListener)
-			if err != nil {
-				log.Info(err)
-			}
-			s.Remove(channel.ID())
-			_ = s.Disconnect(channel.ID())
-			channel.Close()
-		}(rawconn)
+// admit 检查连接数限制，通过后返回的release需要在连接关闭后调用
+//
+// ip在admit时记录下来，udp等传输的远端地址在连接过程中可能会变化
+func (s *Server) admit(rawconn net.Conn) (func(), error) {
+	if n := atomic.AddInt32(&s.conns, 1); s.options.maxconns > 0 && int(n) > s.options.maxconns {
+		atomic.AddInt32(&s.conns, -1)
+		return nil, ErrTooManyConnections
+	}
+	ip := remoteIP(rawconn)
+	if s.options.maxperip > 0 {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.ips[ip] >= s.options.maxperip {
+			atomic.AddInt32(&s.conns, -1)
+			return nil, ErrTooManyConnectionsPerIP
+		}
+		s.ips[ip]++
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { s.release(ip) })
+	}, nil
+}
+
+func (s *Server) release(ip string) {
+	atomic.AddInt32(&s.conns, -1)
+	if s.options.maxperip > 0 {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.ips[ip] <= 1 {
+			delete(s.ips, ip)
+		} else {
+			s.ips[ip]--
+		}
+	}
+}
 
+// reject 发送OpClose告知拒绝原因，然后关闭连接
+func (s *Server) reject(conn *TcpConn, reason error) {
+	rejectWithin(conn, reason, s.options.writewait)
+}
+
+func rejectWithin(conn *TcpConn, reason error, wait time.Duration) {
+	_ = conn.SetWriteDeadline(time.Now().Add(wait))
+	_ = conn.WriteFrame(im.OpClose, []byte(reason.Error()))
+	_ = conn.Flush()
+	conn.Close()
+}
+
+// login 限制登录阶段的并发数，开启加密时先完成密钥协商，然后回调Acceptor完成握手
+//
+// Acceptor读取的第一个帧是hello时先完成版本协商，返回的HelloConn记录了协商的版本
+func (s *Server) login(conn *TcpConn) (*im.HelloConn, string, error) {
+	if s.logins != nil {
 		select {
-		case <-s.quit.Done():
-			return fmt.Errorf("listen exited")
+		case s.logins <- struct{}{}:
+			defer func() { <-s.logins }()
 		default:
+			return nil, "", ErrTooManyLogins
+		}
+	}
+	if len(s.options.secure) > 0 {
+		if err := ServerHandshake(conn, s.options.secure, s.options.loginwait); err != nil {
+			return nil, "", err
 		}
 	}
+	hello := im.NewHelloConn(conn, s.options.writewait)
+	id, err := s.Accept(hello, s.options.loginwait)
+	return hello, id, err
+}
 
+// addChannel 按照登录策略添加channel，被替换的旧channel会被踢下线
+func (s *Server) addChannel(channel im.Channel) error {
+	log := logger.WithFields(logger.Fields{
+		"module": "tcp.server",
+		"id":     s.ServiceID(),
+	})
+	old, err := im.AddChannel(s.ChannelMap, channel, s.options.login)
+	if err != nil {
+		log.Warnf("channel %s - %v", channel.ID(), err)
+		return err
+	}
+	if old != nil {
+		log.Infof("channel %s is replaced, kickout %v", channel.ID(), old.RemoteAddr())
+		go im.Kickout(old, s.options.writewait)
+	}
+	return nil
+}
+
+func (s *Server) serve(rawconn net.Conn, release func()) {
+	defer release()
+	log := logger.WithFields(logger.Fields{
+		"module": "tcp.server",
+		"listen": s.listen,
+		"id":     s.ServiceID(),
+	})
+	conn := NewConn(rawconn)
+	conn.SetMaxFrameSize(s.options.maxframe)
+
+	hello, id, err := s.login(conn)
+	if err != nil {
+		log.Warnf("reject %s - %v", rawconn.RemoteAddr(), err)
+		s.reject(conn, err)
+		return
+	}
+	channel := im.NewChannel(id, hello, s.options.channel...)
+	channel.SetReadWait(s.options.readwait)
+	channel.SetWriteWait(s.options.writewait)
+
+	if err = s.addChannel(channel); err != nil {
+		s.reject(conn, err)
+		channel.Close()
+		return
+	}
+
+	log.Info("accept ", channel)
+	err = channel.Readloop(s.MessageListener)
+	if err != nil {
+		log.Info(err)
+	}
+	// 被替换的channel已经不在map中，不能通知Disconnect
+	if s.RemoveChannel(channel) {
+		_ = s.Disconnect(channel.ID())
+	}
+	channel.Close()
 }
 
 // Shutdown Shutdown
@@ -124,6 +373,12 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		defer func() {
 			log.Infoln("shutdown")
 		}()
+		s.quit.Fire()
+		s.lock.Lock()
+		if s.lst != nil {
+			_ = s.lst.Close()
+		}
+		s.lock.Unlock()
 		// close channels
 		chanels := s.ChannelMap.All()
 		for _, ch := range chanels {
@@ -146,7 +401,7 @@ func (s *Server) Shutdown(ctx context.Context) error {
 func (s *Server) Push(id string, data []byte) error {
 	ch, ok := s.ChannelMap.Get(id)
 	if !ok {
-		return errors.New("channel no found")
+		return im.ErrChannelNotFound
 	}
 	return ch.Push(data)
 }
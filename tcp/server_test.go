@@ -0,0 +1,210 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"im"
+	"im/naming"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type testStateListener struct {
+	disconnected chan string
+}
+
+func (l testStateListener) Disconnect(id string) error {
+	if l.disconnected != nil {
+		l.disconnected <- id
+	}
+	return nil
+}
+
+// blockAcceptor 阻塞在登录阶段，直到release被关闭
+type blockAcceptor struct {
+	release chan struct{}
+}
+
+func (a *blockAcceptor) Accept(conn im.Conn, timeout time.Duration) (string, error) {
+	<-a.release
+	return "", im.ErrFrameTooLarge
+}
+
+type idAcceptor string
+
+func (a idAcceptor) Accept(conn im.Conn, timeout time.Duration) (string, error) {
+	return string(a), nil
+}
+
+func dial(t *testing.T, addr string) net.Conn {
+	var conn net.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			return conn
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal(err)
+	return nil
+}
+
+func freeAddr(t *testing.T) string {
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lst.Close()
+	return lst.Addr().String()
+}
+
+func TestServerConnectionLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		option ServerOption
+		reason error
+	}{
+		{"max connections", WithMaxConnections(1), ErrTooManyConnections},
+		{"max connections per ip", WithMaxConnectionsPerIP(1), ErrTooManyConnectionsPerIP},
+		{"max concurrent logins", WithMaxConcurrentLogins(1), ErrTooManyLogins},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addr := freeAddr(t)
+			acceptor := &blockAcceptor{release: make(chan struct{})}
+			srv := NewServer(addr, naming.NewEntry("test", "test", "tcp", "127.0.0.1", 0), c.option)
+			srv.SetAcceptor(acceptor)
+			srv.SetStateListener(testStateListener{})
+			go func() { _ = srv.Start() }()
+			defer func() { _ = srv.Shutdown(context.Background()) }()
+			defer close(acceptor.release)
+
+			first := dial(t, addr)
+			defer first.Close()
+			// 等待第一个连接进入登录阶段
+			time.Sleep(time.Millisecond * 50)
+
+			second, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer second.Close()
+			_ = second.SetReadDeadline(time.Now().Add(time.Second))
+			frame, err := NewConn(second).ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frame.GetOpCode() != im.OpClose || string(frame.GetPayload()) != c.reason.Error() {
+				t.Fatalf("unexpected frame %d %q", frame.GetOpCode(), frame.GetPayload())
+			}
+		})
+	}
+}
+
+type nopListener struct{}
+
+func (nopListener) Receive(im.Agent, []byte) {}
+
+func TestServerLoginReplaceOld(t *testing.T) {
+	addr := freeAddr(t)
+	lst := testStateListener{disconnected: make(chan string, 2)}
+	srv := NewServer(addr, naming.NewEntry("test", "test", "tcp", "127.0.0.1", 0), WithLoginPolicy(im.LoginReplaceOld))
+	srv.SetAcceptor(idAcceptor("u1"))
+	srv.SetStateListener(lst)
+	srv.SetMessageListener(nopListener{})
+	go func() { _ = srv.Start() }()
+	defer func() { _ = srv.Shutdown(context.Background()) }()
+
+	first := dial(t, addr)
+	defer first.Close()
+	time.Sleep(time.Millisecond * 50)
+	second := dial(t, addr)
+	defer second.Close()
+
+	_ = first.SetReadDeadline(time.Now().Add(time.Second))
+	frame, err := NewConn(first).ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.GetOpCode() != im.OpClose || string(frame.GetPayload()) != im.ErrKickout.Error() {
+		t.Fatalf("unexpected frame %d %q", frame.GetOpCode(), frame.GetPayload())
+	}
+	select {
+	case id := <-lst.disconnected:
+		t.Fatalf("unexpected disconnect of %s", id)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	second.Close()
+	select {
+	case <-lst.disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("expect disconnect of the second channel")
+	}
+}
+
+// flakyListener Accept先返回若干次err
+type flakyListener struct {
+	net.Listener
+	errs chan error
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	select {
+	case err := <-l.errs:
+		return nil, err
+	default:
+		return l.Listener.Accept()
+	}
+}
+
+// EMFILE等暂时性错误退避后继续accept，其它错误退出
+func TestServerAcceptRetry(t *testing.T) {
+	if !retryable(&net.OpError{Op: "accept", Err: os.NewSyscallError("accept4", syscall.EMFILE)}) {
+		t.Fatal("EMFILE should be retried")
+	}
+	if !retryable(fmt.Errorf("accept: %w", syscall.ENFILE)) {
+		t.Fatal("ENFILE should be retried")
+	}
+	if retryable(net.ErrClosed) {
+		t.Fatal("closed listener should not be retried")
+	}
+
+	addr := freeAddr(t)
+	errs := make(chan error, 2)
+	errs <- &net.OpError{Op: "accept", Err: os.NewSyscallError("accept4", syscall.EMFILE)}
+	errs <- &net.OpError{Op: "accept", Err: os.NewSyscallError("accept4", syscall.ENFILE)}
+	srv := NewServer(addr, naming.NewEntry("test", "test", "tcp", "127.0.0.1", 0),
+		WithMaxConnections(1),
+		WithListenFunc(func(address string) (net.Listener, error) {
+			lst, err := Listen(address)
+			if err != nil {
+				return nil, err
+			}
+			return &flakyListener{Listener: lst, errs: errs}, nil
+		}))
+	acceptor := &blockAcceptor{release: make(chan struct{})}
+	srv.SetAcceptor(acceptor)
+	srv.SetStateListener(testStateListener{})
+	go func() { _ = srv.Start() }()
+	defer func() { _ = srv.Shutdown(context.Background()) }()
+	defer close(acceptor.release)
+
+	first := dial(t, addr)
+	defer first.Close()
+	time.Sleep(time.Millisecond * 50)
+	// 被拒绝的连接在accept循环中同步关闭
+	second := dial(t, addr)
+	defer second.Close()
+	_ = second.SetReadDeadline(time.Now().Add(time.Second))
+	frame, err := NewConn(second).ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.GetOpCode() != im.OpClose || string(frame.GetPayload()) != ErrTooManyConnections.Error() {
+		t.Fatalf("unexpected frame %d %q", frame.GetOpCode(), frame.GetPayload())
+	}
+}
@@ -0,0 +1,162 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"im"
+	"im/naming"
+	"im/wire"
+	"im/wire/pkt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// loginAcceptor 读取登录包，按照连接协商的版本回复
+type loginAcceptor struct{}
+
+func (loginAcceptor) Accept(conn im.Conn, timeout time.Duration) (string, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	frame, err := conn.ReadFrame()
+	if err != nil {
+		return "", err
+	}
+	req, err := pkt.MustReadLogicPkt(bytes.NewReader(frame.GetPayload()))
+	if err != nil {
+		return "", err
+	}
+	resp := pkt.NewFrom(&req.Header)
+	resp.Flag = pkt.Flag_Response
+	resp.Version = im.VersionOf(conn)
+	_ = conn.WriteFrame(im.OpBinary, pkt.Marshal(resp))
+	return req.ChannelId, conn.Flush()
+}
+
+// versionHandler 回复收到的请求的版本，响应按照channel协商的版本编码
+func versionHandler(agent im.Agent, req *pkt.LogicPkt) error {
+	resp := pkt.NewFrom(&req.Header)
+	resp.Flag = pkt.Flag_Response
+	if err := resp.WriteBody(&pkt.MessageResp{MessageId: int64(req.Version)}); err != nil {
+		return err
+	}
+	return im.PushPacket(agent, resp)
+}
+
+// loginDialer 在Upgrade之后发送原始格式的登录包
+type loginDialer struct{}
+
+func (loginDialer) DialAndHandshake(ctx im.DialerContext) (net.Conn, error) {
+	u, err := url.Parse(ctx.Address)
+	if err != nil {
+		return nil, err
+	}
+	rawconn, err := net.DialTimeout("tcp", u.Host, ctx.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Upgrade != nil {
+		if rawconn, err = ctx.Upgrade(rawconn); err != nil {
+			return nil, err
+		}
+	}
+	conn, ok := rawconn.(im.Conn)
+	if !ok {
+		conn = NewConn(rawconn)
+	}
+	if err = login(conn, ctx.Id); err != nil {
+		return nil, err
+	}
+	return rawconn, nil
+}
+
+func login(conn im.Conn, id string) error {
+	_ = conn.WriteFrame(im.OpBinary, pkt.Marshal(pkt.New(wire.CommandLoginSignIn, pkt.WithChannel(id))))
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+	frame, err := conn.ReadFrame()
+	if err != nil {
+		return err
+	}
+	if frame.GetOpCode() == im.OpClose {
+		return errors.New(string(frame.GetPayload()))
+	}
+	return nil
+}
+
+// readVersion 读取versionHandler的响应，返回响应的编码版本以及服务端读到的请求版本
+func readVersion(t *testing.T, payload []byte) (wire.Version, wire.Version) {
+	resp, err := pkt.MustReadLogicPkt(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body pkt.MessageResp
+	if err = resp.ReadBody(&body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Version, wire.Version(body.MessageId)
+}
+
+// 旧的客户端不发送hello，双方使用原始格式；新的客户端协商出Version1
+func TestVersionNegotiation(t *testing.T) {
+	for _, epoll := range []bool{false, true} {
+		addr := freeAddr(t)
+		service := naming.NewEntry("test", "test", "tcp", "127.0.0.1", 0)
+		var srv im.Server
+		if epoll {
+			srv = NewEpollServer(addr, service)
+		} else {
+			srv = NewServer(addr, service)
+		}
+		srv.SetAcceptor(loginAcceptor{})
+		srv.SetStateListener(testStateListener{})
+		srv.SetMessageListener(im.HandlePackets(versionHandler))
+		go func() { _ = srv.Start() }()
+
+		// 旧的客户端
+		conn := NewConn(dial(t, addr))
+		if err := login(conn, "old"); err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.WriteFrame(im.OpBinary, pkt.Marshal(pkt.New(wire.CommandChatUserTalk)))
+		_ = conn.Flush()
+		frame, err := conn.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(frame.GetPayload(), wire.MagicLogicPkt[:]) {
+			t.Fatalf("epoll %v: old client read %x", epoll, frame.GetPayload()[:4])
+		}
+		if encoded, read := readVersion(t, frame.GetPayload()); encoded != wire.Version0 || read != wire.Version0 {
+			t.Fatalf("epoll %v: unexpected versions %d %d", epoll, encoded, read)
+		}
+		conn.Close()
+
+		// 新的客户端
+		cli := NewClient("new", "test", ClientOptions{ClientOptions: im.ClientOptions{Versions: pkt.SupportedVersions}})
+		cli.SetDialer(loginDialer{})
+		if err = cli.Connect("tcp://" + addr); err != nil {
+			t.Fatal(err)
+		}
+		if v := im.VersionOf(cli); v != wire.Version1 {
+			t.Fatalf("epoll %v: negotiated version %d", epoll, v)
+		}
+		if err = cli.(*Client).SendPacket(pkt.New(wire.CommandChatUserTalk)); err != nil {
+			t.Fatal(err)
+		}
+		if frame, err = cli.Read(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(frame.GetPayload(), wire.MagicVersioned[:]) {
+			t.Fatalf("epoll %v: new client read %x", epoll, frame.GetPayload()[:4])
+		}
+		if encoded, read := readVersion(t, frame.GetPayload()); encoded != wire.Version1 || read != wire.Version1 {
+			t.Fatalf("epoll %v: unexpected versions %d %d", epoll, encoded, read)
+		}
+		cli.Close()
+		_ = srv.Shutdown(context.Background())
+	}
+}
@@ -0,0 +1,112 @@
+package trace
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// OpenTelemetry status code
+const (
+	statusUnset = 0
+	statusError = 2
+)
+
+// otlpSpan 与OTLP/JSON中Span的字段一致，可以被OpenTelemetry Collector的文件接收器读取
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// WriterExporter 每个span写一行json
+type WriterExporter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewWriterExporter 比如NewWriterExporter(os.Stdout)
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// NewFileExporter 追加写入到文件中
+func NewFileExporter(path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterExporter(f), nil
+}
+
+// Export implements Exporter
+func (e *WriterExporter) Export(span *Span) error {
+	b, err := json.Marshal(toOTLP(span))
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	_, err = e.w.Write(b)
+	return err
+}
+
+// Close 关闭底层的writer
+func (e *WriterExporter) Close() error {
+	if closer, ok := e.w.(io.Closer); ok && e.w != os.Stdout && e.w != os.Stderr {
+		return closer.Close()
+	}
+	return nil
+}
+
+func toOTLP(span *Span) *otlpSpan {
+	span.lock.Lock()
+	defer span.lock.Unlock()
+	out := &otlpSpan{
+		TraceID:           span.TraceIDString(),
+		SpanID:            span.SpanIDString(),
+		Name:              span.Name,
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+		Status:            otlpStatus{Code: statusUnset},
+	}
+	if span.Parent != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(span.Parent[:])
+	}
+	keys := make([]string, 0, len(span.Attributes))
+	for k := range span.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		attr := otlpAttribute{Key: k}
+		attr.Value.StringValue = span.Attributes[k]
+		out.Attributes = append(out.Attributes, attr)
+	}
+	if span.Err != nil {
+		out.Status = otlpStatus{Code: statusError, Message: span.Err.Error()}
+	}
+	return out
+}
@@ -0,0 +1,38 @@
+package trace
+
+import (
+	"context"
+	"im"
+	"im/wire/pkt"
+)
+
+// Listener 网关使用，每个LogicPkt在网关都是一个span，转发给后端的包中带着这个span的上下文
+type Listener struct {
+	im.MessageListener
+}
+
+// NewListener NewListener
+func NewListener(listener im.MessageListener) *Listener {
+	return &Listener{MessageListener: listener}
+}
+
+// Receive 在客户端的跟踪上下文中创建一个子span，没有时创建一个新的trace，然后重新编码；其它包原样传递
+//
+// 只解码Header，Body直接引用payload
+func (l *Listener) Receive(agent im.Agent, payload []byte) {
+	packet, err := pkt.Unmarshal(payload)
+	if err != nil {
+		l.MessageListener.Receive(agent, payload)
+		return
+	}
+	req, ok := packet.(*pkt.LogicPkt)
+	if !ok {
+		l.MessageListener.Receive(agent, payload)
+		return
+	}
+	ctx, span := Start(ContextFromPacket(context.Background(), req), "gateway "+req.Command)
+	span.SetAttribute("channel", agent.ID())
+	InjectPacket(ctx, req)
+	l.MessageListener.Receive(agent, pkt.Marshal(req))
+	span.End()
+}
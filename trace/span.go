@@ -0,0 +1,106 @@
+package trace
+
+import (
+	"context"
+	"im/logger"
+	"sync"
+	"time"
+)
+
+// Span 一次处理过程，End时交给Exporter
+type Span struct {
+	SpanContext
+	Parent     [8]byte
+	Name       string
+	StartTime  time.Time
+	EndTime    time.Time
+	Attributes map[string]string
+	Err        error
+	lock       sync.Mutex
+	ended      bool
+}
+
+// Start 在ctx的trace中创建一个子span，ctx中没有跟踪上下文时创建一个新的trace
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	span := &Span{Name: name, StartTime: time.Now()}
+	if parent, ok := FromContext(ctx); ok {
+		span.SpanContext = parent.Child()
+		span.Parent = parent.SpanID
+	} else {
+		span.SpanContext = New()
+	}
+	return NewContext(ctx, span.SpanContext), span
+}
+
+// SetAttribute SetAttribute
+func (s *Span) SetAttribute(key, value string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+// SetError 记录处理失败的原因
+func (s *Span) SetError(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Err = err
+}
+
+// End 结束span，多次调用只有第一次有效；采样的span会交给Exporter
+func (s *Span) End() {
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.lock.Unlock()
+
+	exporter := getExporter()
+	if exporter == nil || !s.Sampled() {
+		return
+	}
+	if err := exporter.Export(s); err != nil {
+		logger.WithField("module", "trace").Warn("export span failed - ", err)
+	}
+}
+
+// Exporter 导出结束的span
+type Exporter interface {
+	Export(span *Span) error
+}
+
+var (
+	exporterLock sync.RWMutex
+	exporter     Exporter
+)
+
+// SetExporter 设置全局的Exporter，nil表示不导出
+func SetExporter(e Exporter) {
+	exporterLock.Lock()
+	defer exporterLock.Unlock()
+	exporter = e
+}
+
+func getExporter() Exporter {
+	exporterLock.RLock()
+	defer exporterLock.RUnlock()
+	return exporter
+}
+
+func init() {
+	logger.RegisterContextFields(func(ctx context.Context) logger.Fields {
+		sc, ok := FromContext(ctx)
+		if !ok {
+			return nil
+		}
+		return logger.Fields{
+			"trace_id": sc.TraceIDString(),
+			"span_id":  sc.SpanIDString(),
+		}
+	})
+}
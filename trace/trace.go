@@ -0,0 +1,169 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"im/wire"
+	"im/wire/pkt"
+	"net/http"
+)
+
+// ErrInvalidTraceparent traceparent格式错误
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// HeaderTraceparent http调用时使用的header
+const HeaderTraceparent = "traceparent"
+
+// FlagSampled traceparent中的采样标志
+const FlagSampled byte = 1
+
+// SpanContext 与W3C traceparent兼容的跟踪上下文
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+// New 创建一个新的trace
+func New() SpanContext {
+	var sc SpanContext
+	_, _ = rand.Read(sc.TraceID[:])
+	_, _ = rand.Read(sc.SpanID[:])
+	sc.Flags = FlagSampled
+	return sc
+}
+
+// Child 同一个trace中的下一个span
+func (sc SpanContext) Child() SpanContext {
+	child := sc
+	_, _ = rand.Read(child.SpanID[:])
+	return child
+}
+
+// IsValid trace id与span id都不能全为0
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Sampled Sampled
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// TraceIDString 日志中使用的trace id，同时作为request id
+func (sc SpanContext) TraceIDString() string {
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+// SpanIDString SpanIDString
+func (sc SpanContext) SpanIDString() string {
+	return hex.EncodeToString(sc.SpanID[:])
+}
+
+// String 编码为traceparent，格式为 00-{trace id}-{span id}-{flags}
+func (sc SpanContext) String() string {
+	var b [55]byte
+	copy(b[:], "00-")
+	hex.Encode(b[3:35], sc.TraceID[:])
+	b[35] = '-'
+	hex.Encode(b[36:52], sc.SpanID[:])
+	b[52] = '-'
+	hex.Encode(b[53:], []byte{sc.Flags})
+	return string(b[:])
+}
+
+// Parse 解析traceparent，只支持版本00
+func Parse(traceparent string) (SpanContext, error) {
+	var sc SpanContext
+	if len(traceparent) != 55 || traceparent[:3] != "00-" || traceparent[35] != '-' || traceparent[52] != '-' {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(traceparent[3:35])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(traceparent[36:52])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(traceparent[53:])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+type contextKey struct{}
+
+// NewContext NewContext
+func NewContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// FromContext FromContext
+func FromContext(ctx context.Context) (SpanContext, bool) {
+	if ctx == nil {
+		return SpanContext{}, false
+	}
+	sc, ok := ctx.Value(contextKey{}).(SpanContext)
+	return sc, ok
+}
+
+// Inject 将sc写入包的meta，替换已有的值
+func Inject(p *pkt.LogicPkt, sc SpanContext) {
+	p.SetMeta(&pkt.Meta{Key: wire.MetaTraceparent, Value: sc.String(), Type: pkt.MetaType_string})
+}
+
+// Extract 从包的meta中读取跟踪上下文
+func Extract(p *pkt.LogicPkt) (SpanContext, bool) {
+	val, err := p.GetStringMeta(wire.MetaTraceparent)
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc, err := Parse(val)
+	return sc, err == nil
+}
+
+// Ensure 包中没有或者是无效的跟踪上下文时创建一个新的，返回true表示包被修改
+func Ensure(p *pkt.LogicPkt) (SpanContext, bool) {
+	if sc, ok := Extract(p); ok {
+		return sc, false
+	}
+	sc := New()
+	Inject(p, sc)
+	return sc, true
+}
+
+// ContextFromPacket 处理一个包时使用的context
+func ContextFromPacket(ctx context.Context, p *pkt.LogicPkt) context.Context {
+	if sc, ok := Extract(p); ok {
+		return NewContext(ctx, sc)
+	}
+	return ctx
+}
+
+// InjectPacket 转发或者推送时把ctx中的跟踪上下文写到p中
+func InjectPacket(ctx context.Context, p *pkt.LogicPkt) {
+	if sc, ok := FromContext(ctx); ok {
+		Inject(p, sc)
+	}
+}
+
+// InjectHTTP rpc调用时把ctx中的跟踪上下文写到header中
+func InjectHTTP(ctx context.Context, header http.Header) {
+	if sc, ok := FromContext(ctx); ok {
+		header.Set(HeaderTraceparent, sc.String())
+	}
+}
+
+// ExtractHTTP rpc服务端从header中读取跟踪上下文
+func ExtractHTTP(ctx context.Context, header http.Header) context.Context {
+	if sc, err := Parse(header.Get(HeaderTraceparent)); err == nil {
+		return NewContext(ctx, sc)
+	}
+	return ctx
+}
@@ -0,0 +1,168 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"im"
+	"im/logger"
+	"im/wire"
+	"im/wire/pkt"
+	"net/http"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := Parse(traceparent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceIDString() != "4bf92f3577b34da6a3ce929d0e0e4736" || !sc.Sampled() || sc.String() != traceparent {
+		t.Fatalf("unexpected span context %s", sc)
+	}
+	for _, s := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bx-01",
+	} {
+		if _, err = Parse(s); !errors.Is(err, ErrInvalidTraceparent) {
+			t.Errorf("Parse(%q) = %v", s, err)
+		}
+	}
+	child := sc.Child()
+	if child.TraceID != sc.TraceID || child.SpanID == sc.SpanID {
+		t.Fatalf("unexpected child %s", child)
+	}
+}
+
+func TestPacketPropagation(t *testing.T) {
+	p := pkt.New(wire.CommandChatUserTalk)
+	sc, modified := Ensure(p)
+	if !modified || !sc.IsValid() {
+		t.Fatal("trace is not created")
+	}
+	read, err := pkt.MustReadLogicPkt(bytes.NewReader(pkt.Marshal(p)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, modified := Ensure(read); modified || got != sc {
+		t.Fatalf("unexpected trace %s", got)
+	}
+
+	// logic -> rpc -> push
+	ctx := ContextFromPacket(context.Background(), read)
+	header := make(http.Header)
+	InjectHTTP(ctx, header)
+	ctx = ExtractHTTP(context.Background(), header)
+	push := pkt.New(wire.CommandChatUserTalk)
+	InjectPacket(ctx, push)
+	if got, ok := Extract(push); !ok || got != sc {
+		t.Fatalf("unexpected trace %s", got)
+	}
+}
+
+type testAgent struct {
+	payloads [][]byte
+}
+
+func (a *testAgent) ID() string { return "test" }
+
+func (a *testAgent) Push(payload []byte) error {
+	a.payloads = append(a.payloads, payload)
+	return nil
+}
+
+type forwardListener struct{}
+
+func (forwardListener) Receive(agent im.Agent, payload []byte) {
+	_ = agent.Push(payload)
+}
+
+func TestListener(t *testing.T) {
+	agent := new(testAgent)
+	l := NewListener(forwardListener{})
+	l.Receive(agent, pkt.Marshal(pkt.New(wire.CommandChatUserTalk)))
+	basic := pkt.Marshal(&pkt.BasicPkt{Code: pkt.CodePing})
+	l.Receive(agent, basic)
+
+	p, err := pkt.MustReadLogicPkt(bytes.NewReader(agent.payloads[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Extract(p); !ok {
+		t.Fatal("trace is not injected")
+	}
+	if !bytes.Equal(agent.payloads[1], basic) {
+		t.Fatal("basic packet is modified")
+	}
+
+	// 客户端的上下文不会被原样转发，网关是同一个trace中的子span
+	client := New()
+	req := pkt.New(wire.CommandChatUserTalk)
+	Inject(req, client)
+	l.Receive(agent, pkt.Marshal(req))
+	p, err = pkt.MustReadLogicPkt(bytes.NewReader(agent.payloads[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := Extract(p)
+	if !ok || got.TraceID != client.TraceID || got.SpanID == client.SpanID {
+		t.Fatalf("unexpected trace %s, client %s", got, client)
+	}
+}
+
+type captureHook struct {
+	entries []*logrus.Entry
+}
+
+func (h *captureHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *captureHook) Fire(entry *logrus.Entry) error {
+	h.entries = append(h.entries, entry)
+	return nil
+}
+
+func TestSpanExport(t *testing.T) {
+	var buf bytes.Buffer
+	SetExporter(NewWriterExporter(&buf))
+	defer SetExporter(nil)
+
+	ctx, root := Start(context.Background(), "gateway")
+	ctx, span := Start(ctx, "chat.user.talk")
+	span.SetAttribute("dest", "u2")
+	span.SetError(errors.New("offline"))
+	span.End()
+	span.End()
+	root.End()
+
+	var spans []otlpSpan
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var s otlpSpan
+		if err := dec.Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+		spans = append(spans, s)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("unexpected spans %d", len(spans))
+	}
+	if spans[0].TraceID != spans[1].TraceID || spans[0].ParentSpanID != spans[1].SpanID || spans[1].ParentSpanID != "" {
+		t.Fatalf("unexpected parent %+v", spans)
+	}
+	if spans[0].Status.Code != statusError || len(spans[0].Attributes) != 1 || spans[0].Attributes[0].Value.StringValue != "u2" {
+		t.Fatalf("unexpected span %+v", spans[0])
+	}
+
+	hook := new(captureHook)
+	entry := logger.WithContext(ctx)
+	entry.Logger.AddHook(hook)
+	entry.Info("hello")
+	if len(hook.entries) != 1 || hook.entries[0].Data["trace_id"] != span.TraceIDString() || hook.entries[0].Data["span_id"] != span.SpanIDString() {
+		t.Fatalf("unexpected log fields %v", hook.entries)
+	}
+}
@@ -0,0 +1,119 @@
+package im
+
+import (
+	"fmt"
+	"im/wire"
+	"im/wire/pkt"
+	"sync/atomic"
+	"time"
+)
+
+// Versioned 登录时与对端协商了包格式版本的连接，Channel与ClientImpl都实现了这个接口
+type Versioned interface {
+	Version() wire.Version
+}
+
+// VersionOf 返回agent协商的版本，没有协商时是wire.Version0
+func VersionOf(agent interface{}) wire.Version {
+	if v, ok := agent.(Versioned); ok {
+		return v.Version()
+	}
+	return wire.Version0
+}
+
+// PushPacket 按照agent协商的版本编码p之后推送
+func PushPacket(agent Agent, p *pkt.LogicPkt) error {
+	p.Version = VersionOf(agent)
+	return agent.Push(pkt.Marshal(p))
+}
+
+// HelloConn 服务端在登录阶段使用的连接，Acceptor第一次ReadFrame时完成版本协商
+//
+// 客户端的第一个帧是pkt.CodeHello时回复选定的版本，然后继续读取登录包；
+// 旧的客户端直接发送登录包，版本是wire.Version0，这个帧原样返回给Acceptor
+type HelloConn struct {
+	Conn
+	supported []wire.Version
+	timeout   time.Duration
+	checked   bool
+	version   uint32 // wire.Version, accessed atomically
+}
+
+// NewHelloConn supported为空时使用pkt.SupportedVersions，timeout是回复hello的写超时
+func NewHelloConn(conn Conn, timeout time.Duration, supported ...wire.Version) *HelloConn {
+	return &HelloConn{
+		Conn:      conn,
+		supported: supported,
+		timeout:   timeout,
+	}
+}
+
+// ReadFrame 第一次调用时处理客户端的hello
+func (c *HelloConn) ReadFrame() (Frame, error) {
+	frame, err := c.Conn.ReadFrame()
+	if err != nil || c.checked {
+		return frame, err
+	}
+	c.checked = true
+	hello, ok := parseHello(frame)
+	if !ok {
+		return frame, nil
+	}
+	reply, version, err := pkt.ReplyHello(hello, c.supported...)
+	if err != nil {
+		return nil, err
+	}
+	_ = c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	if err = c.Conn.WriteFrame(OpBinary, pkt.Marshal(reply)); err != nil {
+		return nil, err
+	}
+	if err = c.Conn.Flush(); err != nil {
+		return nil, err
+	}
+	atomic.StoreUint32(&c.version, uint32(version))
+	return c.Conn.ReadFrame()
+}
+
+// Version 协商的版本
+func (c *HelloConn) Version() wire.Version {
+	return wire.Version(atomic.LoadUint32(&c.version))
+}
+
+func parseHello(frame Frame) (*pkt.BasicPkt, bool) {
+	if frame.GetOpCode() != OpBinary {
+		return nil, false
+	}
+	p, err := pkt.Unmarshal(frame.GetPayload())
+	if err != nil {
+		return nil, false
+	}
+	hello, ok := p.(*pkt.BasicPkt)
+	return hello, ok && hello.Code == pkt.CodeHello
+}
+
+// ClientHello 客户端在发送登录包之前发送hello，返回服务端选定的版本
+//
+// 不认识hello的旧服务端会把它当作登录包，因此只有确定服务端支持时才能使用
+func ClientHello(conn Conn, timeout time.Duration, versions ...wire.Version) (wire.Version, error) {
+	_ = conn.SetWriteDeadline(time.Now().Add(timeout))
+	if err := conn.WriteFrame(OpBinary, pkt.Marshal(pkt.NewHello(versions...))); err != nil {
+		return wire.Version0, err
+	}
+	if err := conn.Flush(); err != nil {
+		return wire.Version0, err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+	frame, err := conn.ReadFrame()
+	if err != nil {
+		return wire.Version0, err
+	}
+	if frame.GetOpCode() == OpClose {
+		return wire.Version0, fmt.Errorf("%w: %s", ErrRemoteClosed, frame.GetPayload())
+	}
+	reply, ok := parseHello(frame)
+	if !ok {
+		return wire.Version0, fmt.Errorf("unexpected hello reply")
+	}
+	return pkt.ParseHelloReply(reply)
+}
@@ -1,170 +1,75 @@
 package websocket
 
 import (
-	"errors"
-	"fmt"
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 	"im"
-	"im/logger"
 	"net"
-	"net/url"
 	"sync"
-	"sync/atomic"
-	"time"
 )
 
-type ClientOptions struct {
-	Heartbeat time.Duration //登录超时
-	ReadWait  time.Duration //读超时
-	WriteWait time.Duration //写超时
-}
+// ClientOptions ClientOptions
+type ClientOptions = im.ClientOptions
 
+// Client websocket客户端，连接状态、心跳与重连由im.ClientImpl实现
 type Client struct {
-	sync.Mutex
-	im.Dialer
-	once    sync.Once
-	id      string
-	name    string
-	conn    net.Conn
-	state   int32
-	options ClientOptions
+	*im.ClientImpl
 }
 
 // NewClient NewClient
 func NewClient(id, name string, opts ClientOptions) im.Client {
-	if opts.WriteWait == 0 {
-		opts.WriteWait = im.DefaultWriteWait
-	}
-	if opts.ReadWait == 0 {
-		opts.ReadWait = im.DefaultReadWait
-	}
-
-	cli := &Client{
-		id:      id,
-		name:    name,
-		options: opts,
+	return &Client{
+		ClientImpl: im.NewClient(id, name, "ws.client", wrapConn, opts),
 	}
-	return cli
-}
-
-// ID return id
-func (c *Client) ID() string {
-	return c.id
-}
-
-// Name Name
-func (c *Client) Name() string {
-	return c.name
 }
 
-// Connect to server
-func (c *Client) Connect(addr string) error {
-	_, err := url.Parse(addr)
-	if err != nil {
-		return err
-	}
-	if !atomic.CompareAndSwapInt32(&c.state, 0, 1) {
-		return fmt.Errorf("client has connected")
-	}
-	// step 1 拨号及握手
-	conn, err := c.Dialer.DialAndHandshake(im.DialerContext{
-		Id:      c.id,
-		Name:    c.name,
-		Address: addr,
-		Timeout: im.DefaultLoginWait,
-	})
-	if err != nil {
-		atomic.CompareAndSwapInt32(&c.state, 1, 0)
-		return err
+// wrapConn 版本协商时已经包装过的连接直接复用，避免丢失reader中缓冲的数据
+func wrapConn(rawconn net.Conn, opts im.ClientOptions) (im.Conn, error) {
+	if c, ok := rawconn.(*clientConn); ok {
+		return c, nil
 	}
-	if conn == nil {
-		return fmt.Errorf("conn is nil")
+	c := &clientConn{Conn: rawconn}
+	c.reader = messageReader{
+		r:         rawconn,
+		state:     ws.StateClientSide,
+		maxSize:   int64(opts.MaxFrameSize),
+		onControl: c.control,
 	}
-	c.conn = conn
-
-	if c.options.Heartbeat > 0 {
-		go func() {
-			err := c.heartbealoop(conn)
-			if err != nil {
-				logger.Error("heartbealoop stopped ", err)
-			}
-		}()
-	}
-	return nil
+	return c, nil
 }
 
-// SetDialer 设置握手逻辑
-func (c *Client) SetDialer(dialer im.Dialer) {
-	c.Dialer = dialer
+// clientConn 客户端的websocket连接，按消息读取，写入的消息使用MASK并且立即发送
+type clientConn struct {
+	net.Conn
+	wlock  sync.Mutex
+	reader messageReader
 }
 
-// Send data to connection
-func (c *Client) Send(payload []byte) error {
-	if atomic.LoadInt32(&c.state) == 0 {
-		return fmt.Errorf("connection is nil")
-	}
-	c.Lock()
-	defer c.Unlock()
-	err := c.conn.SetWriteDeadline(time.Now().Add(c.options.WriteWait))
+// ReadFrame 读取一个控制帧或者一个完整的数据消息
+func (c *clientConn) ReadFrame() (im.Frame, error) {
+	f, err := c.reader.next()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// 客户端消息需要使用MASK
-	return wsutil.WriteClientMessage(c.conn, ws.OpBinary, payload)
-}
-
-// Close 关闭
-func (c *Client) Close() {
-	c.once.Do(func() {
-		if c.conn == nil {
-			return
-		}
-		// graceful close connection
-		_ = wsutil.WriteClientMessage(c.conn, ws.OpClose, nil)
-
-		c.conn.Close()
-		atomic.CompareAndSwapInt32(&c.state, 1, 0)
-	})
+	return &Frame{raw: f}, nil
 }
 
-func (c *Client) Read() (im.Frame, error) {
-	if c.conn == nil {
-		return nil, errors.New("connection is nil")
-	}
-	if c.options.Heartbeat > 0 {
-		_ = c.conn.SetReadDeadline(time.Now().Add(c.options.ReadWait))
+// control 回复分片序列中收到的ping
+func (c *clientConn) control(f ws.Frame) error {
+	if f.Header.OpCode != ws.OpPing {
+		return nil
 	}
-	frame, err := ws.ReadFrame(c.conn)
-	if err != nil {
-		return nil, err
-	}
-	if frame.Header.OpCode == ws.OpClose {
-		return nil, errors.New("remote side close the channel")
-	}
-	return &Frame{
-		raw: frame,
-	}, nil
+	return c.WriteFrame(im.OpPong, f.Payload)
 }
 
-func (c *Client) heartbealoop(conn net.Conn) error {
-	tick := time.NewTicker(c.options.Heartbeat)
-	for range tick.C {
-		// 发送一个ping的心跳包给服务端
-		if err := c.ping(conn); err != nil {
-			return err
-		}
-	}
-	return nil
+// WriteFrame 客户端消息需要使用MASK
+func (c *clientConn) WriteFrame(code im.OpCode, payload []byte) error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	return wsutil.WriteClientMessage(c.Conn, ws.OpCode(code), payload)
 }
 
-func (c *Client) ping(conn net.Conn) error {
-	c.Lock()
-	defer c.Unlock()
-	err := conn.SetWriteDeadline(time.Now().Add(c.options.WriteWait))
-	if err != nil {
-		return err
-	}
-	logger.Tracef("%s send ping to server", c.id)
-	return wsutil.WriteClientMessage(conn, ws.OpPing, nil)
+// Flush WriteFrame没有缓冲
+func (c *clientConn) Flush() error {
+	return nil
 }
@@ -1,9 +1,12 @@
 package websocket
 
 import (
+	"bufio"
+	"github.com/gobwas/pool/pbufio"
 	"github.com/gobwas/ws"
 	"im"
 	"net"
+	"sync"
 )
 
 type Frame struct {
@@ -31,29 +34,135 @@ func (f *Frame) GetPayload() []byte {
 	return f.raw.Payload
 }
 
+// WsConn 服务端的websocket连接
+//
+// ReadFrame按消息读取，分片会被重组；写入时使用从pool中获取的bufio.Writer缓冲，Flush时一次写出并归还
 type WsConn struct {
 	net.Conn
+	wlock        sync.Mutex
+	wr           *bufio.Writer
+	reader       messageReader
+	fragmentSize int
+	closeSent    bool
 }
 
 func NewConn(conn net.Conn) *WsConn {
-	return &WsConn{
+	c := &WsConn{
 		Conn: conn,
 	}
+	c.reader = messageReader{
+		r:         conn,
+		state:     ws.StateServerSide,
+		maxSize:   im.DefaultMaxFrameSize,
+		onControl: c.control,
+	}
+	return c
+}
+
+// SetMaxFrameSize 设置最大消息长度，超过时ReadFrame返回im.ErrFrameTooLarge
+func (c *WsConn) SetMaxFrameSize(size int) {
+	if size <= 0 {
+		return
+	}
+	c.reader.maxSize = int64(size)
+}
+
+// SetFragmentSize 超过size的数据消息会被分片发送，0表示不分片
+func (c *WsConn) SetFragmentSize(size int) {
+	c.fragmentSize = size
 }
 
+// ReadFrame 读取一个控制帧或者一个完整的数据消息
 func (c *WsConn) ReadFrame() (im.Frame, error) {
-	f, err := ws.ReadFrame(c.Conn)
+	f, err := c.reader.next()
 	if err != nil {
+		if code, ok := closeCode(err); ok {
+			_ = c.writeClose(ws.NewCloseFrameBody(code, err.Error()))
+			_ = c.Flush()
+		}
 		return nil, err
 	}
 	return &Frame{raw: f}, nil
 }
 
+// control 回复分片序列中收到的ping
+func (c *WsConn) control(f ws.Frame) error {
+	if f.Header.OpCode != ws.OpPing {
+		return nil
+	}
+	if err := c.WriteFrame(im.OpPong, f.Payload); err != nil {
+		return err
+	}
+	return c.Flush()
+}
+
+// WriteFrame 写入缓冲区，调用Flush后才会发送
+//
+// OpClose的payload作为关闭原因；超过fragmentSize的数据消息会被分片
 func (c *WsConn) WriteFrame(code im.OpCode, payload []byte) error {
-	f := ws.NewFrame(ws.OpCode(code), true, payload)
-	return ws.WriteFrame(c.Conn, f)
+	op := ws.OpCode(code)
+	if op == ws.OpClose {
+		if len(payload) > 0 {
+			payload = ws.NewCloseFrameBody(ws.StatusPolicyViolation, string(payload))
+		}
+		return c.writeClose(payload)
+	}
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	if c.wr == nil {
+		c.wr = pbufio.GetWriter(c.Conn, im.DefaultWriteBufferSize)
+	}
+	if c.fragmentSize <= 0 || op.IsControl() || len(payload) <= c.fragmentSize {
+		return ws.WriteFrame(c.wr, ws.NewFrame(op, true, payload))
+	}
+	for len(payload) > 0 {
+		n := c.fragmentSize
+		if n > len(payload) {
+			n = len(payload)
+		}
+		if err := ws.WriteFrame(c.wr, ws.NewFrame(op, n == len(payload), payload[:n])); err != nil {
+			return err
+		}
+		op = ws.OpContinuation
+		payload = payload[n:]
+	}
+	return nil
+}
+
+// writeClose 发送关闭帧，同一个连接只会发送一次
+func (c *WsConn) writeClose(body []byte) error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	if c.closeSent {
+		return nil
+	}
+	c.closeSent = true
+	if c.wr == nil {
+		c.wr = pbufio.GetWriter(c.Conn, im.DefaultWriteBufferSize)
+	}
+	return ws.WriteFrame(c.wr, ws.NewCloseFrame(body))
 }
 
+// Flush 将缓冲区中的数据写到连接中，并将缓冲区归还到pool
 func (c *WsConn) Flush() error {
-	return nil
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	if c.wr == nil {
+		return nil
+	}
+	err := c.wr.Flush()
+	pbufio.PutWriter(c.wr)
+	c.wr = nil
+	return err
+}
+
+// Close 关闭连接，未Flush的数据会被丢弃
+func (c *WsConn) Close() error {
+	c.wlock.Lock()
+	if c.wr != nil {
+		pbufio.PutWriter(c.wr)
+		c.wr = nil
+	}
+	c.wlock.Unlock()
+	return c.Conn.Close()
 }
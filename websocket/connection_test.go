@@ -0,0 +1,111 @@
+package websocket
+
+import (
+	"bytes"
+	"github.com/gobwas/ws"
+	"im"
+	"net"
+	"testing"
+)
+
+func pipe(t *testing.T) (net.Conn, net.Conn) {
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lst.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := lst.Accept()
+		accepted <- conn
+	}()
+	cli, err := net.Dial("tcp", lst.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli, <-accepted
+}
+
+func writeClientFrame(t *testing.T, conn net.Conn, op ws.OpCode, fin bool, payload []byte) {
+	f := ws.MaskFrameInPlace(ws.NewFrame(op, fin, payload))
+	if err := ws.WriteFrame(conn, f); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWsConnReadFragmented(t *testing.T) {
+	cli, srv := pipe(t)
+	defer cli.Close()
+	conn := NewConn(srv)
+	defer conn.Close()
+
+	pong := make(chan ws.Frame, 1)
+	go func() {
+		writeClientFrame(t, cli, ws.OpText, false, []byte("hello "))
+		writeClientFrame(t, cli, ws.OpPing, true, []byte("p"))
+		f, err := ws.ReadFrame(cli)
+		if err != nil {
+			t.Error(err)
+		}
+		pong <- f
+		writeClientFrame(t, cli, ws.OpContinuation, false, []byte("wor"))
+		writeClientFrame(t, cli, ws.OpContinuation, true, []byte("ld"))
+	}()
+
+	frame, err := conn.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.GetOpCode() != im.OpText || string(frame.GetPayload()) != "hello world" {
+		t.Fatalf("unexpected message %d %q", frame.GetOpCode(), frame.GetPayload())
+	}
+	f := <-pong
+	if f.Header.OpCode != ws.OpPong || string(f.Payload) != "p" {
+		t.Fatalf("unexpected pong %v", f.Header)
+	}
+}
+
+func TestWsConnReadRejectUnmasked(t *testing.T) {
+	cli, srv := pipe(t)
+	defer cli.Close()
+	conn := NewConn(srv)
+	defer conn.Close()
+
+	closed := make(chan ws.Frame, 1)
+	go func() {
+		_ = ws.WriteFrame(cli, ws.NewBinaryFrame([]byte("x")))
+		f, _ := ws.ReadFrame(cli)
+		closed <- f
+	}()
+	if _, err := conn.ReadFrame(); err != ws.ErrProtocolMaskRequired {
+		t.Fatalf("expect ErrProtocolMaskRequired, got %v", err)
+	}
+	f := <-closed
+	code, _ := ws.ParseCloseFrameData(f.Payload)
+	if f.Header.OpCode != ws.OpClose || code != ws.StatusProtocolError {
+		t.Fatalf("expect close frame with protocol error, got %v %d", f.Header, code)
+	}
+}
+
+func TestWsConnWriteFragmented(t *testing.T) {
+	cli, srv := pipe(t)
+	defer cli.Close()
+	conn := NewConn(srv)
+	conn.SetFragmentSize(4)
+	defer conn.Close()
+
+	payload := []byte("0123456789")
+	go func() {
+		_ = conn.WriteFrame(im.OpBinary, payload)
+		_ = conn.Flush()
+	}()
+
+	reader := messageReader{r: cli, state: ws.StateClientSide, maxSize: 1024}
+	msg, err := reader.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.OpCode != ws.OpBinary || !bytes.Equal(msg.Payload, payload) {
+		t.Fatalf("unexpected message %v %q", msg.Header, msg.Payload)
+	}
+}
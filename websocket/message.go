@@ -0,0 +1,101 @@
+package websocket
+
+import (
+	"github.com/gobwas/ws"
+	"im"
+	"io"
+	"unicode/utf8"
+)
+
+// ErrInvalidUTF8 OpText消息不是合法的UTF-8
+var ErrInvalidUTF8 = ws.ProtocolError("invalid utf8 sequence in text message")
+
+// messageReader 按消息读取数据
+//
+// 校验帧头（掩码、控制帧规则），把分片重组为一个完整的消息，并校验OpText消息的UTF-8编码。
+// 在分片序列中收到的ping/pong交给onControl处理。
+type messageReader struct {
+	r         io.Reader
+	state     ws.State
+	maxSize   int64
+	onControl func(ws.Frame) error
+}
+
+// next 返回一个控制帧或者一个完整的数据消息
+func (m *messageReader) next() (ws.Frame, error) {
+	var msg ws.Frame
+	state := m.state
+	for {
+		f, err := m.readFrame(state, m.maxSize-int64(len(msg.Payload)))
+		if err != nil {
+			return f, err
+		}
+		if f.Header.OpCode.IsControl() {
+			if !state.Fragmented() || f.Header.OpCode == ws.OpClose {
+				return f, nil
+			}
+			if m.onControl != nil {
+				if err = m.onControl(f); err != nil {
+					return f, err
+				}
+			}
+			continue
+		}
+		if !state.Fragmented() {
+			msg = f
+		} else {
+			msg.Payload = append(msg.Payload, f.Payload...)
+		}
+		if f.Header.Fin {
+			break
+		}
+		state = state.Set(ws.StateFragmented)
+	}
+	msg.Header.Fin = true
+	msg.Header.Length = int64(len(msg.Payload))
+	if msg.Header.OpCode == ws.OpText && !utf8.Valid(msg.Payload) {
+		return msg, ErrInvalidUTF8
+	}
+	return msg, nil
+}
+
+// readFrame 读取一个帧，先检查header再按长度分配内存
+func (m *messageReader) readFrame(state ws.State, limit int64) (ws.Frame, error) {
+	var f ws.Frame
+	h, err := ws.ReadHeader(m.r)
+	if err != nil {
+		return f, err
+	}
+	if err = ws.CheckHeader(h, state); err != nil {
+		return f, err
+	}
+	if h.Length > limit {
+		return f, im.ErrFrameTooLarge
+	}
+	if h.Length > 0 {
+		f.Payload = make([]byte, int(h.Length))
+		if _, err = io.ReadFull(m.r, f.Payload); err != nil {
+			return f, err
+		}
+	}
+	if h.Masked {
+		ws.Cipher(f.Payload, h.Mask, 0)
+		h.Masked = false
+	}
+	f.Header = h
+	return f, nil
+}
+
+// closeCode 根据读取错误返回关闭码
+func closeCode(err error) (ws.StatusCode, bool) {
+	switch err {
+	case im.ErrFrameTooLarge:
+		return ws.StatusMessageTooBig, true
+	case ErrInvalidUTF8:
+		return ws.StatusInvalidFramePayloadData, true
+	}
+	if _, ok := err.(ws.ProtocolError); ok {
+		return ws.StatusProtocolError, true
+	}
+	return 0, false
+}
@@ -2,7 +2,6 @@ package websocket
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/gobwas/ws"
 	"github.com/segmentio/ksuid"
@@ -18,6 +17,41 @@ type ServerOptions struct {
 	loginwait time.Duration //登陆超时
 	readwait  time.Duration //读超时
 	writewait time.Duration //写超时
+	channel   []im.ChannelOption
+	maxframe  int            //最大帧长度
+	fragment  int            //发送时的分片大小
+	login     im.LoginPolicy //重复登录的处理策略
+}
+
+// ServerOption ServerOption
+type ServerOption func(*ServerOptions)
+
+// WithMaxFrameSize set max size of a frame read from the connections
+func WithMaxFrameSize(size int) ServerOption {
+	return func(so *ServerOptions) {
+		so.maxframe = size
+	}
+}
+
+// WithFragmentSize send data messages larger than size in fragments
+func WithFragmentSize(size int) ServerOption {
+	return func(so *ServerOptions) {
+		so.fragment = size
+	}
+}
+
+// WithLoginPolicy set policy of duplicate login, default is im.LoginRejectNew
+func WithLoginPolicy(policy im.LoginPolicy) ServerOption {
+	return func(so *ServerOptions) {
+		so.login = policy
+	}
+}
+
+// WithChannelOptions set options of the channels created by the server
+func WithChannelOptions(opts ...im.ChannelOption) ServerOption {
+	return func(so *ServerOptions) {
+		so.channel = append(so.channel, opts...)
+	}
 }
 
 type Server struct {
@@ -32,16 +66,21 @@ type Server struct {
 }
 
 // NewServer NewServer
-func NewServer(listen string, service naming.ServiceRegistration) im.Server {
-	return &Server{
+func NewServer(listen string, service naming.ServiceRegistration, options ...ServerOption) im.Server {
+	srv := &Server{
 		listen:              listen,
 		ServiceRegistration: service,
 		options: ServerOptions{
 			loginwait: im.DefaultLoginWait,
 			readwait:  im.DefaultReadWait,
 			writewait: time.Second * 10,
+			maxframe:  im.DefaultMaxFrameSize,
 		},
 	}
+	for _, option := range options {
+		option(&srv.options)
+	}
+	return srv
 }
 
 // Start server
@@ -73,25 +112,34 @@ func (s *Server) Start() error {
 
 		// step 2 包装conn
 		conn := NewConn(rawconn)
+		conn.SetMaxFrameSize(s.options.maxframe)
+		conn.SetFragmentSize(s.options.fragment)
 
-		// step 3 回调给上层业务完成权限认证之类的逻辑处理
-		id, err := s.Accept(conn, s.options.loginwait)
+		// step 3 回调给上层业务完成权限认证之类的逻辑处理，客户端先发送hello时同时完成版本协商
+		hello := im.NewHelloConn(conn, s.options.writewait)
+		id, err := s.Accept(hello, s.options.loginwait)
 		if err != nil {
 			_ = conn.WriteFrame(im.OpClose, []byte(err.Error()))
-			conn.Close()
-			return
-		}
-		if _, ok := s.Get(id); ok {
-			log.Warnf("channel %s existed", id)
-			_ = conn.WriteFrame(im.OpClose, []byte("channelId is repeated"))
+			_ = conn.Flush()
 			conn.Close()
 			return
 		}
 		// step 4
-		channel := im.NewChannel(id, conn)
+		channel := im.NewChannel(id, hello, s.options.channel...)
 		channel.SetWriteWait(s.options.writewait)
 		channel.SetReadWait(s.options.readwait)
-		s.Add(channel)
+		old, err := im.AddChannel(s.ChannelMap, channel, s.options.login)
+		if err != nil {
+			log.Warnf("channel %s - %v", id, err)
+			_ = conn.WriteFrame(im.OpClose, []byte(err.Error()))
+			_ = conn.Flush()
+			channel.Close()
+			return
+		}
+		if old != nil {
+			log.Infof("channel %s is replaced, kickout %v", id, old.RemoteAddr())
+			go im.Kickout(old, s.options.writewait)
+		}
 
 		go func(ch im.Channel) {
 			// step 5
@@ -100,10 +148,12 @@ func (s *Server) Start() error {
 				log.Info(err)
 			}
 			// step 6
-			s.Remove(ch.ID())
-			err = s.Disconnect(ch.ID())
-			if err != nil {
-				log.Warn(err)
+			// 被替换的channel已经不在map中，不能通知Disconnect
+			if s.RemoveChannel(ch) {
+				err = s.Disconnect(ch.ID())
+				if err != nil {
+					log.Warn(err)
+				}
 			}
 			ch.Close()
 		}(channel)
@@ -145,7 +195,7 @@ func (s *Server) Shutdown(ctx context.Context) error {
 func (s *Server) Push(id string, data []byte) error {
 	ch, ok := s.ChannelMap.Get(id)
 	if !ok {
-		return errors.New("channel no found")
+		return im.ErrChannelNotFound
 	}
 	return ch.Push(data)
 }
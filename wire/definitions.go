@@ -28,12 +28,26 @@ const (
 	CommandGroupQuit    = "chat.group.quit"
 	CommandGroupMembers = "chat.group.members"
 	CommandGroupDetail  = "chat.group.detail"
+
+	// 端到端加密的公钥
+	CommandKeyBundleUpload = "e2e.keys.upload"
+	CommandKeyBundleFetch  = "e2e.keys.fetch"
 )
 
 // Meta Key of a packet
+//
+// 这些key由框架使用，业务自定义的meta不要使用相同的名字，建议加上自己的前缀
 const (
-	MetaDestServer   = "dest.server"
+	// MetaDestServer string, 网关转发给逻辑服务时记录的网关ID
+	MetaDestServer = "dest.server"
+	// MetaDestChannels list, 逻辑服务推送时指定的目标channel
 	MetaDestChannels = "dest.channels"
+	// MetaAcceptCompression string, 客户端登录时声明支持的压缩算法，逗号分隔
+	MetaAcceptCompression = "accept.compression"
+	// MetaCompression string, 服务端选定的压缩算法
+	MetaCompression = "compression"
+	// MetaTraceparent string, W3C traceparent格式的跟踪上下文，网关收到没有跟踪上下文的包时创建
+	MetaTraceparent = "traceparent"
 )
 
 // Protocol Protocol
@@ -43,6 +57,9 @@ type Protocol string
 const (
 	ProtocolTCP       Protocol = "tcp"
 	ProtocolWebsocket Protocol = "websocket"
+	ProtocolKCP       Protocol = "kcp"
+	ProtocolUnix      Protocol = "unix"
+	ProtocolPipe      Protocol = "pipe"
 )
 
 // Service Name 定义统一的服务名
@@ -65,6 +82,20 @@ type Magic [4]byte
 var (
 	MagicLogicPkt = Magic{0xc3, 0x11, 0xa3, 0x65}
 	MagicBasicPkt = Magic{0xc3, 0x15, 0xa7, 0x65}
+	// MagicVersioned 带版本号的包，magic之后是1字节的版本号和1字节的标志位
+	MagicVersioned = Magic{0xc3, 0x19, 0xab, 0x65}
+)
+
+// Version 包格式的版本，连接建立时协商
+type Version uint8
+
+const (
+	// Version0 没有版本号的原始格式，以MagicLogicPkt或者MagicBasicPkt开头
+	Version0 Version = 0
+	// Version1 MagicVersioned + version + flags + LogicPkt
+	Version1 Version = 1
+	// LatestVersion 支持的最高版本
+	LatestVersion = Version1
 )
 
 const (
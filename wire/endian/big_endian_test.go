@@ -5,7 +5,9 @@
 package endian
 
 import (
+	"bytes"
 	"encoding/binary"
+	"io"
 	"testing"
 )
 
@@ -85,3 +87,58 @@ func TestDecode(t *testing.T) {
 	t.Logf("Src:%d Dest:%d Seq:%d Ack:%d Data:%s", pkt.Source, pkt.Destination, pkt.Sequence, pkt.Acknowledgment, pkt.Data)
 	// t.Log(pkt)
 }
+
+// plainReader 没有实现io.ByteReader的reader，比如net.Conn
+type plainReader struct {
+	r *bytes.Reader
+}
+
+func (p *plainReader) Read(b []byte) (int, error) {
+	return p.r.Read(b)
+}
+
+func TestReadWriteUintNoAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items randomly with -race")
+	}
+	data := make([]byte, 15)
+	r := &plainReader{r: bytes.NewReader(data)}
+	allocs := testing.AllocsPerRun(100, func() {
+		r.r.Reset(data)
+		_, _ = ReadUint8(r)
+		_, _ = ReadUint16(r)
+		_, _ = ReadUint32(r)
+		_, _ = ReadUint64(r)
+	})
+	if allocs != 0 {
+		t.Fatalf("read allocs %v", allocs)
+	}
+	allocs = testing.AllocsPerRun(100, func() {
+		_ = WriteUint8(io.Discard, 1)
+		_ = WriteUint16(io.Discard, 2)
+		_ = WriteUint32(io.Discard, 3)
+		_ = WriteUint64(io.Discard, 4)
+	})
+	if allocs != 0 {
+		t.Fatalf("write allocs %v", allocs)
+	}
+}
+
+func TestReadWriteUint(t *testing.T) {
+	var buf bytes.Buffer
+	_ = WriteUint8(&buf, 0xff)
+	_ = WriteUint16(&buf, 0x0102)
+	_ = WriteUint32(&buf, 0x01020304)
+	_ = WriteUint64(&buf, 0x0102030405060708)
+	r := &plainReader{r: bytes.NewReader(buf.Bytes())}
+	v8, _ := ReadUint8(r)
+	v16, _ := ReadUint16(r)
+	v32, _ := ReadUint32(r)
+	v64, err := ReadUint64(r)
+	if err != nil || v8 != 0xff || v16 != 0x0102 || v32 != 0x01020304 || v64 != 0x0102030405060708 {
+		t.Fatalf("unexpected values %x %x %x %x %v", v8, v16, v32, v64, err)
+	}
+	if _, err = ReadUint32(&plainReader{r: bytes.NewReader([]byte{1, 2})}); err != io.ErrUnexpectedEOF {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
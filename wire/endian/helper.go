@@ -6,45 +6,65 @@ package endian
 
 import (
 	"encoding/binary"
+	"errors"
 	"io"
+	"sync"
 )
 
 var Default = binary.LittleEndian
 
+// ErrTooLarge 长度前缀超过了限制
+var ErrTooLarge = errors.New("endian: length exceeds the limit")
+
+// scratch 读写整数的临时缓冲区；传给io.Reader/io.Writer的切片会逃逸到堆上，复用之后不再分配内存
+var scratch = sync.Pool{New: func() interface{} { return new([8]byte) }}
+
 // ReadUint8 从 reader 中读取一个 uint8
 func ReadUint8(r io.Reader) (uint8, error) {
-	var bytes = make([]byte, 1)
-	if _, err := io.ReadFull(r, bytes); err != nil {
-		return 0, err
-	}
-	return uint8(bytes[0]), nil
+	v, err := readUint(r, 1)
+	return uint8(v), err
 }
 
 // ReadUint32 从 reader 中读取一个 uint32
 func ReadUint32(r io.Reader) (uint32, error) {
-	var bytes = make([]byte, 4)
-	if _, err := io.ReadFull(r, bytes); err != nil {
-		return 0, err
-	}
-	return Default.Uint32(bytes), nil
+	v, err := readUint(r, 4)
+	return uint32(v), err
 }
 
 // ReadUint16 从 reader 中读取一个 uint16
 func ReadUint16(r io.Reader) (uint16, error) {
-	var bytes = make([]byte, 2)
-	if _, err := io.ReadFull(r, bytes); err != nil {
-		return 0, err
-	}
-	return Default.Uint16(bytes), nil
+	v, err := readUint(r, 2)
+	return uint16(v), err
 }
 
 // ReadUint64 从 reader 中读取一个 uint64
 func ReadUint64(r io.Reader) (uint64, error) {
-	var bytes = make([]byte, 8)
-	if _, err := io.ReadFull(r, bytes); err != nil {
+	return readUint(r, 8)
+}
+
+// readUint 读取n个字节的小端整数，不会分配内存
+func readUint(r io.Reader, n int) (uint64, error) {
+	if br, ok := r.(io.ByteReader); ok {
+		var v uint64
+		for i := 0; i < n; i++ {
+			b, err := br.ReadByte()
+			if err != nil {
+				if i > 0 && err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+			v |= uint64(b) << (8 * i)
+		}
+		return v, nil
+	}
+	b := scratch.Get().(*[8]byte)
+	defer scratch.Put(b)
+	*b = [8]byte{}
+	if _, err := io.ReadFull(r, b[:n]); err != nil {
 		return 0, err
 	}
-	return Default.Uint64(bytes), nil
+	return Default.Uint64(b[:]), nil
 }
 
 // ReadString 从 reader 中读取一个 string
@@ -70,6 +90,23 @@ func ReadBytes(r io.Reader) ([]byte, error) {
 	return buf, nil
 }
 
+// ReadBytesLimit 与ReadBytes相同，长度超过limit时返回ErrTooLarge，且不会分配内存
+func ReadBytesLimit(r io.Reader, limit uint32) ([]byte, error) {
+	bufLen, err := ReadUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if bufLen > limit {
+		return nil, ErrTooLarge
+	}
+	buf := make([]byte, bufLen)
+	_, err = io.ReadFull(r, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
 // ReadFixedBytes 读取固定长度的字节
 func ReadFixedBytes(len int, r io.Reader) ([]byte, error) {
 	buf := make([]byte, len)
@@ -82,41 +119,31 @@ func ReadFixedBytes(len int, r io.Reader) ([]byte, error) {
 
 // WriteUint8 写一个 uint8到 writer 中
 func WriteUint8(w io.Writer, val uint8) error {
-	buf := []byte{byte(val)}
-	if _, err := w.Write(buf); err != nil {
-		return err
-	}
-	return nil
+	return writeUint(w, uint64(val), 1)
 }
 
 // WriteUint16 写一个 int16到 writer 中
 func WriteUint16(w io.Writer, val uint16) error {
-	buf := make([]byte, 2)
-	Default.PutUint16(buf, val)
-	if _, err := w.Write(buf); err != nil {
-		return err
-	}
-	return nil
+	return writeUint(w, uint64(val), 2)
 }
 
 // WriteUint32 写一个 int32到 writer 中
 func WriteUint32(w io.Writer, val uint32) error {
-	buf := make([]byte, 4)
-	Default.PutUint32(buf, val)
-	if _, err := w.Write(buf); err != nil {
-		return err
-	}
-	return nil
+	return writeUint(w, uint64(val), 4)
 }
 
 // WriteUint64 写一个 int64到 writer 中
 func WriteUint64(w io.Writer, val uint64) error {
-	buf := make([]byte, 8)
-	Default.PutUint64(buf, val)
-	if _, err := w.Write(buf); err != nil {
-		return err
-	}
-	return nil
+	return writeUint(w, uint64(val), 8)
+}
+
+// writeUint 写入n个字节的小端整数，不会分配内存
+func writeUint(w io.Writer, val uint64, n int) error {
+	b := scratch.Get().(*[8]byte)
+	defer scratch.Put(b)
+	Default.PutUint64(b[:], val)
+	_, err := w.Write(b[:n])
+	return err
 }
 
 // WriteString 写一个 string 到 writer 中
@@ -172,3 +199,13 @@ func ReadShortString(r io.Reader) (string, error) {
 	}
 	return string(buf), nil
 }
+
+// AppendUint16 追加一个 uint16 到 b 中
+func AppendUint16(b []byte, val uint16) []byte {
+	return Default.AppendUint16(b, val)
+}
+
+// AppendUint32 追加一个 uint32 到 b 中
+func AppendUint32(b []byte, val uint32) []byte {
+	return Default.AppendUint32(b, val)
+}
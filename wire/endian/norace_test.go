@@ -0,0 +1,5 @@
+//go:build !race
+
+package endian
+
+const raceEnabled = false
@@ -0,0 +1,6 @@
+//go:build race
+
+package endian
+
+// sync.Pool在race模式下会随机丢弃对象
+const raceEnabled = true
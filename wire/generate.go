@@ -0,0 +1,5 @@
+package wire
+
+// 生成pkt与rpc中的代码，protocompile与protoc-gen-go的版本由go.mod固定，见tools.go与proto/improtoc
+//go:generate go build -o ../bin/ google.golang.org/protobuf/cmd/protoc-gen-go ./proto/protoc-gen-im-validate
+//go:generate go run ./proto/improtoc -I proto -plugin ../bin/protoc-gen-go -plugin ../bin/protoc-gen-im-validate -out . common.proto protocol.proto rpc.proto
@@ -18,6 +18,10 @@ type BasicPkt struct {
 }
 
 func (p *BasicPkt) Decode(r io.Reader) error {
+	return p.decode(r, &defaultDecoder.options)
+}
+
+func (p *BasicPkt) decode(r io.Reader, o *DecoderOptions) error {
 	var err error
 	if p.Code, err = endian.ReadUint16(r); err != nil {
 		return err
@@ -25,6 +29,9 @@ func (p *BasicPkt) Decode(r io.Reader) error {
 	if p.Length, err = endian.ReadUint16(r); err != nil {
 		return err
 	}
+	if p.Length > o.MaxBasicBodySize {
+		return ErrPacketTooLarge
+	}
 	if p.Length > 0 {
 		if p.Body, err = endian.ReadFixedBytes(int(p.Length), r); err != nil {
 			return err
@@ -34,16 +41,7 @@ func (p *BasicPkt) Decode(r io.Reader) error {
 }
 
 func (p *BasicPkt) Encode(w io.Writer) error {
-	if err := endian.WriteUint16(w, p.Code); err != nil {
-		return err
-	}
-	if err := endian.WriteUint16(w, p.Length); err != nil {
-		return err
-	}
-	if p.Length > 0 {
-		if _, err := w.Write(p.Body); err != nil {
-			return err
-		}
-	}
-	return nil
+	return encodeTo(w, func(dst []byte) ([]byte, error) {
+		return p.appendTo(dst), nil
+	})
 }
@@ -0,0 +1,239 @@
+package pkt
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"im/wire"
+	"im/wire/endian"
+	"io"
+	"sync"
+)
+
+// ErrShortPacket 数据不完整
+var ErrShortPacket = errors.New("packet is incomplete")
+
+var (
+	// sizeOptions 计算长度时缓存到Header中，marshalOptions复用计算好的长度
+	sizeOptions    = proto.MarshalOptions{}
+	marshalOptions = proto.MarshalOptions{UseCachedSize: true}
+)
+
+// bufPool 编解码时使用的临时缓冲区，超过maxPooledSize的缓冲区不放回
+var bufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+const maxPooledSize = 64 << 10
+
+func getBuffer() *[]byte {
+	return bufPool.Get().(*[]byte)
+}
+
+func putBuffer(b *[]byte) {
+	if cap(*b) > maxPooledSize {
+		return
+	}
+	*b = (*b)[:0]
+	bufPool.Put(b)
+}
+
+// Size 序列化之后的长度，包括magic以及版本化包头
+func (p *LogicPkt) Size() int {
+	n := len(wire.MagicLogicPkt) + 4 + sizeOptions.Size(&p.Header) + 4 + len(p.Body)
+	if p.Version != wire.Version0 {
+		n += versionedSize
+	}
+	return n
+}
+
+// MarshalTo 将包括magic在内的序列化结果追加到dst，返回追加后的切片
+//
+// Version为wire.Version0时使用原始格式，否则写入版本化包头；dst的容量足够时不会分配内存
+func (p *LogicPkt) MarshalTo(dst []byte) ([]byte, error) {
+	if p.Version == wire.Version0 {
+		dst = append(dst, wire.MagicLogicPkt[:]...)
+		return p.appendTo(dst)
+	}
+	if err := checkVersion(p.Version); err != nil {
+		return nil, err
+	}
+	dst = append(dst, wire.MagicVersioned[:]...)
+	dst = append(dst, byte(p.Version), byte(p.wireFlags()))
+	return p.appendTo(dst)
+}
+
+// appendTo 追加不带magic的序列化结果
+func (p *LogicPkt) appendTo(dst []byte) ([]byte, error) {
+	size := sizeOptions.Size(&p.Header)
+	dst = endian.AppendUint32(dst, uint32(size))
+	dst, err := marshalOptions.MarshalAppend(dst, &p.Header)
+	if err != nil {
+		return nil, err
+	}
+	dst = endian.AppendUint32(dst, uint32(len(p.Body)))
+	return append(dst, p.Body...), nil
+}
+
+// UnmarshalFrom 从包括magic在内的b中解码，原始格式与版本化格式都可以读取
+//
+// Body直接引用b，不会复制；p使用期间b不能被修改或者复用
+func (p *LogicPkt) UnmarshalFrom(b []byte) error {
+	return p.unmarshalFrom(b, &defaultDecoder.options)
+}
+
+func (p *LogicPkt) unmarshalFrom(b []byte, o *DecoderOptions) error {
+	if len(b) < len(wire.MagicLogicPkt) {
+		return ErrShortPacket
+	}
+	switch *(*wire.Magic)(b[:4]) {
+	case wire.MagicLogicPkt:
+		if err := p.unmarshal(b[4:], o); err != nil {
+			return err
+		}
+		p.setVersion(wire.Version0, 0)
+		return nil
+	case wire.MagicVersioned:
+		return p.unmarshalVersioned(b[4:], o)
+	}
+	return fmt.Errorf("magic code %x is incorrect", b[:4])
+}
+
+// unmarshalVersioned 解码magic之后的版本化包头以及LogicPkt
+func (p *LogicPkt) unmarshalVersioned(b []byte, o *DecoderOptions) error {
+	if len(b) < versionedSize {
+		return ErrShortPacket
+	}
+	version, flags := wire.Version(b[0]), Flags(b[1])
+	if err := checkVersion(version); err != nil {
+		return err
+	}
+	if err := p.unmarshal(b[versionedSize:], o); err != nil {
+		return err
+	}
+	p.setVersion(version, flags)
+	return nil
+}
+
+// unmarshal 解码不带magic的数据
+func (p *LogicPkt) unmarshal(b []byte, o *DecoderOptions) error {
+	header, b, err := sliceBytes(b, o.MaxHeaderSize)
+	if err != nil {
+		return err
+	}
+	if err = proto.Unmarshal(header, &p.Header); err != nil {
+		return err
+	}
+	body, _, err := sliceBytes(b, o.MaxBodySize)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		body = nil
+	}
+	p.Body = body
+	return nil
+}
+
+// sliceBytes 读取一个uint32长度前缀的切片，返回切片以及剩余的数据
+func sliceBytes(b []byte, limit uint32) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, ErrShortPacket
+	}
+	n := endian.Default.Uint32(b)
+	if n > limit {
+		return nil, nil, ErrPacketTooLarge
+	}
+	b = b[4:]
+	if uint32(len(b)) < n {
+		return nil, nil, ErrShortPacket
+	}
+	return b[:n:n], b[n:], nil
+}
+
+// Size 序列化之后的长度，包括magic
+func (p *BasicPkt) Size() int {
+	n := len(wire.MagicBasicPkt) + 4
+	if p.Length > 0 {
+		n += len(p.Body)
+	}
+	return n
+}
+
+// MarshalTo 将包括magic在内的序列化结果追加到dst，返回追加后的切片
+func (p *BasicPkt) MarshalTo(dst []byte) ([]byte, error) {
+	dst = append(dst, wire.MagicBasicPkt[:]...)
+	return p.appendTo(dst), nil
+}
+
+func (p *BasicPkt) appendTo(dst []byte) []byte {
+	dst = endian.AppendUint16(dst, p.Code)
+	dst = endian.AppendUint16(dst, p.Length)
+	if p.Length > 0 {
+		dst = append(dst, p.Body...)
+	}
+	return dst
+}
+
+// UnmarshalFrom 从包括magic在内的b中解码，Body直接引用b
+func (p *BasicPkt) UnmarshalFrom(b []byte) error {
+	if len(b) < len(wire.MagicBasicPkt) {
+		return ErrShortPacket
+	}
+	if *(*wire.Magic)(b[:4]) != wire.MagicBasicPkt {
+		return fmt.Errorf("magic code %x is incorrect", b[:4])
+	}
+	return p.unmarshal(b[4:], &defaultDecoder.options)
+}
+
+func (p *BasicPkt) unmarshal(b []byte, o *DecoderOptions) error {
+	if len(b) < 4 {
+		return ErrShortPacket
+	}
+	p.Code = endian.Default.Uint16(b)
+	p.Length = endian.Default.Uint16(b[2:])
+	if p.Length > o.MaxBasicBodySize {
+		return ErrPacketTooLarge
+	}
+	b = b[4:]
+	if len(b) < int(p.Length) {
+		return ErrShortPacket
+	}
+	p.Body = nil
+	if p.Length > 0 {
+		p.Body = b[:p.Length:p.Length]
+	}
+	return nil
+}
+
+// Unmarshal 使用默认的长度限制解码LogicPkt或者BasicPkt，Body直接引用b
+func Unmarshal(b []byte) (Packet, error) {
+	return defaultDecoder.Unmarshal(b)
+}
+
+// MarshalTo 将包括magic在内的序列化结果追加到dst
+func MarshalTo(dst []byte, p Packet) ([]byte, error) {
+	switch p := p.(type) {
+	case *LogicPkt:
+		return p.MarshalTo(dst)
+	case *BasicPkt:
+		return p.MarshalTo(dst)
+	}
+	return nil, fmt.Errorf("unexpected packet type %T", p)
+}
+
+// encodeTo 使用pool中的缓冲区序列化之后一次写入w
+func encodeTo(w io.Writer, encode func([]byte) ([]byte, error)) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	b, err := encode(*buf)
+	if err != nil {
+		return err
+	}
+	*buf = b
+	_, err = w.Write(b)
+	return err
+}
@@ -0,0 +1,162 @@
+package pkt
+
+import (
+	"bytes"
+	"google.golang.org/protobuf/proto"
+	"im/wire"
+	"im/wire/endian"
+	"testing"
+)
+
+func testPkt() *LogicPkt {
+	p := New(wire.CommandChatUserTalk, WithChannel("channel1"), WithDest("u2"), WithSeq(10))
+	p.AddStringMeta(wire.MetaDestServer, "gateway01")
+	_ = p.WriteBody(&MessageReq{Type: 1, Body: "hello world"})
+	return p
+}
+
+// legacyMarshal 原来的实现，用于对比兼容性和性能
+func legacyMarshal(p *LogicPkt) []byte {
+	buf := new(bytes.Buffer)
+	_, _ = buf.Write(wire.MagicLogicPkt[:])
+	header, _ := proto.Marshal(&p.Header)
+	_ = endian.WriteBytes(buf, header)
+	_ = endian.WriteBytes(buf, p.Body)
+	return buf.Bytes()
+}
+
+func TestCodecCompatible(t *testing.T) {
+	p := testPkt()
+	b := Marshal(p)
+	if !bytes.Equal(b, legacyMarshal(p)) {
+		t.Fatal("Marshal is not compatible with the legacy encoding")
+	}
+	if len(b) != p.Size() {
+		t.Fatalf("Size %d != %d", p.Size(), len(b))
+	}
+
+	got, err := MustReadLogicPkt(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got2 LogicPkt
+	if err = got2.UnmarshalFrom(b); err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range []*LogicPkt{got, &got2} {
+		if !proto.Equal(&g.Header, &p.Header) || !bytes.Equal(g.Body, p.Body) {
+			t.Fatalf("unexpected packet %v", g)
+		}
+	}
+
+	basic := &BasicPkt{Code: CodePing, Length: 2, Body: []byte("hi")}
+	b = Marshal(basic)
+	pk, err := Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bp := pk.(*BasicPkt); bp.Code != CodePing || string(bp.Body) != "hi" {
+		t.Fatalf("unexpected packet %v", bp)
+	}
+	var buf bytes.Buffer
+	_ = basic.Encode(&buf)
+	if !bytes.Equal(buf.Bytes(), b[4:]) {
+		t.Fatal("Encode is not consistent with MarshalTo")
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	b := Marshal(testPkt())
+	for i := 0; i < len(b); i++ {
+		if _, err := Unmarshal(b[:i]); err == nil {
+			t.Fatalf("Unmarshal should fail with %d bytes", i)
+		}
+	}
+	large := append([]byte{}, wire.MagicLogicPkt[:]...)
+	large = endian.AppendUint32(large, DefaultMaxHeaderSize+1)
+	if _, err := Unmarshal(large); err != ErrPacketTooLarge {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestCodecAllocs(t *testing.T) {
+	p := testPkt()
+	dst := make([]byte, 0, 1024)
+	if n := testing.AllocsPerRun(100, func() {
+		_, _ = p.MarshalTo(dst[:0])
+	}); n != 0 {
+		t.Fatalf("MarshalTo allocs %v", n)
+	}
+	b := Marshal(&BasicPkt{Code: CodePong})
+	var bp BasicPkt
+	if n := testing.AllocsPerRun(100, func() {
+		_ = bp.UnmarshalFrom(b)
+	}); n != 0 {
+		t.Fatalf("UnmarshalFrom allocs %v", n)
+	}
+}
+
+func BenchmarkMarshalLegacy(b *testing.B) {
+	p := testPkt()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = legacyMarshal(p)
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	p := testPkt()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Marshal(p)
+	}
+}
+
+func BenchmarkMarshalTo(b *testing.B) {
+	p := testPkt()
+	dst := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = p.MarshalTo(dst[:0])
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	buf := Marshal(testPkt())
+	r := bytes.NewReader(buf)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(buf)
+		_, _ = Read(r)
+	}
+}
+
+func BenchmarkUnmarshalFrom(b *testing.B) {
+	buf := Marshal(testPkt())
+	var p LogicPkt
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = p.UnmarshalFrom(buf)
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	p := testPkt()
+	p.Body = make([]byte, 100)
+	b := Marshal(p)
+	d := NewDecoder(WithMaxBodySize(99))
+	if _, err := d.Unmarshal(b); err != ErrPacketTooLarge {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := d.Read(bytes.NewReader(b)); err != ErrPacketTooLarge {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// 默认限制不受影响
+	if _, err := Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	basic := Marshal(&BasicPkt{Code: CodePing, Length: 8, Body: make([]byte, 8)})
+	if _, err := NewDecoder(WithMaxBasicBodySize(4)).Unmarshal(basic); err != ErrPacketTooLarge {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+package pkt
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"im/wire"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Compression Body的压缩算法，压缩后的Body第一个字节是算法
+type Compression uint8
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionDeflate
+	CompressionZstd
+	// CompressionSnappy snappy block格式，不使用framing格式
+	CompressionSnappy
+)
+
+var compressionNames = map[Compression]string{
+	CompressionNone:    "none",
+	CompressionGzip:    "gzip",
+	CompressionDeflate: "deflate",
+	CompressionZstd:    "zstd",
+	CompressionSnappy:  "snappy",
+}
+
+func (c Compression) String() string {
+	if name, ok := compressionNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("compression(%d)", c)
+}
+
+// ParseCompression 根据名称返回压缩算法
+func ParseCompression(name string) (Compression, bool) {
+	for c, n := range compressionNames {
+		if n == name {
+			return c, true
+		}
+	}
+	return CompressionNone, false
+}
+
+// DefaultCompressThreshold Body超过这个长度时才压缩
+const DefaultCompressThreshold = 1024
+
+// CompressOptions 压缩配置，由各个服务自己决定
+type CompressOptions struct {
+	Threshold int // Body超过这个长度时才压缩
+}
+
+// CompressOption CompressOption
+type CompressOption func(*CompressOptions)
+
+// WithCompressThreshold set min size of the body to compress
+func WithCompressThreshold(size int) CompressOption {
+	return func(opts *CompressOptions) {
+		opts.Threshold = size
+	}
+}
+
+// errors
+var (
+	ErrUnknownCompression = errors.New("unknown compression")
+	ErrVersionRequired    = errors.New("compression requires a versioned packet")
+)
+
+// Compressor 压缩算法的实现
+type Compressor interface {
+	// Compress 将src压缩后追加到dst
+	Compress(dst, src []byte) ([]byte, error)
+	// Decompress 解压src，结果超过limit时返回ErrPacketTooLarge
+	Decompress(src []byte, limit int) ([]byte, error)
+}
+
+var (
+	compressorLock sync.RWMutex
+	compressors    = map[Compression]Compressor{
+		CompressionGzip:    newGzipCompressor(),
+		CompressionDeflate: newFlateCompressor(),
+		CompressionZstd:    newZstdCompressor(),
+		CompressionSnappy:  snappyCompressor{},
+	}
+)
+
+// RegisterCompressor 注册压缩算法，可以替换内置的实现
+func RegisterCompressor(c Compression, compressor Compressor) {
+	compressorLock.Lock()
+	defer compressorLock.Unlock()
+	compressors[c] = compressor
+}
+
+func getCompressor(c Compression) (Compressor, bool) {
+	compressorLock.RLock()
+	defer compressorLock.RUnlock()
+	compressor, ok := compressors[c]
+	return compressor, ok
+}
+
+// SupportedCompressions 已经注册的压缩算法
+func SupportedCompressions() []Compression {
+	compressorLock.RLock()
+	defer compressorLock.RUnlock()
+	var list []Compression
+	for c := CompressionGzip; c <= CompressionSnappy; c++ {
+		if _, ok := compressors[c]; ok {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+// Compress Body超过阈值（默认DefaultCompressThreshold）时使用c压缩，并设置FlagCompressed；压缩后没有变小时保持不变
+//
+// 原始格式没有标志位，只有版本化的包可以压缩
+func (p *LogicPkt) Compress(c Compression, opts ...CompressOption) error {
+	options := CompressOptions{Threshold: DefaultCompressThreshold}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if c == CompressionNone || p.Flags.Has(FlagCompressed) || len(p.Body) <= options.Threshold {
+		return nil
+	}
+	if p.Version == wire.Version0 {
+		return ErrVersionRequired
+	}
+	compressor, ok := getCompressor(c)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCompression, c)
+	}
+	body, err := compressor.Compress([]byte{byte(c)}, p.Body)
+	if err != nil {
+		return err
+	}
+	if len(body) >= len(p.Body) {
+		return nil
+	}
+	p.Body = body
+	p.Flags |= FlagCompressed
+	return nil
+}
+
+// Decompress 解压设置了FlagCompressed的Body，解压后的长度不能超过DefaultMaxBodySize
+func (p *LogicPkt) Decompress() error {
+	return p.decompress(DefaultMaxBodySize)
+}
+
+func (p *LogicPkt) decompress(limit uint32) error {
+	if !p.Flags.Has(FlagCompressed) {
+		return nil
+	}
+	if len(p.Body) == 0 {
+		return fmt.Errorf("%w: empty body", ErrUnknownCompression)
+	}
+	c := Compression(p.Body[0])
+	compressor, ok := getCompressor(c)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCompression, c)
+	}
+	body, err := compressor.Decompress(p.Body[1:], int(limit))
+	if err != nil {
+		return err
+	}
+	p.Body = body
+	p.Flags &^= FlagCompressed
+	return nil
+}
+
+// AddAcceptCompression 客户端在登录包中声明支持的压缩算法，按照优先级排列
+func (p *LogicPkt) AddAcceptCompression(list ...Compression) {
+	names := make([]string, 0, len(list))
+	for _, c := range list {
+		names = append(names, c.String())
+	}
+	p.AddStringMeta(wire.MetaAcceptCompression, strings.Join(names, ","))
+}
+
+// NegotiateCompression 服务端按照客户端的优先级选择双方都支持的压缩算法，没有时返回CompressionNone
+//
+// 服务端需要将结果通过wire.MetaCompression告知客户端
+func NegotiateCompression(login *LogicPkt, supported ...Compression) Compression {
+	accept, err := login.GetStringMeta(wire.MetaAcceptCompression)
+	if err != nil {
+		return CompressionNone
+	}
+	if len(supported) == 0 {
+		supported = SupportedCompressions()
+	}
+	for _, name := range strings.Split(accept, ",") {
+		c, ok := ParseCompression(strings.TrimSpace(name))
+		if !ok || c == CompressionNone {
+			continue
+		}
+		for _, s := range supported {
+			if s == c {
+				return c
+			}
+		}
+	}
+	return CompressionNone
+}
+
+// decompress 从r中读取解压后的数据，超过limit时返回ErrPacketTooLarge
+func decompress(r io.Reader, limit int) ([]byte, error) {
+	var buf bytes.Buffer
+	n, err := buf.ReadFrom(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > int64(limit) {
+		return nil, ErrPacketTooLarge
+	}
+	return buf.Bytes(), nil
+}
+
+// gzipCompressor 复用gzip.Writer
+type gzipCompressor struct {
+	writers sync.Pool
+}
+
+func newGzipCompressor() *gzipCompressor {
+	return &gzipCompressor{writers: sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}}}
+}
+
+func (g *gzipCompressor) Compress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	w := g.writers.Get().(*gzip.Writer)
+	defer g.writers.Put(w)
+	w.Reset(buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (g *gzipCompressor) Decompress(src []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return decompress(r, limit)
+}
+
+// flateCompressor 复用flate.Writer
+type flateCompressor struct {
+	writers sync.Pool
+}
+
+func newFlateCompressor() *flateCompressor {
+	return &flateCompressor{writers: sync.Pool{New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	}}}
+}
+
+func (f *flateCompressor) Compress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	w := f.writers.Get().(*flate.Writer)
+	defer f.writers.Put(w)
+	w.Reset(buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *flateCompressor) Decompress(src []byte, limit int) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return decompress(r, limit)
+}
+
+// zstdCompressor EncodeAll可以并发调用；解码使用单协程的Decoder，按需从pool中获取
+type zstdCompressor struct {
+	encoder  *zstd.Encoder
+	decoders sync.Pool
+}
+
+func newZstdCompressor() *zstdCompressor {
+	encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	return &zstdCompressor{encoder: encoder, decoders: sync.Pool{New: func() interface{} {
+		d, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		return d
+	}}}
+}
+
+func (z *zstdCompressor) Compress(dst, src []byte) ([]byte, error) {
+	return z.encoder.EncodeAll(src, dst), nil
+}
+
+// Decompress 在分配窗口之前先根据帧头检查解压后的长度
+func (z *zstdCompressor) Decompress(src []byte, limit int) ([]byte, error) {
+	var h zstd.Header
+	if err := h.Decode(src); err != nil {
+		return nil, err
+	}
+	if (h.HasFCS && h.FrameContentSize > uint64(limit)) || h.WindowSize > uint64(limit) {
+		return nil, ErrPacketTooLarge
+	}
+	d := z.decoders.Get().(*zstd.Decoder)
+	defer z.decoders.Put(d)
+	if err := d.Reset(bytes.NewReader(src)); err != nil {
+		return nil, err
+	}
+	return decompress(d, limit)
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Compress(dst, src []byte) ([]byte, error) {
+	return append(dst, snappy.Encode(nil, src)...), nil
+}
+
+func (snappyCompressor) Decompress(src []byte, limit int) ([]byte, error) {
+	size, err := snappy.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if size > limit {
+		return nil, ErrPacketTooLarge
+	}
+	return snappy.Decode(nil, src)
+}
@@ -0,0 +1,156 @@
+package pkt
+
+import (
+	"bytes"
+	"errors"
+	"im/wire"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func largePkt() *LogicPkt {
+	p := New(wire.CommandChatUserTalk, WithDest("u2"))
+	p.Version = wire.Version1
+	_ = p.WriteBody(&MessageReq{Type: 1, Body: strings.Repeat("hello world ", 200)})
+	return p
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	for _, c := range SupportedCompressions() {
+		p := largePkt()
+		size := len(p.Body)
+		if err := p.Compress(c); err != nil {
+			t.Fatal(err)
+		}
+		if !p.Flags.Has(FlagCompressed) || len(p.Body) >= size || p.Body[0] != byte(c) {
+			t.Fatalf("%s: body is not compressed, %d -> %d", c, size, len(p.Body))
+		}
+
+		read, err := MustReadLogicPkt(bytes.NewReader(Marshal(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !read.Flags.Has(FlagCompressed) {
+			t.Fatalf("%s: compressed flag is lost", c)
+		}
+		var req MessageReq
+		if err = read.ReadBody(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Body != strings.Repeat("hello world ", 200) || read.Flags.Has(FlagCompressed) {
+			t.Fatalf("%s: unexpected body %d", c, len(req.Body))
+		}
+	}
+}
+
+func TestCompressSkipped(t *testing.T) {
+	// 小于阈值时不压缩
+	p := testPkt()
+	p.Version = wire.Version1
+	body := p.Body
+	if err := p.Compress(CompressionGzip); err != nil || p.Flags.Has(FlagCompressed) || !bytes.Equal(p.Body, body) {
+		t.Fatalf("small body should not be compressed, %v", err)
+	}
+	p = largePkt()
+	if err := p.Compress(CompressionGzip, WithCompressThreshold(len(p.Body))); err != nil || p.Flags.Has(FlagCompressed) {
+		t.Fatalf("body under the threshold should not be compressed, %v", err)
+	}
+
+	// 原始格式没有标志位
+	p = largePkt()
+	p.Version = wire.Version0
+	if err := p.Compress(CompressionGzip); !errors.Is(err, ErrVersionRequired) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	p.Version = wire.Version1
+	if err := p.Compress(Compression(9)); !errors.Is(err, ErrUnknownCompression) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	p := New(wire.CommandChatUserTalk)
+	p.Version = wire.Version1
+	for _, c := range SupportedCompressions() {
+		p.Body = make([]byte, 4096)
+		if err := p.Compress(c); err != nil || !p.Flags.Has(FlagCompressed) {
+			t.Fatalf("%s: body is not compressed, %v", c, err)
+		}
+		var body MessageReq
+		if err := NewDecoder(WithMaxBodySize(1024)).ReadBody(p, &body); !errors.Is(err, ErrPacketTooLarge) {
+			t.Fatalf("%s: unexpected error %v", c, err)
+		}
+		p.Flags &^= FlagCompressed
+	}
+}
+
+func TestNegotiateCompression(t *testing.T) {
+	login := New(wire.CommandLoginSignIn)
+	if c := NegotiateCompression(login); c != CompressionNone {
+		t.Fatalf("unexpected compression %s", c)
+	}
+	login.AddAcceptCompression(CompressionZstd, CompressionDeflate, CompressionGzip)
+	if c := NegotiateCompression(login); c != CompressionZstd {
+		t.Fatalf("unexpected compression %s", c)
+	}
+	if c := NegotiateCompression(login, CompressionDeflate, CompressionGzip); c != CompressionDeflate {
+		t.Fatalf("unexpected compression %s", c)
+	}
+	if c := NegotiateCompression(login, CompressionGzip); c != CompressionGzip {
+		t.Fatalf("unexpected compression %s", c)
+	}
+	if c := NegotiateCompression(login, CompressionSnappy); c != CompressionNone {
+		t.Fatalf("unexpected compression %s", c)
+	}
+}
+
+func TestSnappy(t *testing.T) {
+	// 按照snappy格式手写的数据：长度10，literal "ab"，offset 2 长度8的copy
+	got, err := snappyCompressor{}.Decompress([]byte{0x0a, 0x04, 'a', 'b', 0x11, 0x02}, 1024)
+	if err != nil || string(got) != "ababababab" {
+		t.Fatalf("unexpected %q %v", got, err)
+	}
+	if _, err = (snappyCompressor{}).Decompress([]byte{0x0a, 0x04, 'a', 'b', 0x11, 0x03}, 1024); err == nil {
+		t.Fatal("expect corrupt input")
+	}
+	if _, err = (snappyCompressor{}).Decompress([]byte{0x0a, 0x04, 'a', 'b', 0x11, 0x02}, 9); !errors.Is(err, ErrPacketTooLarge) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// FuzzDecompress 解压来自网络的数据不能panic，也不能超过limit
+func FuzzDecompress(f *testing.F) {
+	rnd := rand.New(rand.NewSource(1))
+	src := make([]byte, 2048)
+	for i := range src {
+		if i < 64 || rnd.Intn(2) == 0 {
+			src[i] = byte(rnd.Intn(256))
+		} else {
+			src[i] = src[i-1-rnd.Intn(64)]
+		}
+	}
+	for _, c := range SupportedCompressions() {
+		compressor, _ := getCompressor(c)
+		enc, err := compressor.Compress([]byte{byte(c)}, src)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(enc)
+		f.Add(enc[:len(enc)/2])
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		compressor, ok := getCompressor(Compression(data[0]))
+		if !ok {
+			return
+		}
+		const limit = 4096
+		body, err := compressor.Decompress(data[1:], limit)
+		if err == nil && len(body) > limit {
+			t.Fatalf("%s: decompressed %d bytes over the limit", Compression(data[0]), len(body))
+		}
+	})
+}
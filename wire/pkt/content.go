@@ -0,0 +1,154 @@
+package pkt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"im/wire"
+	"im/wire/validate"
+	"sync"
+)
+
+// errors
+var (
+	ErrUnknownContentType = errors.New("unknown content type")
+	ErrUnknownBodyType    = errors.New("unknown body type")
+)
+
+// json使用protojson，字段名与enum的格式与原来encoding/json的输出相同，忽略不认识的字段便于客户端升级
+var (
+	jsonMarshal   = protojson.MarshalOptions{UseProtoNames: true, UseEnumNumbers: true}
+	jsonUnmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}
+)
+
+// marshalBody 按照ct编码val
+func marshalBody(ct ContentType, val proto.Message) ([]byte, error) {
+	switch ct {
+	case ContentType_Json:
+		return jsonMarshal.Marshal(val)
+	case ContentType_Protobuf:
+		return proto.Marshal(val)
+	}
+	return nil, ErrUnknownContentType
+}
+
+// unmarshalBody 按照ct解码body，然后执行生成的Validate，失败时返回的错误对应Status_InvalidPacketBody
+func unmarshalBody(ct ContentType, body []byte, val proto.Message) error {
+	var err error
+	switch ct {
+	case ContentType_Json:
+		err = jsonUnmarshal.Unmarshal(body, val)
+	case ContentType_Protobuf:
+		err = proto.Unmarshal(body, val)
+	default:
+		return ErrUnknownContentType
+	}
+	if err != nil {
+		return err
+	}
+	return validate.Check(val)
+}
+
+type bodyKey struct {
+	command string
+	flag    Flag
+}
+
+var (
+	bodyLock  sync.RWMutex
+	bodyTypes = make(map[bodyKey]protoreflect.MessageType)
+)
+
+// RegisterBodyType 注册command在flag方向上的Body类型，Transcode根据它解码Body
+func RegisterBodyType(command string, flag Flag, val proto.Message) {
+	bodyLock.Lock()
+	defer bodyLock.Unlock()
+	bodyTypes[bodyKey{command, flag}] = val.ProtoReflect().Type()
+}
+
+// NewBody 创建一个header对应的Body消息，状态不是Success的响应的Body是ErrorResp
+func NewBody(header *Header) (proto.Message, error) {
+	if header.Flag == Flag_Response && header.Status != Status_Success {
+		return new(ErrorResp), nil
+	}
+	bodyLock.RLock()
+	mt, ok := bodyTypes[bodyKey{header.Command, header.Flag}]
+	bodyLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrUnknownBodyType, header.Command, header.Flag)
+	}
+	return mt.New().Interface(), nil
+}
+
+// Transcode 将Body转换成to编码，Body的类型由RegisterBodyType决定；空的Body只修改ContentType
+func (p *LogicPkt) Transcode(to ContentType) error {
+	if p.ContentType == to {
+		return nil
+	}
+	if len(p.Body) == 0 {
+		p.ContentType = to
+		return nil
+	}
+	val, err := NewBody(&p.Header)
+	if err != nil {
+		return err
+	}
+	if err = p.ReadBody(val); err != nil {
+		return err
+	}
+	body, err := marshalBody(to, val)
+	if err != nil {
+		return err
+	}
+	p.Body = body
+	p.ContentType = to
+	return nil
+}
+
+// TranscodeFrame 将一个序列化的包转换成to编码，BasicPkt原样返回
+//
+// 网关在web客户端（json）与后端服务（protobuf）之间转发时使用
+func TranscodeFrame(payload []byte, to ContentType) ([]byte, error) {
+	val, err := Read(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	p, ok := val.(*LogicPkt)
+	if !ok || p.ContentType == to {
+		return payload, nil
+	}
+	if err = p.Transcode(to); err != nil {
+		return nil, err
+	}
+	return Marshal(p), nil
+}
+
+func init() {
+	RegisterBodyType(wire.CommandLoginSignIn, Flag_Request, new(LoginReq))
+	RegisterBodyType(wire.CommandLoginSignIn, Flag_Response, new(LoginResp))
+	for _, command := range []string{wire.CommandChatUserTalk, wire.CommandChatGroupTalk} {
+		RegisterBodyType(command, Flag_Request, new(MessageReq))
+		RegisterBodyType(command, Flag_Response, new(MessageResp))
+		RegisterBodyType(command, Flag_Push, new(MessagePush))
+	}
+	RegisterBodyType(wire.CommandChatTalkAck, Flag_Request, new(MessageAckReq))
+	RegisterBodyType(wire.CommandOfflineIndex, Flag_Request, new(MessageIndexReq))
+	RegisterBodyType(wire.CommandOfflineIndex, Flag_Response, new(MessageIndexResp))
+	RegisterBodyType(wire.CommandOfflineContent, Flag_Request, new(MessageContentReq))
+	RegisterBodyType(wire.CommandOfflineContent, Flag_Response, new(MessageContentResp))
+	RegisterBodyType(wire.CommandKeyBundleUpload, Flag_Request, new(KeyBundleUploadReq))
+	RegisterBodyType(wire.CommandKeyBundleFetch, Flag_Request, new(KeyBundleFetchReq))
+	RegisterBodyType(wire.CommandKeyBundleFetch, Flag_Response, new(KeyBundleFetchResp))
+	RegisterBodyType(wire.CommandGroupCreate, Flag_Request, new(GroupCreateReq))
+	RegisterBodyType(wire.CommandGroupCreate, Flag_Response, new(GroupCreateResp))
+	RegisterBodyType(wire.CommandGroupCreate, Flag_Push, new(GroupCreateNotify))
+	RegisterBodyType(wire.CommandGroupJoin, Flag_Request, new(GroupJoinReq))
+	RegisterBodyType(wire.CommandGroupJoin, Flag_Push, new(GroupJoinNotify))
+	RegisterBodyType(wire.CommandGroupQuit, Flag_Request, new(GroupQuitReq))
+	RegisterBodyType(wire.CommandGroupQuit, Flag_Push, new(GroupQuitNotify))
+	RegisterBodyType(wire.CommandGroupDetail, Flag_Request, new(GroupGetReq))
+	RegisterBodyType(wire.CommandGroupDetail, Flag_Response, new(GroupGetResp))
+}
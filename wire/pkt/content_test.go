@@ -0,0 +1,224 @@
+package pkt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"im/wire"
+	"im/wire/endian"
+	"im/wire/validate"
+	"strings"
+	"testing"
+)
+
+func TestBodyContentType(t *testing.T) {
+	req := &MessageReq{Type: 1, Body: "hello"}
+	for _, ct := range []ContentType{ContentType_Protobuf, ContentType_Json} {
+		p := New(wire.CommandChatUserTalk, WithContentType(ct))
+		if err := p.WriteBody(req); err != nil {
+			t.Fatal(err)
+		}
+		got := new(MessageReq)
+		if err := p.ReadBody(got); err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(got, req) {
+			t.Fatalf("%s: unexpected body %v", ct, got)
+		}
+	}
+
+	p := New(wire.CommandChatUserTalk, WithContentType(ContentType_Json))
+	p.Body = []byte("not json")
+	if err := p.ReadBody(new(MessageReq)); err == nil {
+		t.Fatal("ReadBody should return the decode error")
+	}
+	p.ContentType = ContentType(9)
+	if err := p.WriteBody(req); err != ErrUnknownContentType {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	p := New(wire.CommandChatUserTalk, WithContentType(ContentType_Json))
+	p.Flag = Flag_Push
+	push := &MessagePush{MessageId: 1, Body: "hello", Sender: "u1"}
+	_ = p.WriteBody(push)
+
+	frame, err := TranscodeFrame(Marshal(p), ContentType_Protobuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp, err := MustReadLogicPkt(strings.NewReader(string(frame)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pp.ContentType != ContentType_Protobuf {
+		t.Fatalf("unexpected content type %s", pp.ContentType)
+	}
+	got := new(MessagePush)
+	if err = proto.Unmarshal(pp.Body, got); err != nil || !proto.Equal(got, push) {
+		t.Fatalf("unexpected body %v %v", got, err)
+	}
+
+	// 错误响应的Body是ErrorResp
+	resp := NewFrom(&pp.Header)
+	resp.Flag = Flag_Response
+	resp.Status = Status_InvalidPacketBody
+	_ = resp.WriteBody(&ErrorResp{Message: "bad"})
+	if err = resp.Transcode(ContentType_Json); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resp.StringBody(), `"message":"bad"`) {
+		t.Fatalf("unexpected json body %s", resp.StringBody())
+	}
+
+	unknown := New("unknown.command", WithContentType(ContentType_Json))
+	unknown.Body = []byte("{}")
+	if err = unknown.Transcode(ContentType_Protobuf); !errors.Is(err, ErrUnknownBodyType) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// 旧的客户端不设置ContentType，Body是json
+func TestBaselineJSONBody(t *testing.T) {
+	header, err := proto.Marshal(&Header{Command: wire.CommandChatUserTalk, Sequence: 1, Dest: "u2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"type":1,"body":"hello"}`)
+	var buf bytes.Buffer
+	buf.Write(wire.MagicLogicPkt[:])
+	_ = endian.WriteBytes(&buf, header)
+	_ = endian.WriteBytes(&buf, body)
+
+	p, err := Unmarshal(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := new(MessageReq)
+	if err = p.(*LogicPkt).ReadBody(req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Type != 1 || req.Body != "hello" {
+		t.Fatalf("unexpected body %v", req)
+	}
+
+	// 响应的字段名与原来相同，protojson中int64是字符串
+	resp := NewFrom(&p.(*LogicPkt).Header)
+	if err = resp.WriteBody(&MessageResp{MessageId: 123, SendTime: 456}); err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(resp.Body, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["messageId"] != "123" || fields["sendTime"] != "456" {
+		t.Fatalf("unexpected body %s", resp.Body)
+	}
+}
+
+// enumBody 包含enum与oneof的消息，encoding/json无法正确处理
+func enumBody(t *testing.T) protoreflect.MessageType {
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/enum_body.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Kind"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("Text"), Number: proto.Int32(0)},
+				{Name: proto.String("Image"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("EnumBody"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("kind"), Number: proto.Int32(1), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type: descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum(), TypeName: proto.String(".test.Kind"), JsonName: proto.String("kind")},
+				{Name: proto.String("text"), Number: proto.Int32(2), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), OneofIndex: proto.Int32(0), JsonName: proto.String("text")},
+				{Name: proto.String("image_url"), Number: proto.Int32(3), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), OneofIndex: proto.Int32(0), JsonName: proto.String("imageUrl")},
+			},
+			OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("content")}},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dynamicpb.NewMessageType(fd.Messages().Get(0))
+}
+
+func TestJSONEnumOneof(t *testing.T) {
+	mt := enumBody(t)
+	md := mt.Descriptor()
+	val := mt.New()
+	val.Set(md.Fields().ByName("kind"), protoreflect.ValueOfEnum(1))
+	val.Set(md.Fields().ByName("image_url"), protoreflect.ValueOfString("a.png"))
+	RegisterBodyType("test.enum", Flag_Request, val.Interface())
+
+	p := New("test.enum", WithContentType(ContentType_Json))
+	if err := p.WriteBody(val.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(p.Body, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["kind"] != float64(1) || fields["image_url"] != "a.png" {
+		t.Fatalf("unexpected json body %s", p.Body)
+	}
+	got := mt.New().Interface()
+	if err := p.ReadBody(got); err != nil || !proto.Equal(got, val.Interface()) {
+		t.Fatalf("unexpected body %v %v", got, err)
+	}
+
+	// json -> protobuf -> json
+	frame, err := TranscodeFrame(Marshal(p), ContentType_Protobuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp, err := MustReadLogicPkt(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = mt.New().Interface()
+	if err = proto.Unmarshal(pp.Body, got); err != nil || !proto.Equal(got, val.Interface()) {
+		t.Fatalf("unexpected protobuf body %v %v", got, err)
+	}
+	if err = pp.Transcode(ContentType_Json); err != nil {
+		t.Fatal(err)
+	}
+	got = mt.New().Interface()
+	if err = pp.ReadBody(got); err != nil || !proto.Equal(got, val.Interface()) {
+		t.Fatalf("unexpected json body %v %v", got, err)
+	}
+
+	// 不认识的字段被忽略
+	p.Body = []byte(`{"kind":1,"text":"hi","unknown":true}`)
+	got = mt.New().Interface()
+	if err = p.ReadBody(got); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ReadBody执行生成的Validate
+func TestReadBodyValidate(t *testing.T) {
+	p := New(wire.CommandGroupDetail)
+	if err := p.WriteBody(&GroupGetReq{}); err != nil {
+		t.Fatal(err)
+	}
+	err := p.ReadBody(new(GroupGetReq))
+	if !errors.Is(err, validate.ErrInvalidField) || StatusOf(err) != Status_InvalidPacketBody {
+		t.Fatalf("unexpected error %v", err)
+	}
+	_ = p.WriteBody(&GroupGetReq{GroupId: "g1"})
+	if err = p.ReadBody(new(GroupGetReq)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,144 @@
+package pkt
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"im/wire"
+	"io"
+)
+
+// 默认的解码长度限制
+const (
+	DefaultMaxHeaderSize    uint32 = 64 << 10
+	DefaultMaxBodySize      uint32 = 4 << 20
+	DefaultMaxBasicBodySize uint16 = 4 << 10
+)
+
+// DecoderOptions 解码时的长度限制，超过时返回ErrPacketTooLarge
+type DecoderOptions struct {
+	MaxHeaderSize    uint32
+	MaxBodySize      uint32 // 也是解压后Body的最大长度
+	MaxBasicBodySize uint16
+}
+
+// DecoderOption DecoderOption
+type DecoderOption func(*DecoderOptions)
+
+// WithMaxHeaderSize set max size of the LogicPkt header
+func WithMaxHeaderSize(size uint32) DecoderOption {
+	return func(opts *DecoderOptions) {
+		opts.MaxHeaderSize = size
+	}
+}
+
+// WithMaxBodySize set max size of the LogicPkt body
+func WithMaxBodySize(size uint32) DecoderOption {
+	return func(opts *DecoderOptions) {
+		opts.MaxBodySize = size
+	}
+}
+
+// WithMaxBasicBodySize set max size of the BasicPkt body
+func WithMaxBasicBodySize(size uint16) DecoderOption {
+	return func(opts *DecoderOptions) {
+		opts.MaxBasicBodySize = size
+	}
+}
+
+// Decoder 按照各自的长度限制解码，创建之后只读，可以被多个连接并发使用
+type Decoder struct {
+	options DecoderOptions
+}
+
+// NewDecoder NewDecoder
+func NewDecoder(opts ...DecoderOption) *Decoder {
+	d := &Decoder{
+		options: DecoderOptions{
+			MaxHeaderSize:    DefaultMaxHeaderSize,
+			MaxBodySize:      DefaultMaxBodySize,
+			MaxBasicBodySize: DefaultMaxBasicBodySize,
+		},
+	}
+	for _, opt := range opts {
+		opt(&d.options)
+	}
+	return d
+}
+
+// defaultDecoder 包级别的Read、Unmarshal以及Packet.Decode使用默认限制
+var defaultDecoder = NewDecoder()
+
+// Options 返回d的长度限制
+func (d *Decoder) Options() DecoderOptions {
+	return d.options
+}
+
+// Read 根据magic读取一个包，原始格式与版本化格式都可以读取
+func (d *Decoder) Read(r io.Reader) (interface{}, error) {
+	magic := wire.Magic{}
+	_, err := io.ReadFull(r, magic[:])
+	if err != nil {
+		return nil, err
+	}
+	switch magic {
+	case wire.MagicLogicPkt:
+		p := new(LogicPkt)
+		if err := p.decode(r, &d.options); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case wire.MagicBasicPkt:
+		p := new(BasicPkt)
+		if err := p.decode(r, &d.options); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case wire.MagicVersioned:
+		var header [versionedSize]byte
+		if _, err = io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		version, flags := wire.Version(header[0]), Flags(header[1])
+		if err = checkVersion(version); err != nil {
+			return nil, err
+		}
+		p := new(LogicPkt)
+		if err := p.decode(r, &d.options); err != nil {
+			return nil, err
+		}
+		p.setVersion(version, flags)
+		return p, nil
+	default:
+		return nil, fmt.Errorf("magic code %s is incorrect", magic)
+	}
+}
+
+// Unmarshal 根据magic以及版本解码LogicPkt或者BasicPkt，Body直接引用b
+func (d *Decoder) Unmarshal(b []byte) (Packet, error) {
+	if len(b) < 4 {
+		return nil, ErrShortPacket
+	}
+	switch *(*wire.Magic)(b[:4]) {
+	case wire.MagicLogicPkt, wire.MagicVersioned:
+		p := new(LogicPkt)
+		if err := p.unmarshalFrom(b, &d.options); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case wire.MagicBasicPkt:
+		p := new(BasicPkt)
+		if err := p.unmarshal(b[4:], &d.options); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	return nil, fmt.Errorf("magic code %x is incorrect", b[:4])
+}
+
+// ReadBody 与LogicPkt.ReadBody相同，解压后的长度不能超过MaxBodySize
+func (d *Decoder) ReadBody(p *LogicPkt, val proto.Message) error {
+	if err := p.decompress(d.options.MaxBodySize); err != nil {
+		return err
+	}
+	return unmarshalBody(p.ContentType, p.Body, val)
+}
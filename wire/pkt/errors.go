@@ -0,0 +1,93 @@
+package pkt
+
+import (
+	"errors"
+	"im/wire/validate"
+	"sync"
+)
+
+// Error 带有Status的错误，可以直接转换成响应返回给客户端
+type Error struct {
+	Status  Status
+	Message string
+}
+
+// NewError NewError
+func NewError(status Status, message string) *Error {
+	return &Error{Status: status, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	statusLock sync.RWMutex
+	statuses   = []struct {
+		err    error
+		status Status
+	}{
+		{ErrPacketTooLarge, Status_PacketTooLarge},
+		{ErrUnsupportedVersion, Status_VersionUnsupported},
+		{ErrShortPacket, Status_InvalidPacketBody},
+		{ErrUnknownContentType, Status_InvalidPacketBody},
+		{ErrUnknownBodyType, Status_InvalidCommand},
+		{ErrUnknownCompression, Status_InvalidPacketBody},
+		{validate.ErrInvalidField, Status_InvalidPacketBody},
+	}
+)
+
+// RegisterErrorStatus 注册一个sentinel错误对应的Status，用于没有使用Error定义的错误
+func RegisterErrorStatus(err error, status Status) {
+	statusLock.Lock()
+	defer statusLock.Unlock()
+	statuses = append(statuses, struct {
+		err    error
+		status Status
+	}{err, status})
+}
+
+// StatusOf 返回err对应的Status，nil为Success，无法识别的错误为SystemException
+func StatusOf(err error) Status {
+	if err == nil {
+		return Status_Success
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Status
+	}
+	statusLock.RLock()
+	defer statusLock.RUnlock()
+	for _, s := range statuses {
+		if errors.Is(err, s.err) {
+			return s.status
+		}
+	}
+	return Status_SystemException
+}
+
+// NewErrorResp 将处理req时返回的错误转换成一个响应，Body是ErrorResp
+func NewErrorResp(req *LogicPkt, err error) *LogicPkt {
+	resp := NewFrom(&req.Header)
+	resp.Version = req.Version
+	resp.Flag = Flag_Response
+	resp.Status = StatusOf(err)
+	if err != nil {
+		_ = resp.WriteBody(&ErrorResp{Message: err.Error()})
+	}
+	return resp
+}
+
+// Err 客户端读取响应的错误，状态为Success时返回nil，否则返回*Error，可以使用StatusOf判断
+func (p *LogicPkt) Err() error {
+	if p.Status == Status_Success {
+		return nil
+	}
+	var resp ErrorResp
+	_ = p.ReadBody(&resp)
+	message := resp.Message
+	if message == "" {
+		message = p.Status.String()
+	}
+	return NewError(p.Status, message)
+}
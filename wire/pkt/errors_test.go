@@ -0,0 +1,53 @@
+package pkt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"im/wire"
+	"testing"
+)
+
+func TestStatusOf(t *testing.T) {
+	errFoo := errors.New("foo")
+	RegisterErrorStatus(errFoo, Status_Unauthorized)
+	cases := []struct {
+		err    error
+		status Status
+	}{
+		{nil, Status_Success},
+		{NewError(Status_NoDestination, "no dest"), Status_NoDestination},
+		{fmt.Errorf("wrapped: %w", NewError(Status_Kicked, "kicked")), Status_Kicked},
+		{fmt.Errorf("read: %w", ErrPacketTooLarge), Status_PacketTooLarge},
+		{fmt.Errorf("%w: 9", ErrUnsupportedVersion), Status_VersionUnsupported},
+		{(&GroupGetReq{}).Validate(), Status_InvalidPacketBody},
+		{errFoo, Status_Unauthorized},
+		{errors.New("unknown"), Status_SystemException},
+	}
+	for _, c := range cases {
+		if got := StatusOf(c.err); got != c.status {
+			t.Errorf("StatusOf(%v) = %s, want %s", c.err, got, c.status)
+		}
+	}
+}
+
+func TestErrorResp(t *testing.T) {
+	req := New(wire.CommandChatUserTalk, WithSeq(3), WithContentType(ContentType_Json))
+	req.Version = wire.Version1
+	resp := NewErrorResp(req, NewError(Status_NoDestination, "dest is empty"))
+	if resp.Flag != Flag_Response || resp.Sequence != 3 || resp.Version != wire.Version1 {
+		t.Fatalf("unexpected response %v", resp)
+	}
+
+	read, err := MustReadLogicPkt(bytes.NewReader(Marshal(resp)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = read.Err()
+	if StatusOf(err) != Status_NoDestination || err.Error() != "dest is empty" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if NewErrorResp(req, nil).Err() != nil {
+		t.Fatal("success response has an error")
+	}
+}
@@ -0,0 +1,214 @@
+package pkt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// errors of meta
+var (
+	ErrMetaNotFound = errors.New("meta not found")
+	ErrMetaType     = errors.New("meta type mismatch")
+)
+
+// AddMeta AddMeta
+func (p *LogicPkt) AddMeta(m ...*Meta) {
+	p.Meta = append(p.Meta, m...)
+}
+
+// AddStringMeta AddStringMeta
+func (p *LogicPkt) AddStringMeta(key, value string) {
+	p.AddMeta(&Meta{
+		Key:   key,
+		Value: value,
+		Type:  MetaType_string,
+	})
+}
+
+// AddIntMeta AddIntMeta
+func (p *LogicPkt) AddIntMeta(key string, value int64) {
+	p.AddMeta(&Meta{
+		Key:   key,
+		Value: strconv.FormatInt(value, 10),
+		Type:  MetaType_int,
+	})
+}
+
+// AddFloatMeta AddFloatMeta
+func (p *LogicPkt) AddFloatMeta(key string, value float64) {
+	p.AddMeta(&Meta{
+		Key:   key,
+		Value: strconv.FormatFloat(value, 'g', -1, 64),
+		Type:  MetaType_float,
+	})
+}
+
+// AddListMeta Value是json编码的字符串数组，元素中可以包含任意字符
+func (p *LogicPkt) AddListMeta(key string, values []string) {
+	p.AddMeta(NewListMeta(key, values))
+}
+
+// NewListMeta NewListMeta
+func NewListMeta(key string, values []string) *Meta {
+	if values == nil {
+		values = []string{}
+	}
+	b, _ := json.Marshal(values)
+	return &Meta{
+		Key:   key,
+		Value: string(b),
+		Type:  MetaType_list,
+	}
+}
+
+// SetMeta 替换key相同的第一个meta并删除其余的，不存在时追加
+func (p *LogicPkt) SetMeta(m *Meta) {
+	replaced := false
+	metas := p.Meta[:0]
+	for _, old := range p.Meta {
+		if old.Key != m.Key {
+			metas = append(metas, old)
+		} else if !replaced {
+			metas = append(metas, m)
+			replaced = true
+		}
+	}
+	p.Meta = truncateMeta(p.Meta, len(metas))
+	if !replaced {
+		p.Meta = append(p.Meta, m)
+	}
+}
+
+// lookupMeta 返回key对应的第一个meta
+func (p *LogicPkt) lookupMeta(key string) (*Meta, error) {
+	for _, m := range p.Meta {
+		if m.Key == key {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrMetaNotFound, key)
+}
+
+// GetMeta extra value, the type of the value is int, float64, string or []string
+//
+// 值无法解析时返回false，需要知道原因时使用GetStringMeta等方法
+func (p *LogicPkt) GetMeta(key string) (interface{}, bool) {
+	m, err := p.lookupMeta(key)
+	if err != nil {
+		return nil, false
+	}
+	var val interface{}
+	switch m.Type {
+	case MetaType_int:
+		var v int64
+		v, err = parseIntMeta(m)
+		val = int(v)
+	case MetaType_float:
+		val, err = parseFloatMeta(m)
+	case MetaType_list:
+		val, err = parseListMeta(m)
+	default:
+		val = m.Value
+	}
+	if err != nil {
+		return nil, false
+	}
+	return val, true
+}
+
+// GetStringMeta 返回字符串类型的meta
+func (p *LogicPkt) GetStringMeta(key string) (string, error) {
+	m, err := p.lookupMeta(key)
+	if err != nil {
+		return "", err
+	}
+	if m.Type != MetaType_string {
+		return "", fmt.Errorf("%w: %s is %s", ErrMetaType, key, m.Type)
+	}
+	return m.Value, nil
+}
+
+// GetIntMeta 返回整数类型的meta
+func (p *LogicPkt) GetIntMeta(key string) (int64, error) {
+	m, err := p.lookupMeta(key)
+	if err != nil {
+		return 0, err
+	}
+	return parseIntMeta(m)
+}
+
+// GetFloatMeta 返回浮点数类型的meta，整数类型的meta也可以读取
+func (p *LogicPkt) GetFloatMeta(key string) (float64, error) {
+	m, err := p.lookupMeta(key)
+	if err != nil {
+		return 0, err
+	}
+	if m.Type == MetaType_int {
+		v, err := parseIntMeta(m)
+		return float64(v), err
+	}
+	return parseFloatMeta(m)
+}
+
+// GetListMeta 返回列表类型的meta
+func (p *LogicPkt) GetListMeta(key string) ([]string, error) {
+	m, err := p.lookupMeta(key)
+	if err != nil {
+		return nil, err
+	}
+	return parseListMeta(m)
+}
+
+// DelMeta 删除key对应的所有meta
+func (p *LogicPkt) DelMeta(key string) {
+	metas := p.Meta[:0]
+	for _, m := range p.Meta {
+		if m.Key != key {
+			metas = append(metas, m)
+		}
+	}
+	p.Meta = truncateMeta(p.Meta, len(metas))
+}
+
+func parseIntMeta(m *Meta) (int64, error) {
+	if m.Type != MetaType_int {
+		return 0, fmt.Errorf("%w: %s is %s", ErrMetaType, m.Key, m.Type)
+	}
+	v, err := strconv.ParseInt(m.Value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("meta %s: %w", m.Key, err)
+	}
+	return v, nil
+}
+
+func parseFloatMeta(m *Meta) (float64, error) {
+	if m.Type != MetaType_float {
+		return 0, fmt.Errorf("%w: %s is %s", ErrMetaType, m.Key, m.Type)
+	}
+	v, err := strconv.ParseFloat(m.Value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("meta %s: %w", m.Key, err)
+	}
+	return v, nil
+}
+
+func parseListMeta(m *Meta) ([]string, error) {
+	if m.Type != MetaType_list {
+		return nil, fmt.Errorf("%w: %s is %s", ErrMetaType, m.Key, m.Type)
+	}
+	var values []string
+	if err := json.Unmarshal([]byte(m.Value), &values); err != nil {
+		return nil, fmt.Errorf("meta %s: %w", m.Key, err)
+	}
+	return values, nil
+}
+
+// truncateMeta 清空被删除的位置，避免底层数组继续引用
+func truncateMeta(metas []*Meta, n int) []*Meta {
+	for i := n; i < len(metas); i++ {
+		metas[i] = nil
+	}
+	return metas[:n]
+}
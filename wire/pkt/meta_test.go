@@ -0,0 +1,83 @@
+package pkt
+
+import (
+	"bytes"
+	"errors"
+	"im/wire"
+	"reflect"
+	"testing"
+)
+
+func TestTypedMeta(t *testing.T) {
+	p := New(wire.CommandChatUserTalk)
+	p.AddStringMeta(wire.MetaDestServer, "gateway01")
+	p.AddIntMeta("x.count", -42)
+	p.AddFloatMeta("x.ratio", 0.25)
+	p.AddListMeta(wire.MetaDestChannels, []string{"c1", "c,2"})
+
+	read, err := MustReadLogicPkt(bytes.NewReader(Marshal(p)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := read.GetStringMeta(wire.MetaDestServer); err != nil || v != "gateway01" {
+		t.Fatalf("unexpected string meta %v %v", v, err)
+	}
+	if v, err := read.GetIntMeta("x.count"); err != nil || v != -42 {
+		t.Fatalf("unexpected int meta %v %v", v, err)
+	}
+	if v, err := read.GetFloatMeta("x.ratio"); err != nil || v != 0.25 {
+		t.Fatalf("unexpected float meta %v %v", v, err)
+	}
+	if v, err := read.GetListMeta(wire.MetaDestChannels); err != nil || !reflect.DeepEqual(v, []string{"c1", "c,2"}) {
+		t.Fatalf("unexpected list meta %v %v", v, err)
+	}
+	if v, ok := read.GetMeta("x.count"); !ok || v != -42 {
+		t.Fatalf("unexpected meta %v", v)
+	}
+
+	if _, err = read.GetIntMeta(wire.MetaDestServer); !errors.Is(err, ErrMetaType) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err = read.GetStringMeta("x.none"); !errors.Is(err, ErrMetaNotFound) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	read.AddMeta(&Meta{Key: "x.bad", Value: "abc", Type: MetaType_int})
+	if _, err = read.GetIntMeta("x.bad"); err == nil {
+		t.Fatal("parse error is ignored")
+	}
+	if _, ok := read.GetMeta("x.bad"); ok {
+		t.Fatal("invalid meta is returned")
+	}
+}
+
+func TestSetDelMeta(t *testing.T) {
+	p := New(wire.CommandChatUserTalk)
+	p.AddStringMeta("a", "1")
+	p.AddStringMeta("b", "1")
+	p.AddStringMeta("b", "2")
+	p.AddStringMeta("c", "1")
+	p.AddStringMeta("b", "3")
+
+	p.SetMeta(&Meta{Key: "b", Value: "4", Type: MetaType_string})
+	if len(p.Meta) != 3 || p.Meta[1].Value != "4" {
+		t.Fatalf("unexpected meta %v", p.Meta)
+	}
+	p.SetMeta(&Meta{Key: "d", Value: "1", Type: MetaType_string})
+	if len(p.Meta) != 4 || p.Meta[3].Key != "d" {
+		t.Fatalf("unexpected meta %v", p.Meta)
+	}
+
+	// 相邻的重复key都要删除
+	p.AddStringMeta("e", "1")
+	p.AddStringMeta("e", "2")
+	p.AddStringMeta("e", "3")
+	p.DelMeta("e")
+	p.DelMeta("a")
+	var keys []string
+	for _, m := range p.Meta {
+		keys = append(keys, m.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"b", "c", "d"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
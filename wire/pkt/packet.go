@@ -1,19 +1,21 @@
 package pkt
 
 import (
-	"encoding/json"
 	"fmt"
 	"google.golang.org/protobuf/proto"
 	"im/wire"
 	"im/wire/endian"
 	"io"
-	"strconv"
 	"strings"
 )
 
 type LogicPkt struct {
 	Header
 	Body []byte `json:"body,omitempty"`
+	// Version 编码使用的包格式版本，wire.Version0是没有版本号的原始格式；解码时记录读到的版本
+	Version wire.Version `json:"-"`
+	// Flags 版本化包头中的标志位，wire.Version0不会编码
+	Flags Flags `json:"-"`
 }
 
 // HeaderOption HeaderOption
@@ -33,6 +35,13 @@ func WithSeq(seq uint32) HeaderOption {
 	}
 }
 
+// WithContentType set encoding of the body
+func WithContentType(ct ContentType) HeaderOption {
+	return func(h *Header) {
+		h.ContentType = ct
+	}
+}
+
 // WithChannel set channelID
 func WithChannel(channelID string) HeaderOption {
 	return func(h *Header) {
@@ -65,59 +74,78 @@ func New(command string, options ...HeaderOption) *LogicPkt {
 func NewFrom(header *Header) *LogicPkt {
 	pkt := &LogicPkt{}
 	pkt.Header = Header{
-		Command:   header.Command,
-		Sequence:  header.Sequence,
-		ChannelId: header.ChannelId,
-		Status:    header.Status,
-		Dest:      header.Dest,
+		Command:     header.Command,
+		Sequence:    header.Sequence,
+		ChannelId:   header.ChannelId,
+		Status:      header.Status,
+		Dest:        header.Dest,
+		ContentType: header.ContentType,
 	}
 	return pkt
 }
 
-// ReadPkt read bytes to LogicPkt from a reader
+// Decode 从reader中读取不带magic的LogicPkt，header使用pool中的缓冲区读取
 func (p *LogicPkt) Decode(r io.Reader) error {
-	headerBytes, err := endian.ReadBytes(r)
+	return p.decode(r, &defaultDecoder.options)
+}
+
+func (p *LogicPkt) decode(r io.Reader, o *DecoderOptions) error {
+	n, err := endian.ReadUint32(r)
 	if err != nil {
 		return err
 	}
-	if err := proto.Unmarshal(headerBytes, &p.Header); err != nil {
+	if n > o.MaxHeaderSize {
+		return ErrPacketTooLarge
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if cap(*buf) < int(n) {
+		*buf = make([]byte, n)
+	}
+	header := (*buf)[:n]
+	if _, err = io.ReadFull(r, header); err != nil {
+		return err
+	}
+	if err = proto.Unmarshal(header, &p.Header); err != nil {
 		return err
 	}
 	// read body
-	p.Body, err = endian.ReadBytes(r)
+	p.Body, err = endian.ReadBytesLimit(r, o.MaxBodySize)
+	if err == endian.ErrTooLarge {
+		return ErrPacketTooLarge
+	}
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// Encode Encode Header to writer
+// Encode 序列化不带magic的数据，一次写入writer
 func (p *LogicPkt) Encode(w io.Writer) error {
-	headerBytes, err := proto.Marshal(&p.Header)
-	if err != nil {
-		return err
-	}
-	if err := endian.WriteBytes(w, headerBytes); err != nil {
-		return err
-	}
-	if err := endian.WriteBytes(w, p.Body); err != nil {
-		return err
-	}
-	return nil
+	return encodeTo(w, p.appendTo)
 }
 
-// ReadBody val must be a pointer
+// ReadBody 按照Header中的ContentType解码Body并校验，压缩过的Body会先被解压
 func (p *LogicPkt) ReadBody(val proto.Message) error {
-	return json.Unmarshal(p.Body, val)
+	if err := p.Decompress(); err != nil {
+		return err
+	}
+	return unmarshalBody(p.ContentType, p.Body, val)
 }
 
-// WritePb WritePb
-func (p *LogicPkt) WriteBody(val proto.Message) *LogicPkt {
+// WriteBody 按照Header中的ContentType编码val，val为nil时Body为空；需要压缩时在之后调用Compress
+func (p *LogicPkt) WriteBody(val proto.Message) error {
+	p.Flags &^= FlagCompressed
 	if val == nil {
-		return p
+		p.Body = nil
+		return nil
 	}
-	p.Body, _ = json.Marshal(val)
-	return p
+	body, err := marshalBody(p.ContentType, val)
+	if err != nil {
+		return err
+	}
+	p.Body = body
+	return nil
 }
 
 // StringBody return string body
@@ -136,48 +164,3 @@ func (h *Header) ServiceName() string {
 	}
 	return arr[0]
 }
-
-// AddMeta AddMeta
-func (p *LogicPkt) AddMeta(m ...*Meta) {
-	p.Meta = append(p.Meta, m...)
-}
-
-// AddStringMeta AddStringMeta
-func (p *LogicPkt) AddStringMeta(key, value string) {
-	p.AddMeta(&Meta{
-		Key:   key,
-		Value: value,
-		Type:  MetaType_string,
-	})
-}
-
-// GetMeta extra value
-func (p *LogicPkt) GetMeta(key string) (interface{}, bool) {
-	for _, m := range p.Meta {
-		if m.Key == key {
-			switch m.Type {
-			case MetaType_int:
-				v, _ := strconv.Atoi(m.Value)
-				return v, true
-			case MetaType_float:
-				v, _ := strconv.ParseFloat(m.Value, 64)
-				return v, true
-			}
-			return m.Value, true
-		}
-	}
-	return nil, false
-}
-
-// DelMeta DelMeta
-func (p *LogicPkt) DelMeta(key string) {
-	for i, m := range p.Meta {
-		if m.Key == key {
-			length := len(p.Meta)
-			if i < length-1 {
-				copy(p.Meta[i:], p.Meta[i+1:])
-			}
-			p.Meta = p.Meta[:length-1]
-		}
-	}
-}
@@ -0,0 +1,101 @@
+// Code generated by protoc-gen-im-validate. DO NOT EDIT.
+// source: protocol.proto
+
+package pkt
+
+import (
+	validate "im/wire/validate"
+)
+
+// Validate checks the rules declared in protocol.proto
+func (x *LoginReq) Validate() error {
+	if len(x.GetToken()) == 0 {
+		return validate.Required("LoginReq", "token")
+	}
+	return nil
+}
+
+// Validate checks the rules declared in protocol.proto
+func (x *MessageReq) Validate() error {
+	if len(x.GetBody()) > 131072 {
+		return validate.MaxLen("MessageReq", "body", 131072)
+	}
+	return nil
+}
+
+// Validate checks the rules declared in protocol.proto
+func (x *GroupCreateReq) Validate() error {
+	if len(x.GetName()) == 0 {
+		return validate.Required("GroupCreateReq", "name")
+	}
+	if len(x.GetName()) > 64 {
+		return validate.MaxLen("GroupCreateReq", "name", 64)
+	}
+	if len(x.GetOwner()) == 0 {
+		return validate.Required("GroupCreateReq", "owner")
+	}
+	if len(x.GetMembers()) > 1000 {
+		return validate.MaxLen("GroupCreateReq", "members", 1000)
+	}
+	return nil
+}
+
+// Validate checks the rules declared in protocol.proto
+func (x *GroupJoinReq) Validate() error {
+	if len(x.GetAccount()) == 0 {
+		return validate.Required("GroupJoinReq", "account")
+	}
+	if len(x.GetGroupId()) == 0 {
+		return validate.Required("GroupJoinReq", "group_id")
+	}
+	return nil
+}
+
+// Validate checks the rules declared in protocol.proto
+func (x *GroupQuitReq) Validate() error {
+	if len(x.GetAccount()) == 0 {
+		return validate.Required("GroupQuitReq", "account")
+	}
+	if len(x.GetGroupId()) == 0 {
+		return validate.Required("GroupQuitReq", "group_id")
+	}
+	return nil
+}
+
+// Validate checks the rules declared in protocol.proto
+func (x *GroupGetReq) Validate() error {
+	if len(x.GetGroupId()) == 0 {
+		return validate.Required("GroupGetReq", "group_id")
+	}
+	return nil
+}
+
+// Validate checks the rules declared in protocol.proto
+func (x *MessageContentReq) Validate() error {
+	if len(x.GetMessageIds()) == 0 {
+		return validate.Required("MessageContentReq", "message_ids")
+	}
+	if len(x.GetMessageIds()) > 100 {
+		return validate.MaxLen("MessageContentReq", "message_ids", 100)
+	}
+	return nil
+}
+
+// Validate checks the rules declared in protocol.proto
+func (x *KeyBundleUploadReq) Validate() error {
+	if x.GetBundle() == nil {
+		return validate.Required("KeyBundleUploadReq", "bundle")
+	}
+	return nil
+}
+
+// Validate checks the rules declared in protocol.proto
+func (x *KeyBundleFetchReq) Validate() error {
+	if len(x.GetAccounts()) == 0 {
+		return validate.Required("KeyBundleFetchReq", "accounts")
+	}
+	if len(x.GetAccounts()) > 100 {
+		return validate.MaxLen("KeyBundleFetchReq", "accounts", 100)
+	}
+	return nil
+}
@@ -1,13 +1,14 @@
 package pkt
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
-	"im/wire"
 	"io"
-	"reflect"
 )
 
+// ErrPacketTooLarge 包的长度超过了限制
+var ErrPacketTooLarge = errors.New("packet is too large")
+
 type Packet interface {
 	Decode(r io.Reader) error
 	Encode(w io.Writer) error
@@ -35,39 +36,20 @@ func MustReadBasicPkt(r io.Reader) (*BasicPkt, error) {
 	return nil, fmt.Errorf("packet is not a basic packet")
 }
 
+// Read 使用默认的长度限制读取一个包，原始格式与版本化格式都可以读取
 func Read(r io.Reader) (interface{}, error) {
-	magic := wire.Magic{}
-	_, err := io.ReadFull(r, magic[:])
-	if err != nil {
-		return nil, err
-	}
-	switch magic {
-	case wire.MagicLogicPkt:
-		p := new(LogicPkt)
-		if err := p.Decode(r); err != nil {
-			return nil, err
-		}
-		return p, nil
-	case wire.MagicBasicPkt:
-		p := new(BasicPkt)
-		if err := p.Decode(r); err != nil {
-			return nil, err
-		}
-		return p, nil
-	default:
-		return nil, fmt.Errorf("magic code %s is incorrect", magic)
-	}
+	return defaultDecoder.Read(r)
 }
 
+// Marshal 序列化包括magic在内的数据，按照Size一次分配
 func Marshal(p Packet) []byte {
-	buf := new(bytes.Buffer)
-	kind := reflect.TypeOf(p).Elem()
-
-	if kind.AssignableTo(reflect.TypeOf(LogicPkt{})) {
-		_, _ = buf.Write(wire.MagicLogicPkt[:])
-	} else if kind.AssignableTo(reflect.TypeOf(BasicPkt{})) {
-		_, _ = buf.Write(wire.MagicBasicPkt[:])
+	var size int
+	switch p := p.(type) {
+	case *LogicPkt:
+		size = p.Size()
+	case *BasicPkt:
+		size = p.Size()
 	}
-	_ = p.Encode(buf)
-	return buf.Bytes()
+	b, _ := MarshalTo(make([]byte, 0, size), p)
+	return b
 }
@@ -0,0 +1,24 @@
+package pkt
+
+import "bytes"
+
+// Sequencer 按LogicPkt的Sequence匹配请求与响应，用于客户端断线重连后重发请求
+type Sequencer struct{}
+
+// Request return sequence of a request packet
+func (Sequencer) Request(payload []byte) (uint32, bool) {
+	p, err := MustReadLogicPkt(bytes.NewReader(payload))
+	if err != nil || p.Flag != Flag_Request {
+		return 0, false
+	}
+	return p.Sequence, true
+}
+
+// Response return sequence of a response packet
+func (Sequencer) Response(payload []byte) (uint32, bool) {
+	p, err := MustReadLogicPkt(bytes.NewReader(payload))
+	if err != nil || p.Flag != Flag_Response {
+		return 0, false
+	}
+	return p.Sequence, true
+}
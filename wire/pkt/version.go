@@ -0,0 +1,108 @@
+package pkt
+
+import (
+	"errors"
+	"fmt"
+	"im/wire"
+)
+
+// Flags 版本化包头中的标志位，描述Body的编码
+type Flags uint8
+
+const (
+	// FlagCompressed Body已经被压缩
+	FlagCompressed Flags = 1 << iota
+	// FlagEncrypted Body已经被加密
+	FlagEncrypted
+	// FlagJSON Body是json编码，与Header中的ContentType一致
+	FlagJSON
+)
+
+// Has 是否设置了flag
+func (f Flags) Has(flag Flags) bool {
+	return f&flag != 0
+}
+
+// ErrUnsupportedVersion 无法识别的包版本
+var ErrUnsupportedVersion = errors.New("unsupported packet version")
+
+// versionedSize 版本化包头在magic之后的长度：version + flags
+const versionedSize = 2
+
+// CodeHello 版本协商使用的BasicPkt
+//
+// 客户端在登录之前发送Body为支持的版本列表的CodeHello，服务端回复Body为选定版本的CodeHello；
+// 旧的客户端不发送CodeHello，服务端使用wire.Version0
+const CodeHello = uint16(3)
+
+// SupportedVersions 本端支持的版本
+var SupportedVersions = []wire.Version{wire.Version0, wire.Version1}
+
+// NewHello 创建客户端的版本协商包
+func NewHello(versions ...wire.Version) *BasicPkt {
+	if len(versions) == 0 {
+		versions = SupportedVersions
+	}
+	body := make([]byte, len(versions))
+	for i, v := range versions {
+		body[i] = byte(v)
+	}
+	return &BasicPkt{Code: CodeHello, Length: uint16(len(body)), Body: body}
+}
+
+// ReplyHello 服务端选择双方都支持的最高版本，返回回复给客户端的包
+func ReplyHello(hello *BasicPkt, supported ...wire.Version) (*BasicPkt, wire.Version, error) {
+	if hello.Code != CodeHello {
+		return nil, wire.Version0, fmt.Errorf("packet code %d is not hello", hello.Code)
+	}
+	if len(supported) == 0 {
+		supported = SupportedVersions
+	}
+	version := wire.Version0
+	for _, v := range hello.Body {
+		for _, s := range supported {
+			if wire.Version(v) == s && s > version {
+				version = s
+			}
+		}
+	}
+	return &BasicPkt{Code: CodeHello, Length: 1, Body: []byte{byte(version)}}, version, nil
+}
+
+// ParseHelloReply 客户端读取服务端选定的版本
+func ParseHelloReply(reply *BasicPkt) (wire.Version, error) {
+	if reply.Code != CodeHello || len(reply.Body) != 1 {
+		return wire.Version0, fmt.Errorf("invalid hello reply")
+	}
+	version := wire.Version(reply.Body[0])
+	if version > wire.LatestVersion {
+		return wire.Version0, ErrUnsupportedVersion
+	}
+	return version, nil
+}
+
+// wireFlags 编码时的标志位，FlagJSON由ContentType决定
+func (p *LogicPkt) wireFlags() Flags {
+	flags := p.Flags &^ FlagJSON
+	if p.ContentType == ContentType_Json {
+		flags |= FlagJSON
+	}
+	return flags
+}
+
+// setVersion 记录解码时读到的版本与标志位
+func (p *LogicPkt) setVersion(version wire.Version, flags Flags) {
+	p.Version = version
+	p.Flags = flags
+	if flags.Has(FlagJSON) {
+		p.ContentType = ContentType_Json
+	}
+}
+
+// checkVersion 检查版本化包头
+func checkVersion(version wire.Version) error {
+	if version == wire.Version0 || version > wire.LatestVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package pkt
+
+import (
+	"bytes"
+	"errors"
+	"im/wire"
+	"testing"
+)
+
+func TestVersionedPacket(t *testing.T) {
+	p := testPkt()
+	p.Version = wire.Version1
+	p.Flags = FlagCompressed
+	p.ContentType = ContentType_Json
+	b := Marshal(p)
+	if !bytes.Equal(b[:4], wire.MagicVersioned[:]) || len(b) != p.Size() {
+		t.Fatalf("unexpected versioned packet %x", b[:6])
+	}
+
+	read, err := MustReadLogicPkt(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unmarshaled LogicPkt
+	if err = unmarshaled.UnmarshalFrom(b); err != nil {
+		t.Fatal(err)
+	}
+	for _, got := range []*LogicPkt{read, &unmarshaled} {
+		if got.Version != wire.Version1 || got.Flags != FlagCompressed|FlagJSON || got.ContentType != ContentType_Json {
+			t.Fatalf("unexpected version %d flags %b", got.Version, got.Flags)
+		}
+		if got.Command != p.Command || !bytes.Equal(got.Body, p.Body) {
+			t.Fatalf("unexpected packet %v", got)
+		}
+	}
+
+	// 原始格式读取后的版本是Version0
+	legacy, err := MustReadLogicPkt(bytes.NewReader(Marshal(testPkt())))
+	if err != nil || legacy.Version != wire.Version0 {
+		t.Fatalf("unexpected legacy packet %v %v", legacy, err)
+	}
+
+	b[4] = byte(wire.LatestVersion + 1)
+	if _, err = Read(bytes.NewReader(b)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err = Unmarshal(b); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestHello(t *testing.T) {
+	cases := []struct {
+		client, server []wire.Version
+		expect         wire.Version
+	}{
+		{nil, nil, wire.LatestVersion},
+		{[]wire.Version{wire.Version0, wire.Version1}, []wire.Version{wire.Version0}, wire.Version0},
+		{[]wire.Version{wire.Version0}, nil, wire.Version0},
+		{[]wire.Version{wire.Version1, 9}, nil, wire.Version1},
+	}
+	for _, c := range cases {
+		hello, err := MustReadBasicPkt(bytes.NewReader(Marshal(NewHello(c.client...))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply, version, err := ReplyHello(hello, c.server...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseHelloReply(reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != c.expect || got != c.expect {
+			t.Fatalf("%v %v: unexpected version %d %d", c.client, c.server, version, got)
+		}
+	}
+}
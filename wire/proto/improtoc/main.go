@@ -0,0 +1,142 @@
+// Command improtoc 代替protoc：使用go.mod中固定版本的protocompile编译proto文件，再调用protoc插件生成代码
+//
+// 工具链的版本全部由go.mod固定，不需要单独安装protoc，在wire目录执行 go generate 即可。
+//
+//	improtoc -I proto -plugin ../bin/protoc-gen-go -plugin ../bin/protoc-gen-im-validate -out . common.proto
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/pluginpb"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+type paths []string
+
+func (p *paths) String() string     { return strings.Join(*p, ",") }
+func (p *paths) Set(v string) error { *p = append(*p, v); return nil }
+
+func main() {
+	var (
+		imports paths
+		plugins paths
+		out     string
+	)
+	flag.Var(&imports, "I", "import path, may be repeated")
+	flag.Var(&plugins, "plugin", "path of a protoc-gen-* plugin, may be repeated")
+	flag.StringVar(&out, "out", ".", "output directory")
+	flag.Parse()
+
+	if err := Generate(imports, plugins, out, flag.Args()...); err != nil {
+		fmt.Fprintln(os.Stderr, "improtoc:", err)
+		os.Exit(1)
+	}
+}
+
+// Generate 编译files，依次调用plugins，把生成的文件写入out
+func Generate(imports, plugins []string, out string, files ...string) error {
+	req, err := Request(imports, files...)
+	if err != nil {
+		return err
+	}
+	for _, plugin := range plugins {
+		generated, err := Run(plugin, req)
+		if err != nil {
+			return err
+		}
+		for _, f := range generated {
+			path := filepath.Join(out, f.GetName())
+			if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			if err = os.WriteFile(path, []byte(f.GetContent()), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Request 编译files，返回交给插件的CodeGeneratorRequest；依赖的文件排在前面
+func Request(imports []string, files ...string) (*pluginpb.CodeGeneratorRequest, error) {
+	compiler := protocompile.Compiler{
+		Resolver:       protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: imports}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	compiled, err := compiler.Compile(context.Background(), files...)
+	if err != nil {
+		return nil, err
+	}
+	req := &pluginpb.CodeGeneratorRequest{FileToGenerate: files}
+	seen := make(map[string]bool)
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		for i := 0; i < fd.Imports().Len(); i++ {
+			add(fd.Imports().Get(i).FileDescriptor)
+		}
+		req.ProtoFile = append(req.ProtoFile, protodesc.ToFileDescriptorProto(fd))
+	}
+	for _, fd := range compiled {
+		add(fd)
+	}
+	return req, nil
+}
+
+// protocVersion protoc-gen-go记录的protoc版本，这里记录为protocompile的版本
+var protocVersion = regexp.MustCompile(`(?m)^// \tprotoc        \(unknown\)$`)
+
+// Run 执行插件，返回生成的文件
+func Run(plugin string, req *pluginpb.CodeGeneratorRequest) ([]*pluginpb.CodeGeneratorResponse_File, error) {
+	in, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(plugin)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", plugin, err, stderr.Bytes())
+	}
+	var resp pluginpb.CodeGeneratorResponse
+	if err = proto.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("%s: %v", plugin, err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("%s: %s", plugin, resp.GetError())
+	}
+	version := []byte("// \tprotocompile  " + compilerVersion())
+	for _, f := range resp.File {
+		f.Content = proto.String(string(protocVersion.ReplaceAll([]byte(f.GetContent()), version)))
+	}
+	return resp.File, nil
+}
+
+// compilerVersion go.mod中固定的protocompile版本
+func compilerVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/bufbuild/protocompile" {
+				return dep.Version
+			}
+		}
+	}
+	return "(unknown)"
+}
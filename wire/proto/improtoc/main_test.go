@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// 生成的代码需要与proto保持一致，插件与编译器的版本都由go.mod固定
+func TestGenerated(t *testing.T) {
+	dir := t.TempDir()
+	build := exec.Command("go", "build", "-o", dir+string(filepath.Separator),
+		"google.golang.org/protobuf/cmd/protoc-gen-go", "../protoc-gen-im-validate")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	out := filepath.Join(dir, "out")
+	plugins := []string{filepath.Join(dir, "protoc-gen-go"), filepath.Join(dir, "protoc-gen-im-validate")}
+	err := Generate([]string{".."}, plugins, out, "common.proto", "protocol.proto", "rpc.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generated int
+	err = filepath.WalkDir(out, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		generated++
+		name, _ := filepath.Rel(out, path)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		got, err := os.ReadFile(filepath.Join("../..", name))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("%s is out of date, run go generate ./wire", name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generated != 5 {
+		t.Fatalf("generated %d files", generated)
+	}
+}
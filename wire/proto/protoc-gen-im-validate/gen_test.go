@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+	"testing"
+)
+
+// plugin 一个只有message A的proto文件，field是A唯一的字段，comment是字段的注释
+func plugin(t *testing.T, field *descriptorpb.FieldDescriptorProto, comment string) *protogen.Plugin {
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("a.proto"),
+		Syntax:      proto.String("proto3"),
+		Options:     &descriptorpb.FileOptions{GoPackage: proto.String("./pkt")},
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("A"), Field: []*descriptorpb.FieldDescriptorProto{field}}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{Location: []*descriptorpb.SourceCodeInfo_Location{{
+			Path:             []int32{4, 0, 2, 0}, // message_type[0].field[0]
+			Span:             []int32{0, 0, 0},
+			TrailingComments: proto.String(comment),
+		}}},
+	}
+	gen, err := protogen.Options{}.New(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"a.proto"},
+		ProtoFile:      []*descriptorpb.FileDescriptorProto{fd},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gen
+}
+
+func newField(typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String("f"),
+		JsonName: proto.String("f"),
+		Number:   proto.Int32(1),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:     typ.Enum(),
+	}
+}
+
+func TestValidator(t *testing.T) {
+	gen := plugin(t, newField(descriptorpb.FieldDescriptorProto_TYPE_STRING), ` validate:"required,max=64"`)
+	generateValidator(gen, gen.Files[0])
+	resp := gen.Response()
+	if resp.Error != nil || len(resp.File) != 1 {
+		t.Fatalf("unexpected response %v", resp)
+	}
+	content := resp.File[0].GetContent()
+	for _, want := range []string{"func (x *A) Validate() error", `validate.Required("A", "f")`, `validate.MaxLen("A", "f", 64)`} {
+		if !bytes.Contains([]byte(content), []byte(want)) {
+			t.Errorf("%q is not generated", want)
+		}
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	for _, c := range []struct {
+		typ     descriptorpb.FieldDescriptorProto_Type
+		comment string
+	}{
+		{descriptorpb.FieldDescriptorProto_TYPE_BOOL, ` validate:"required"`},
+		{descriptorpb.FieldDescriptorProto_TYPE_STRING, ` validate:"max=x"`},
+		{descriptorpb.FieldDescriptorProto_TYPE_STRING, ` validate:"unique"`},
+	} {
+		gen := plugin(t, newField(c.typ), c.comment)
+		generateValidator(gen, gen.Files[0])
+		if gen.Response().Error == nil {
+			t.Errorf("%s %s: expected an error", c.typ, c.comment)
+		}
+	}
+}
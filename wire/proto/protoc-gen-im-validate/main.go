@@ -0,0 +1,19 @@
+// Command protoc-gen-im-validate protoc插件，根据字段注释中的validate规则生成*.pb.validate.go
+//
+// *.pb.go由go.mod中固定版本的protoc-gen-go生成，在wire目录执行 go generate 即可，见improtoc。
+package main
+
+import (
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+func main() {
+	protogen.Options{}.Run(func(gen *protogen.Plugin) error {
+		for _, f := range gen.Files {
+			if f.Generate {
+				generateValidator(gen, f)
+			}
+		}
+		return nil
+	})
+}
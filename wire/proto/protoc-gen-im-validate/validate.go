@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// validatePackage 生成的代码引用的辅助函数
+const validatePackage = protogen.GoImportPath("im/wire/validate")
+
+// ruleComment 字段注释中的校验规则，比如 // validate:"required,max=64"
+//
+//	required  字符串、bytes、列表不能为空，消息不能为nil，数值不能为0
+//	min=N     字符串、bytes的长度或者列表的元素个数不能少于N，数值不能小于N
+//	max=N     字符串、bytes的长度或者列表的元素个数不能超过N，数值不能大于N
+var ruleComment = regexp.MustCompile(`validate:"([^"]*)"`)
+
+type rules struct {
+	required bool
+	min, max *int64
+}
+
+func (r rules) empty() bool {
+	return !r.required && r.min == nil && r.max == nil
+}
+
+func parseRules(field *protogen.Field) (rules, error) {
+	var r rules
+	comments := string(field.Comments.Leading) + string(field.Comments.Trailing)
+	m := ruleComment.FindStringSubmatch(comments)
+	if m == nil {
+		return r, nil
+	}
+	if field.Desc.Kind() == protoreflect.BoolKind {
+		return r, fmt.Errorf("%s: bool fields have no rules", field.Desc.FullName())
+	}
+	for _, rule := range strings.Split(m[1], ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch key {
+		case "required":
+			r.required = true
+		case "min", "max":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return r, fmt.Errorf("%s: invalid rule %q", field.Desc.FullName(), rule)
+			}
+			if key == "min" {
+				r.min = &n
+			} else {
+				r.max = &n
+			}
+		default:
+			return r, fmt.Errorf("%s: unknown rule %q", field.Desc.FullName(), rule)
+		}
+	}
+	return r, nil
+}
+
+// generateValidator 为声明了规则或者包含需要校验的消息的message生成Validate方法
+func generateValidator(gen *protogen.Plugin, file *protogen.File) {
+	fieldRules := make(map[*protogen.Field]rules)
+	for _, message := range file.Messages {
+		for _, field := range message.Fields {
+			r, err := parseRules(field)
+			if err != nil {
+				gen.Error(err)
+				return
+			}
+			if !r.empty() {
+				fieldRules[field] = r
+			}
+		}
+	}
+	// 包含需要校验的嵌套消息的message也需要校验
+	validated := make(map[*protogen.Message]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, message := range file.Messages {
+			if validated[message] {
+				continue
+			}
+			for _, field := range message.Fields {
+				if _, ok := fieldRules[field]; ok || (field.Message != nil && validated[field.Message]) {
+					validated[message] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	if len(validated) == 0 {
+		return
+	}
+
+	g := gen.NewGeneratedFile(file.GeneratedFilenamePrefix+".pb.validate.go", file.GoImportPath)
+	g.P("// Code generated by protoc-gen-im-validate. DO NOT EDIT.")
+	g.P("// source: ", file.Desc.Path())
+	g.P()
+	g.P("package ", file.GoPackageName)
+	for _, message := range file.Messages {
+		if !validated[message] {
+			continue
+		}
+		g.P()
+		g.P("// Validate checks the rules declared in ", file.Desc.Path())
+		g.P("func (x *", message.GoIdent, ") Validate() error {")
+		for _, field := range message.Fields {
+			generateFieldRules(g, message, field, fieldRules[field], field.Message != nil && validated[field.Message])
+		}
+		g.P("return nil")
+		g.P("}")
+	}
+}
+
+func generateFieldRules(g *protogen.GeneratedFile, message *protogen.Message, field *protogen.Field, r rules, nested bool) {
+	name := strconv.Quote(string(message.Desc.Name()))
+	fieldName := strconv.Quote(string(field.Desc.Name()))
+	get := "x.Get" + field.GoName + "()"
+	helper := func(fn string) string {
+		return g.QualifiedGoIdent(validatePackage.Ident(fn))
+	}
+	isList := field.Desc.IsList()
+	kind := field.Desc.Kind()
+	switch {
+	case isList || kind == protoreflect.StringKind || kind == protoreflect.BytesKind:
+		if r.required {
+			g.P("if len(", get, ") == 0 {")
+			g.P("return ", helper("Required"), "(", name, ", ", fieldName, ")")
+			g.P("}")
+		}
+		if r.min != nil {
+			g.P("if len(", get, ") < ", *r.min, " {")
+			g.P("return ", helper("MinLen"), "(", name, ", ", fieldName, ", ", *r.min, ")")
+			g.P("}")
+		}
+		if r.max != nil {
+			g.P("if len(", get, ") > ", *r.max, " {")
+			g.P("return ", helper("MaxLen"), "(", name, ", ", fieldName, ", ", *r.max, ")")
+			g.P("}")
+		}
+		if isList && nested {
+			g.P("for _, v := range ", get, " {")
+			g.P("if err := v.Validate(); err != nil {")
+			g.P("return ", helper("Nested"), "(", name, ", ", fieldName, ", err)")
+			g.P("}")
+			g.P("}")
+		}
+	case kind == protoreflect.MessageKind:
+		if r.required {
+			g.P("if ", get, " == nil {")
+			g.P("return ", helper("Required"), "(", name, ", ", fieldName, ")")
+			g.P("}")
+		}
+		if nested {
+			g.P("if v := ", get, "; v != nil {")
+			g.P("if err := v.Validate(); err != nil {")
+			g.P("return ", helper("Nested"), "(", name, ", ", fieldName, ", err)")
+			g.P("}")
+			g.P("}")
+		}
+	default:
+		if r.required {
+			g.P("if ", get, " == 0 {")
+			g.P("return ", helper("Required"), "(", name, ", ", fieldName, ")")
+			g.P("}")
+		}
+		if r.min != nil {
+			g.P("if int64(", get, ") < ", *r.min, " {")
+			g.P("return ", helper("MinValue"), "(", name, ", ", fieldName, ", ", *r.min, ")")
+			g.P("}")
+		}
+		if r.max != nil {
+			g.P("if int64(", get, ") > ", *r.max, " {")
+			g.P("return ", helper("MaxValue"), "(", name, ", ", fieldName, ", ", *r.max, ")")
+			g.P("}")
+		}
+	}
+}
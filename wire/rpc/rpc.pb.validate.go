@@ -0,0 +1,130 @@
+// Code generated by protoc-gen-im-validate. DO NOT EDIT.
+// source: rpc.proto
+
+package rpc
+
+import (
+	validate "im/wire/validate"
+)
+
+// Validate checks the rules declared in rpc.proto
+func (x *Message) Validate() error {
+	if len(x.GetBody()) > 131072 {
+		return validate.MaxLen("Message", "body", 131072)
+	}
+	return nil
+}
+
+// Validate checks the rules declared in rpc.proto
+func (x *InsertMessageReq) Validate() error {
+	if len(x.GetSender()) == 0 {
+		return validate.Required("InsertMessageReq", "sender")
+	}
+	if len(x.GetDest()) == 0 {
+		return validate.Required("InsertMessageReq", "dest")
+	}
+	if x.GetMessage() == nil {
+		return validate.Required("InsertMessageReq", "message")
+	}
+	if v := x.GetMessage(); v != nil {
+		if err := v.Validate(); err != nil {
+			return validate.Nested("InsertMessageReq", "message", err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the rules declared in rpc.proto
+func (x *AckMessageReq) Validate() error {
+	if len(x.GetAccount()) == 0 {
+		return validate.Required("AckMessageReq", "account")
+	}
+	if x.GetMessageId() == 0 {
+		return validate.Required("AckMessageReq", "message_id")
+	}
+	return nil
+}
+
+// Validate checks the rules declared in rpc.proto
+func (x *CreateGroupReq) Validate() error {
+	if len(x.GetName()) == 0 {
+		return validate.Required("CreateGroupReq", "name")
+	}
+	if len(x.GetName()) > 64 {
+		return validate.MaxLen("CreateGroupReq", "name", 64)
+	}
+	if len(x.GetOwner()) == 0 {
+		return validate.Required("CreateGroupReq", "owner")
+	}
+	if len(x.GetMembers()) > 1000 {
+		return validate.MaxLen("CreateGroupReq", "members", 1000)
+	}
+	return nil
+}
+
+// Validate checks the rules declared in rpc.proto
+func (x *JoinGroupReq) Validate() error {
+	if len(x.GetAccount()) == 0 {
+		return validate.Required("JoinGroupReq", "account")
+	}
+	if len(x.GetGroupId()) == 0 {
+		return validate.Required("JoinGroupReq", "group_id")
+	}
+	return nil
+}
+
+// Validate checks the rules declared in rpc.proto
+func (x *QuitGroupReq) Validate() error {
+	if len(x.GetAccount()) == 0 {
+		return validate.Required("QuitGroupReq", "account")
+	}
+	if len(x.GetGroupId()) == 0 {
+		return validate.Required("QuitGroupReq", "group_id")
+	}
+	return nil
+}
+
+// Validate checks the rules declared in rpc.proto
+func (x *GetGroupReq) Validate() error {
+	if len(x.GetGroupId()) == 0 {
+		return validate.Required("GetGroupReq", "group_id")
+	}
+	return nil
+}
+
+// Validate checks the rules declared in rpc.proto
+func (x *GroupMembersReq) Validate() error {
+	if len(x.GetGroupId()) == 0 {
+		return validate.Required("GroupMembersReq", "group_id")
+	}
+	return nil
+}
+
+// Validate checks the rules declared in rpc.proto
+func (x *GetOfflineMessageIndexReq) Validate() error {
+	if len(x.GetAccount()) == 0 {
+		return validate.Required("GetOfflineMessageIndexReq", "account")
+	}
+	return nil
+}
+
+// Validate checks the rules declared in rpc.proto
+func (x *GetOfflineMessageContentReq) Validate() error {
+	if len(x.GetMessageIds()) == 0 {
+		return validate.Required("GetOfflineMessageContentReq", "message_ids")
+	}
+	if len(x.GetMessageIds()) > 100 {
+		return validate.MaxLen("GetOfflineMessageContentReq", "message_ids", 100)
+	}
+	return nil
+}
+
+// Validate checks the rules declared in rpc.proto
+func (x *GetOfflineMessageContentResp) Validate() error {
+	for _, v := range x.GetList() {
+		if err := v.Validate(); err != nil {
+			return validate.Nested("GetOfflineMessageContentResp", "list", err)
+		}
+	}
+	return nil
+}
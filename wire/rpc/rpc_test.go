@@ -0,0 +1,26 @@
+package rpc
+
+import (
+	"errors"
+	"im/wire/validate"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	req := &InsertMessageReq{Sender: "u1", Dest: "u2", Message: &Message{Body: "hello"}}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	req.Message = &Message{Body: string(make([]byte, 131073))}
+	err := req.Validate()
+	if !errors.Is(err, validate.ErrInvalidField) || err.Error() != "InsertMessageReq.message: Message.body: length exceeds 131072" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	err = validate.Check(&GetOfflineMessageContentReq{})
+	var fe *validate.FieldError
+	if !errors.As(err, &fe) || fe.Field != "message_ids" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build tools
+
+package wire
+
+// 代码生成使用的protoc插件，通过go.mod固定版本
+import (
+	_ "google.golang.org/protobuf/cmd/protoc-gen-go"
+)
@@ -0,0 +1,69 @@
+// Package validate 生成的Validate方法使用的错误以及辅助函数
+package validate
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidField 所有校验失败的错误都可以通过errors.Is判断
+var ErrInvalidField = errors.New("invalid field")
+
+// FieldError 一个字段没有通过校验
+type FieldError struct {
+	Message string
+	Field   string
+	Reason  string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s.%s: %s", e.Message, e.Field, e.Reason)
+}
+
+// Unwrap Unwrap
+func (e *FieldError) Unwrap() error {
+	return ErrInvalidField
+}
+
+// Validator 声明了校验规则的消息都实现了这个接口
+type Validator interface {
+	Validate() error
+}
+
+// Check 校验m，没有声明规则的消息直接返回nil
+func Check(m interface{}) error {
+	if v, ok := m.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// Required Required
+func Required(message, field string) error {
+	return &FieldError{Message: message, Field: field, Reason: "is required"}
+}
+
+// MaxLen 字符串长度或者列表元素个数超过max
+func MaxLen(message, field string, max int) error {
+	return &FieldError{Message: message, Field: field, Reason: fmt.Sprintf("length exceeds %d", max)}
+}
+
+// MinLen 字符串长度或者列表元素个数少于min
+func MinLen(message, field string, min int) error {
+	return &FieldError{Message: message, Field: field, Reason: fmt.Sprintf("length is less than %d", min)}
+}
+
+// MaxValue 数值大于max
+func MaxValue(message, field string, max int64) error {
+	return &FieldError{Message: message, Field: field, Reason: fmt.Sprintf("must be at most %d", max)}
+}
+
+// MinValue 数值小于min
+func MinValue(message, field string, min int64) error {
+	return &FieldError{Message: message, Field: field, Reason: fmt.Sprintf("must be at least %d", min)}
+}
+
+// Nested 嵌套消息的错误
+func Nested(message, field string, err error) error {
+	return fmt.Errorf("%s.%s: %w", message, field, err)
+}